@@ -2,13 +2,13 @@ package builder
 
 import (
 	"go.mongodb.org/mongo-driver/bson"
-	"log"
 	"sync"
 )
 
 type UpdateManyBuilder struct {
 	m                sync.Mutex
 	updateOperations bson.D
+	ignoredAdds      int
 }
 
 func NewUpdateManyBuilder() *UpdateManyBuilder {
@@ -29,6 +29,14 @@ func (u *UpdateManyBuilder) HasValues() bool {
 	return true
 }
 
+// IgnoredAdds returns the number of calls to Add without fields. They are ignored and logged by database.Client when
+// the builder is used.
+func (u *UpdateManyBuilder) IgnoredAdds() int {
+	u.m.Lock()
+	defer u.m.Unlock()
+	return u.ignoredAdds
+}
+
 // Add creates a structure used for an UpdateMany command. The order in which command are provided are preserved.
 // Example:
 // u.Add(operator.Set, bson.E{Key: "name", "Asari"}).
@@ -36,14 +44,14 @@ func (u *UpdateManyBuilder) HasValues() bool {
 // 		Add(operator.Set, bson.E{Key: "email", "asari@gmail.com"})
 // Will result in {$set: {name: "Asari", email: "asari@gmail.com"}, $mul: {count: 2}}
 func (u *UpdateManyBuilder) Add(operator string, values ...bson.E) *UpdateManyBuilder {
+	u.m.Lock()
+	defer u.m.Unlock()
+
 	if len(values) < 1 {
-		log.Println("Call to Add() with zero fields....Ignoring this :) ")
+		u.ignoredAdds++
 		return u
 	}
 
-	u.m.Lock()
-	defer u.m.Unlock()
-
 	for key, updateOperator := range u.updateOperations {
 		if updateOperator.Key == operator {
 			tmp := append(updateOperator.Value.([]bson.E), values...)
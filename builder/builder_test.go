@@ -14,6 +14,7 @@ func TestUpdateManyBuilder_AddGetHasValues(t *testing.T) {
 	//Test No Fields
 	b.Add(operator.Set)
 	assert.Equal(t, 0, len(b.Get()))
+	assert.Equal(t, 1, b.IgnoredAdds())
 
 	b.Add(operator.Set, bson.E{Key: "name", Value: "asari"}, bson.E{Key: "score", Value: 500}).
 		Add(operator.Unset, bson.E{Key: "email", Value: "asari@gmail.com"}).
@@ -0,0 +1,120 @@
+// Package cache provides an in-memory database.Cache evicting the least recently used documents.
+//
+//	client.EnableCache(cache.NewLRU(10000, time.Minute), "users", "config")
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// LRU is a database.Cache holding up to a fixed number of entries, each for a fixed duration.
+	// The zero value is not usable, use NewLRU.
+	LRU struct {
+		mu       sync.Mutex
+		capacity int
+		ttl      time.Duration
+		entries  map[string]*list.Element
+		// recent orders entries from the most to the least recently used.
+		recent *list.List
+		tagged map[string]map[string]struct{}
+		now    func() time.Time
+	}
+
+	entry struct {
+		key     string
+		value   []byte
+		tags    []string
+		expires time.Time
+	}
+)
+
+// NewLRU returns an LRU holding up to capacity entries. Entries expire ttl after they are set, a ttl of 0 keeps them
+// until they are evicted or invalidated. A capacity of 0 or less is unbounded.
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  map[string]*list.Element{},
+		recent:   list.New(),
+		tagged:   map[string]map[string]struct{}{},
+		now:      time.Now,
+	}
+}
+
+// Get returns the value of key if it is cached and has not expired.
+func (l *LRU) Get(ctx context.Context, key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if !e.expires.IsZero() && !l.now().Before(e.expires) {
+		l.remove(element)
+		return nil, false
+	}
+	l.recent.MoveToFront(element)
+	return e.value, true
+}
+
+// Set caches value under key with tags, evicting the least recently used entry when the LRU is full.
+func (l *LRU) Set(ctx context.Context, key string, value []byte, tags []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.entries[key]; ok {
+		l.remove(element)
+	}
+
+	e := &entry{key: key, value: value, tags: tags}
+	if l.ttl > 0 {
+		e.expires = l.now().Add(l.ttl)
+	}
+	l.entries[key] = l.recent.PushFront(e)
+	for _, tag := range tags {
+		if l.tagged[tag] == nil {
+			l.tagged[tag] = map[string]struct{}{}
+		}
+		l.tagged[tag][key] = struct{}{}
+	}
+
+	if l.capacity > 0 && l.recent.Len() > l.capacity {
+		l.remove(l.recent.Back())
+	}
+}
+
+// Invalidate removes the entries carrying any of tags.
+func (l *LRU) Invalidate(ctx context.Context, tags ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range l.tagged[tag] {
+			l.remove(l.entries[key])
+		}
+	}
+}
+
+// Len returns the number of cached entries, including those that expired but were not read since.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.recent.Len()
+}
+
+func (l *LRU) remove(element *list.Element) {
+	e := l.recent.Remove(element).(*entry)
+	delete(l.entries, e.key)
+	for _, tag := range e.tags {
+		delete(l.tagged[tag], e.key)
+		if len(l.tagged[tag]) == 0 {
+			delete(l.tagged, tag)
+		}
+	}
+}
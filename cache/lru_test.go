@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"github.com/jcobhams/asari/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var _ database.Cache = (*LRU)(nil)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, 0)
+
+	lru.Set(ctx, "a", []byte("1"), nil)
+	lru.Set(ctx, "b", []byte("2"), nil)
+	value, ok := lru.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	//Test The Least Recently Used Entry Is Evicted
+	lru.Set(ctx, "c", []byte("3"), nil)
+	assert.Equal(t, 2, lru.Len())
+	_, ok = lru.Get(ctx, "b")
+	assert.False(t, ok)
+	_, ok = lru.Get(ctx, "a")
+	assert.True(t, ok)
+
+	lru.Set(ctx, "a", []byte("4"), nil)
+	value, _ = lru.Get(ctx, "a")
+	assert.Equal(t, []byte("4"), value)
+	assert.Equal(t, 2, lru.Len())
+}
+
+func TestLRU_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	lru := NewLRU(0, time.Minute)
+	lru.now = func() time.Time { return now }
+
+	lru.Set(ctx, "a", []byte("1"), nil)
+	now = now.Add(59 * time.Second)
+	_, ok := lru.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = lru.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestLRU_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(0, 0)
+
+	lru.Set(ctx, "users/id", []byte("1"), []string{"main.users", "main.users/1"})
+	lru.Set(ctx, "users/email", []byte("1"), []string{"main.users", "main.users/1"})
+	lru.Set(ctx, "users/other", []byte("2"), []string{"main.users", "main.users/2"})
+	lru.Set(ctx, "config/id", []byte("3"), []string{"main.config", "main.config/3"})
+
+	lru.Invalidate(ctx, "main.users/1")
+	assert.Equal(t, 2, lru.Len())
+	_, ok := lru.Get(ctx, "users/email")
+	assert.False(t, ok)
+
+	lru.Invalidate(ctx, "main.users", "main.unknown")
+	assert.Equal(t, 1, lru.Len())
+	_, ok = lru.Get(ctx, "config/id")
+	assert.True(t, ok)
+	assert.Empty(t, lru.tagged["main.users"])
+}
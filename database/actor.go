@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the actor performing the operations made with it - eg: a user ID.
+// The actor is recorded by the audit trail, revisions and on documents embedding document.Attribution.
+func WithActor(ctx context.Context, actor interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor or nil if there is none.
+func ActorFromContext(ctx context.Context) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Value(actorKey{})
+}
+
+// stampActor records the actor of ctx on doc when it implements document.Attributable. Without an actor the
+// attribution is left as is.
+func stampActor(ctx context.Context, doc interface{}, operation AuditOperation) {
+	attributable, ok := doc.(document.Attributable)
+	if !ok {
+		return
+	}
+	actor := ActorFromContext(ctx)
+	if actor == nil && operation != AuditRestore {
+		return
+	}
+
+	switch operation {
+	case AuditCreate:
+		attributable.SetCreatedBy(actor)
+		attributable.SetUpdatedBy(actor)
+	case AuditUpdate:
+		attributable.SetUpdatedBy(actor)
+	case AuditSoftDelete:
+		attributable.SetDeletedBy(actor)
+	case AuditRestore:
+		attributable.SetDeletedBy(nil)
+	}
+}
+
+// SetAttributedCollections lists the collections whose documents embed document.Attribution. UpdateMany only sets
+// updated_by on documents of these collections, as unlike SaveDocument it never sees the documents it updates. Each
+// call replaces the previous list.
+func (c *Client) SetAttributedCollections(collections ...string) {
+	attributed := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		attributed[collection] = true
+	}
+	c.attributedCollections = attributed
+}
+
+// withUpdatedBy returns a copy of update that also sets updated_by to the actor of ctx when collection is attributed.
+// update is returned as is when ctx carries no actor or update already sets updated_by.
+func (c *Client) withUpdatedBy(ctx context.Context, collection string, update bson.D) bson.D {
+	actor := ActorFromContext(ctx)
+	if actor == nil || !c.attributedCollections[collection] {
+		return update
+	}
+	return setUpdatedBy(update, actor)
+}
+
+// setUpdatedBy adds updated_by to the $set operator of update, or a new $set when it has none.
+func setUpdatedBy(update bson.D, actor interface{}) bson.D {
+	updatedBy := bson.E{Key: "updated_by", Value: actor}
+	stamped := make(bson.D, 0, len(update)+1)
+	found := false
+	for _, e := range update {
+		if e.Key == operator.Set {
+			values, ok := setValues(e.Value)
+			if !ok {
+				return update
+			}
+			for _, v := range values {
+				if v.Key == "updated_by" {
+					return update
+				}
+			}
+			e.Value = append(append([]bson.E{}, values...), updatedBy)
+			found = true
+		}
+		stamped = append(stamped, e)
+	}
+	if !found {
+		stamped = append(stamped, bson.E{Key: operator.Set, Value: []bson.E{updatedBy}})
+	}
+	return stamped
+}
+
+func setValues(value interface{}) ([]bson.E, bool) {
+	switch v := value.(type) {
+	case []bson.E:
+		return v, true
+	case bson.D:
+		return v, true
+	}
+	return nil, false
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+type AttributedUser struct {
+	document.Base        `bson:",inline"`
+	document.Attribution `bson:",inline"`
+	FirstName            string `bson:"first_name"`
+}
+
+func TestWithActor(t *testing.T) {
+	assert.Nil(t, ActorFromContext(nil))
+	assert.Nil(t, ActorFromContext(context.Background()))
+	assert.Equal(t, "joseph", ActorFromContext(WithActor(nil, "joseph")))
+}
+
+func TestClient_WithUpdatedBy(t *testing.T) {
+	c := disconnectedClient(t)
+	ctx := WithActor(nil, "joseph")
+	update := builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "level", Value: 2}).Get()
+
+	//Test Collections Are Not Attributed By Default
+	assert.Equal(t, update, c.withUpdatedBy(ctx, UserCollection, update))
+
+	c.SetAttributedCollections(UserCollection)
+	assert.Equal(t, update, c.withUpdatedBy(nil, UserCollection, update))
+	assert.Equal(t, update, c.withUpdatedBy(ctx, PetCollection, update))
+
+	stamped := c.withUpdatedBy(ctx, UserCollection, update)
+	assert.Equal(t, bson.D{bson.E{Key: operator.Set, Value: []bson.E{{Key: "level", Value: 2}, {Key: "updated_by", Value: "joseph"}}}}, stamped)
+	//Test The Original Update Is Not Modified
+	assert.Len(t, update[0].Value, 1)
+
+	stamped = c.withUpdatedBy(ctx, UserCollection, bson.D{bson.E{Key: operator.Mul, Value: []bson.E{{Key: "level", Value: 2}}}})
+	assert.Equal(t, bson.E{Key: operator.Set, Value: []bson.E{{Key: "updated_by", Value: "joseph"}}}, stamped[1])
+
+	//Test An updated_by Set By The Caller Is Kept
+	update = builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "updated_by", Value: "importer"}).Get()
+	assert.Equal(t, update, c.withUpdatedBy(ctx, UserCollection, update))
+}
+
+func TestClient_ActorStamping(t *testing.T) {
+	defer tearDown()
+	TestClient.SetAttributedCollections(UserCollection)
+	defer TestClient.SetAttributedCollections()
+
+	creator := WithActor(context.Background(), "creator")
+	editor := WithActor(context.Background(), "editor")
+
+	user := &AttributedUser{FirstName: "Joseph"}
+	user.Setup()
+	TestClient.SaveDocument(creator, UserCollection, user)
+	assert.Equal(t, "creator", user.CreatedBy)
+	assert.Equal(t, "creator", user.UpdatedBy)
+
+	TestClient.SaveDocument(editor, UserCollection, user)
+	assert.Equal(t, "creator", user.CreatedBy)
+	assert.Equal(t, "editor", user.UpdatedBy)
+
+	//Test Saving Without An Actor Keeps The Attribution
+	TestClient.SaveDocument(nil, UserCollection, user)
+	assert.Equal(t, "editor", user.UpdatedBy)
+
+	TestClient.SoftDeleteDocument(editor, UserCollection, user)
+	assert.Equal(t, "editor", user.DeletedBy)
+
+	stored := &AttributedUser{}
+	TestClient.FindOne(nil, UserCollection, queryfilter.NewWithDeleted().AddFilter(bson.E{Key: "_id", Value: user.ID}).GetFilters(), nil, stored)
+	assert.Equal(t, "creator", stored.CreatedBy)
+	assert.Equal(t, "editor", stored.DeletedBy)
+
+	TestClient.RestoreDocument(nil, UserCollection, user)
+	assert.Nil(t, user.DeletedBy)
+
+	ub := builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "first_name", Value: "Jo"})
+	filters := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: user.ID}).GetFilters()
+	_, err := TestClient.UpdateMany(WithActor(nil, "batch"), UserCollection, filters, ub, nil)
+	assert.Nil(t, err)
+
+	stored = &AttributedUser{}
+	TestClient.FindOneByID(nil, UserCollection, user.ID, nil, stored)
+	assert.Equal(t, "Jo", stored.FirstName)
+	assert.Equal(t, "batch", stored.UpdatedBy)
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/queryfilter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+var DefaultAuditCollection = "audit_log"
+
+// AuditOperation is the kind of write an AuditEntry records.
+type AuditOperation string
+
+const (
+	AuditCreate     AuditOperation = "create"
+	AuditUpdate     AuditOperation = "update"
+	AuditSoftDelete AuditOperation = "soft-delete"
+	AuditHardDelete AuditOperation = "hard-delete"
+	AuditRestore    AuditOperation = "restore"
+	AuditUpdateMany AuditOperation = "update-many"
+)
+
+type (
+	AuditOptions struct {
+		// Collection the audit entries are stored in. Defaults to DefaultAuditCollection.
+		Collection string
+	}
+
+	// FieldChange is a single field that differs between the stored document before and after a write.
+	// Field is the dotted bson path of the field. Before is nil for added fields and After is nil for removed fields.
+	FieldChange struct {
+		Field  string      `bson:"field"`
+		Before interface{} `bson:"before"`
+		After  interface{} `bson:"after"`
+	}
+
+	// AuditEntry records a single write made through the Client.
+	// Writes to many documents (UpdateMany) have no DocumentID or Changes and record the filters and update instead.
+	AuditEntry struct {
+		document.Base   `bson:",inline"`
+		document.Tenant `bson:",inline"`
+		Collection      string             `bson:"collection"`
+		DocumentID      primitive.ObjectID `bson:"document_id,omitempty"`
+		Operation       AuditOperation     `bson:"operation"`
+		Actor           interface{}        `bson:"actor,omitempty"`
+		Timestamp       time.Time          `bson:"timestamp"`
+		Changes         []FieldChange      `bson:"changes,omitempty"`
+		Filters         bson.D             `bson:"filters,omitempty"`
+		Update          bson.D             `bson:"update,omitempty"`
+	}
+)
+
+// EnableAudit makes the Client record an AuditEntry for every write it makes. The actor is taken from the context of
+// each call (see WithActor). Audit entries are written after the audited write succeeds; if recording the entry
+// fails, the error is returned but the write is not undone.
+func (c *Client) EnableAudit(auditOptions *AuditOptions) {
+	if auditOptions == nil {
+		auditOptions = &AuditOptions{}
+	}
+	if auditOptions.Collection == "" {
+		auditOptions.Collection = DefaultAuditCollection
+	}
+	c.audit = auditOptions
+}
+
+// DisableAudit stops recording audit entries.
+func (c *Client) DisableAudit() {
+	c.audit = nil
+}
+
+// DocumentHistory returns the audit entries recorded for a document, oldest first.
+func (c *Client) DocumentHistory(ctx context.Context, collection string, id primitive.ObjectID) ([]AuditEntry, error) {
+	auditCollection := DefaultAuditCollection
+	if c.audit != nil {
+		auditCollection = c.audit.Collection
+	}
+
+	filters := queryfilter.New().
+		AddFilter(bson.E{Key: "collection", Value: collection}).
+		AddFilter(bson.E{Key: "document_id", Value: id}).
+		GetFilters()
+	ctx = withoutPopulate(ctx)
+	cur, err := c.FindAll(ctx, auditCollection, filters, nil, bson.D{bson.E{Key: "timestamp", Value: 1}, bson.E{Key: "_id", Value: 1}})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	return entries, c.DecodeAll(ctx, cur, &entries)
+}
+
+// auditDocument records a write to a single document. before is the stored document before the write or nil if it
+// did not exist, after is the document as written or nil if it was removed.
+func (c *Client) auditDocument(ctx context.Context, operation AuditOperation, collection string, id primitive.ObjectID, before bson.Raw, after interface{}) error {
+	if c.audit == nil {
+		return nil
+	}
+
+	var afterRaw bson.Raw
+	if after != nil {
+		raw, err := bson.Marshal(after)
+		if err != nil {
+			return err
+		}
+		afterRaw = raw
+	}
+
+	entry := c.newAuditEntry(ctx, operation, collection)
+	entry.DocumentID = id
+	entry.Changes = diff(before, afterRaw)
+	return c.saveAuditEntry(ctx, entry)
+}
+
+// auditMany records a write made to every document matching filters.
+func (c *Client) auditMany(ctx context.Context, operation AuditOperation, collection string, filters []bson.E, update bson.D) error {
+	if c.audit == nil {
+		return nil
+	}
+
+	entry := c.newAuditEntry(ctx, operation, collection)
+	entry.Filters = bson.D(filters)
+	entry.Update = update
+	return c.saveAuditEntry(ctx, entry)
+}
+
+func (c *Client) saveAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	db, err := c.database(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection(c.audit.Collection).InsertOne(ctx, entry)
+	return err
+}
+
+func (c *Client) newAuditEntry(ctx context.Context, operation AuditOperation, collection string) *AuditEntry {
+	entry := &AuditEntry{
+		Collection: collection,
+		Operation:  operation,
+		Actor:      ActorFromContext(ctx),
+		Timestamp:  time.Now().UTC(),
+	}
+	entry.Setup()
+	entry.TenantID = c.sharedTenant(ctx)
+	return entry
+}
+
+// diff compares two raw documents field by field. Embedded documents are compared field by field while arrays and
+// other values are compared as a whole.
+func diff(before, after bson.Raw) []FieldChange {
+	beforeFields := map[string]bson.RawValue{}
+	afterFields := map[string]bson.RawValue{}
+	flatten("", before, beforeFields)
+	flatten("", after, afterFields)
+
+	var changes []FieldChange
+	for field, b := range beforeFields {
+		a, ok := afterFields[field]
+		if !ok {
+			changes = append(changes, FieldChange{Field: field, Before: rawInterface(b)})
+			continue
+		}
+		if b.Type != a.Type || !bytes.Equal(b.Value, a.Value) {
+			changes = append(changes, FieldChange{Field: field, Before: rawInterface(b), After: rawInterface(a)})
+		}
+	}
+	for field, a := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, After: rawInterface(a)})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func flatten(prefix string, doc bson.Raw, fields map[string]bson.RawValue) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return
+	}
+	for _, e := range elements {
+		value := e.Value()
+		if embedded, ok := value.DocumentOK(); ok {
+			flatten(prefix+e.Key()+".", embedded, fields)
+			continue
+		}
+		fields[prefix+e.Key()] = value
+	}
+}
+
+func rawInterface(v bson.RawValue) interface{} {
+	var value interface{}
+	if err := v.Unmarshal(&value); err != nil {
+		return v
+	}
+	return value
+}
+
+// marshalAudited returns doc as a raw document when the Client records audit entries.
+func (c *Client) marshalAudited(doc interface{}) bson.Raw {
+	if c.audit == nil {
+		return nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// preImage returns the document a FindOneAndReplace replaced or nil if it cannot be read.
+func preImage(result *mongo.SingleResult) bson.Raw {
+	if result == nil {
+		return nil
+	}
+	raw, err := result.DecodeBytes()
+	if err != nil {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before, _ := bson.Marshal(bson.D{
+		bson.E{Key: "name", Value: "Joseph"},
+		bson.E{Key: "level", Value: 1},
+		bson.E{Key: "address", Value: bson.D{bson.E{Key: "city", Value: "Lagos"}, bson.E{Key: "zip", Value: "100001"}}},
+		bson.E{Key: "tags", Value: bson.A{"a", "b"}},
+		bson.E{Key: "nickname", Value: "Joe"},
+	})
+	after, _ := bson.Marshal(bson.D{
+		bson.E{Key: "name", Value: "Joseph"},
+		bson.E{Key: "level", Value: 2},
+		bson.E{Key: "address", Value: bson.D{bson.E{Key: "city", Value: "Abuja"}, bson.E{Key: "zip", Value: "100001"}}},
+		bson.E{Key: "tags", Value: bson.A{"a", "b"}},
+		bson.E{Key: "email", Value: "joseph@example.com"},
+	})
+
+	changes := diff(before, after)
+	assert.Equal(t, []FieldChange{
+		{Field: "address.city", Before: "Lagos", After: "Abuja"},
+		{Field: "email", After: "joseph@example.com"},
+		{Field: "level", Before: int32(1), After: int32(2)},
+		{Field: "nickname", Before: "Joe"},
+	}, changes)
+
+	assert.Len(t, diff(nil, after), 6)
+	assert.Empty(t, diff(before, before))
+}
+
+func TestClient_Audit(t *testing.T) {
+	defer tearDown()
+	defer tearDownAudit()
+
+	TestClient.EnableAudit(nil)
+	defer TestClient.DisableAudit()
+
+	ctx := WithActor(context.Background(), "joseph")
+
+	user := &User{FirstName: "Joseph", Email: "joseph@example.com"}
+	user.Setup()
+	_, err := TestClient.SaveDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+
+	user.Level = 2
+	_, err = TestClient.SaveDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+
+	_, err = TestClient.SoftDeleteDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+
+	_, err = TestClient.RestoreDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+
+	_, err = TestClient.HardDeleteDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+
+	history, err := TestClient.DocumentHistory(nil, UserCollection, user.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 5) {
+		assert.Equal(t, AuditCreate, history[0].Operation)
+		assert.Equal(t, AuditUpdate, history[1].Operation)
+		assert.Equal(t, AuditSoftDelete, history[2].Operation)
+		assert.Equal(t, AuditRestore, history[3].Operation)
+		assert.Equal(t, AuditHardDelete, history[4].Operation)
+
+		for _, entry := range history {
+			assert.Equal(t, "joseph", entry.Actor)
+			assert.Equal(t, UserCollection, entry.Collection)
+		}
+
+		assert.Contains(t, history[1].Changes, FieldChange{Field: "level", Before: int32(0), After: int32(2)})
+		assert.Contains(t, history[2].Changes, FieldChange{Field: "is_deleted", Before: false, After: true})
+	}
+
+	//Test UpdateMany Records The Filters And Update
+	ub := builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "level", Value: 3})
+	filters := queryfilter.New().AddFilter(bson.E{Key: "first_name", Value: "Joseph"}).GetFilters()
+	_, err = TestClient.UpdateMany(ctx, UserCollection, filters, ub, nil)
+	assert.Nil(t, err)
+
+	count, _ := TestClient.CountDocuments(nil, DefaultAuditCollection, bson.D{bson.E{Key: "operation", Value: AuditUpdateMany}})
+	assert.Equal(t, 1, count)
+}
+
+func tearDownAudit() {
+	TestClient.Connection.Collection(DefaultAuditCollection).DeleteMany(nil, []bson.E{})
+}
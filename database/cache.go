@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+)
+
+type (
+	// Cache stores the documents read by FindOneByID and FindOneByField. Entries are tagged with their collection and
+	// document so writes can invalidate them. cache.LRU is an in-memory Cache.
+	// Implementations must be safe for concurrent use. Backends that fail should behave as if the key is missing.
+	Cache interface {
+		Get(ctx context.Context, key string) ([]byte, bool)
+		Set(ctx context.Context, key string, value []byte, tags []string)
+		// Invalidate removes the entries carrying any of tags.
+		Invalidate(ctx context.Context, tags ...string)
+	}
+
+	// cacheGenerations counts the invalidations of every cached collection so a document read before a write is not
+	// cached after the write invalidated its entries.
+	cacheGenerations struct {
+		m           sync.RWMutex
+		generations map[string]uint64
+	}
+)
+
+// EnableCache caches the documents read by FindOneByID and FindOneByField on collections, or on every collection when
+// none is given. Cached documents are still decoded, populated and passed to the PreFindOne and PostFindOne hooks.
+// SaveDocument, SoftDeleteDocument, RestoreDocument and HardDeleteDocument invalidate the entries of the document they
+// write, UpdateMany and delete policies the entries of the collections they write.
+// Calls made in a transaction skip the cache. Writes made outside of the Client are not seen until entries expire.
+func (c *Client) EnableCache(cache Cache, collections ...string) {
+	c.cache = cache
+	c.generations = &cacheGenerations{generations: map[string]uint64{}}
+	c.cachedCollections = nil
+	if len(collections) > 0 {
+		c.cachedCollections = map[string]bool{}
+		for _, collection := range collections {
+			c.cachedCollections[collection] = true
+		}
+	}
+}
+
+// DisableCache stops caching documents.
+func (c *Client) DisableCache() {
+	c.cache = nil
+	c.generations = nil
+	c.cachedCollections = nil
+}
+
+// cacheKey returns the key of a cached findOne on collection or "" if the call is not cached.
+func (c *Client) cacheKey(ctx context.Context, db *mongo.Database, collection string, filters []bson.E, projection interface{}) string {
+	if c.cache == nil || mongo.SessionFromContext(ctx) != nil {
+		return ""
+	}
+	if c.cachedCollections != nil && !c.cachedCollections[collection] {
+		return ""
+	}
+
+	query, err := bson.MarshalExtJSON(bson.D{
+		bson.E{Key: "filter", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+	}, true, false)
+	if err != nil {
+		return ""
+	}
+	return collectionTag(db, collection) + "/" + string(query)
+}
+
+// cachedDocument returns a copy of the document cached under key.
+func (c *Client) cachedDocument(ctx context.Context, key string) (bson.Raw, bool) {
+	if key == "" {
+		return nil, false
+	}
+	value, ok := c.cache.Get(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	return append(bson.Raw{}, value...), true
+}
+
+// cacheGeneration returns the generation of collection, taken before its documents are read.
+func (c *Client) cacheGeneration(db *mongo.Database, collection string) uint64 {
+	c.generations.m.RLock()
+	defer c.generations.m.RUnlock()
+	return c.generations.generations[collectionTag(db, collection)]
+}
+
+// cacheDocument caches a copy of raw under key, tagged with its collection and _id. Documents read without their
+// ObjectID _id are not cached as they could not be invalidated, nor are documents read before the last invalidation of
+// their collection - generation is no longer current.
+func (c *Client) cacheDocument(ctx context.Context, db *mongo.Database, collection, key string, raw bson.Raw, generation uint64) {
+	id, ok := raw.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return
+	}
+
+	c.generations.m.RLock()
+	defer c.generations.m.RUnlock()
+	if c.generations.generations[collectionTag(db, collection)] != generation {
+		return
+	}
+	c.cache.Set(ctx, key, append([]byte{}, raw...), []string{collectionTag(db, collection), documentTag(db, collection, id)})
+}
+
+// invalidate removes the cached entries carrying tag and moves collection to its next generation. Entries being cached
+// wait for it so none outlives the invalidation.
+func (c *Client) invalidate(ctx context.Context, db *mongo.Database, collection, tag string) {
+	c.generations.m.Lock()
+	defer c.generations.m.Unlock()
+	c.generations.generations[collectionTag(db, collection)]++
+	c.cache.Invalidate(ctx, tag)
+}
+
+// invalidateDocument removes the cached entries of the document id. It is called once the write ends, successful or
+// not, so documents read while it ran are not kept.
+func (c *Client) invalidateDocument(ctx context.Context, collection string, id primitive.ObjectID) {
+	if c.cache == nil {
+		return
+	}
+	if db, err := c.database(ctx); err == nil {
+		c.invalidate(ctx, db, collection, documentTag(db, collection, id))
+	}
+}
+
+// invalidateCollection removes the cached entries of collection.
+func (c *Client) invalidateCollection(ctx context.Context, collection string) {
+	if c.cache == nil {
+		return
+	}
+	if db, err := c.database(ctx); err == nil {
+		c.invalidate(ctx, db, collection, collectionTag(db, collection))
+	}
+}
+
+func collectionTag(db *mongo.Database, collection string) string {
+	return db.Name() + "." + collection
+}
+
+func documentTag(db *mongo.Database, collection string, id primitive.ObjectID) string {
+	return collectionTag(db, collection) + "/" + id.Hex()
+}
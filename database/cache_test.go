@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/cache"
+	"github.com/jcobhams/asari/operator"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+type recordingCache struct {
+	values      map[string][]byte
+	gets        []string
+	invalidated []string
+}
+
+func (r *recordingCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	r.gets = append(r.gets, key)
+	value, ok := r.values[key]
+	return value, ok
+}
+
+func (r *recordingCache) Set(ctx context.Context, key string, value []byte, tags []string) {
+	r.values[key] = value
+}
+
+func (r *recordingCache) Invalidate(ctx context.Context, tags ...string) {
+	r.invalidated = append(r.invalidated, tags...)
+}
+
+func TestClient_EnableCache(t *testing.T) {
+	recorder := &recordingCache{values: map[string][]byte{}}
+	c := disconnectedClient(t)
+	c.EnableCache(recorder, "users")
+
+	id := primitive.NewObjectID()
+	user := &User{}
+	assert.NotNil(t, c.FindOneByID(context.Background(), "users", id, nil, user))
+	if !assert.Len(t, recorder.gets, 1) {
+		return
+	}
+
+	//Test Cached Documents Are Read Without The Server
+	raw, _ := bson.Marshal(bson.M{"_id": id, "first_name": "Ada"})
+	recorder.values[recorder.gets[0]] = raw
+	assert.Nil(t, c.FindOneByID(context.Background(), "users", id, nil, user))
+	assert.Equal(t, "Ada", user.FirstName)
+	assert.Equal(t, id, user.GetID())
+
+	//Test Projections Are Cached Separately
+	c.FindOneByID(context.Background(), "users", id, bson.M{"email": 1}, user)
+	assert.NotEqual(t, recorder.gets[0], recorder.gets[2])
+
+	c.FindOneByField(context.Background(), "posts", "title", "Hello", nil, &User{})
+	c.FindOne(context.Background(), "users", nil, nil, &User{})
+	assert.Len(t, recorder.gets, 3)
+
+	update := builder.NewUpdateManyBuilder()
+	update.Add(operator.Set, bson.E{Key: "level", Value: 2})
+	c.UpdateMany(context.Background(), "users", nil, update, nil)
+	c.HardDeleteDocument(context.Background(), "users", user)
+	assert.Equal(t, []string{"main.users", "main.users/" + id.Hex()}, recorder.invalidated)
+
+	c.DisableCache()
+	c.FindOneByID(context.Background(), "users", id, nil, user)
+	assert.Len(t, recorder.gets, 3)
+}
+
+func TestClient_CacheGeneration(t *testing.T) {
+	recorder := &recordingCache{values: map[string][]byte{}}
+	c := disconnectedClient(t)
+	c.EnableCache(recorder)
+	db, _ := c.database(context.Background())
+
+	id := primitive.NewObjectID()
+	raw, _ := bson.Marshal(bson.M{"_id": id, "first_name": "Ada"})
+
+	//Test Documents Read Before An Invalidation Are Not Cached
+	generation := c.cacheGeneration(db, "users")
+	c.invalidateDocument(context.Background(), "users", id)
+	c.cacheDocument(context.Background(), db, "users", "stale", raw, generation)
+	assert.Empty(t, recorder.values)
+
+	generation = c.cacheGeneration(db, "users")
+	c.invalidateCollection(context.Background(), "posts")
+	c.cacheDocument(context.Background(), db, "users", "fresh", raw, generation)
+	assert.Contains(t, recorder.values, "fresh")
+}
+
+func TestClient_Cache(t *testing.T) {
+	lru := cache.NewLRU(100, time.Minute)
+	TestClient.EnableCache(lru, UserCollection)
+	defer TestClient.DisableCache()
+
+	user := &User{FirstName: "Joseph", Email: "joseph@asari.dev"}
+	user.Setup()
+	TestClient.SaveDocument(nil, UserCollection, user)
+
+	found := &User{}
+	assert.Nil(t, TestClient.FindOneByID(nil, UserCollection, user.GetID(), nil, found))
+	assert.Nil(t, TestClient.FindOneByField(nil, UserCollection, "email", user.Email, nil, found))
+	assert.Equal(t, 2, lru.Len())
+
+	user.FirstName = "Ada"
+	TestClient.SaveDocument(nil, UserCollection, user)
+	assert.Equal(t, 0, lru.Len())
+	assert.Nil(t, TestClient.FindOneByID(nil, UserCollection, user.GetID(), nil, found))
+	assert.Equal(t, "Ada", found.FirstName)
+
+	TestClient.SoftDeleteDocument(nil, UserCollection, user)
+	assert.Equal(t, ErrNotFound, TestClient.FindOneByID(nil, UserCollection, user.GetID(), nil, found))
+
+	tearDown()
+}
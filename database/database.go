@@ -3,10 +3,10 @@ package database
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/jcobhams/asari/builder"
 	"github.com/jcobhams/asari/document"
 	"github.com/jcobhams/asari/queryfilter"
+	"github.com/jcobhams/asari/validator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,7 +18,30 @@ import (
 )
 
 type Client struct {
-	Connection *mongo.Database
+	Connection    *mongo.Database
+	audit         *AuditOptions
+	tenancy       *TenancyOptions
+	resolver      DatabaseResolver
+	tracer        Tracer
+	metrics       Metrics
+	logger        Logger
+	logOptions    *LogOptions
+	slowQueries   *SlowQueryOptions
+	strictIndexes map[string]bool
+	defaults      *OperationOptions
+	retries       *RetryOptions
+	cache         Cache
+	generations   *cacheGenerations
+	// attributedCollections is replaced, never modified, like collectionDefaults.
+	attributedCollections map[string]bool
+	// cachedCollections lists the collections using the cache, nil when all do.
+	cachedCollections map[string]bool
+	// collectionDefaults is replaced, never modified, so calls in flight keep a consistent view.
+	collectionDefaults map[string]*OperationOptions
+}
+
+type schemaVersioned interface {
+	SetSchemaVersion(version int)
 }
 
 var (
@@ -27,7 +50,8 @@ var (
 
 func Init(mongoDSN, databaseName string, opts ...*options.ClientOptions) *Client {
 	opts = append(opts, options.Client().ApplyURI(mongoDSN))
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 	mClient, err := mongo.Connect(ctx, opts...)
 
 	if err != nil {
@@ -44,6 +68,16 @@ func Init(mongoDSN, databaseName string, opts ...*options.ClientOptions) *Client
 }
 
 func (c *Client) findOne(ctx context.Context, collection string, filters []bson.E, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+	return c.readOne(ctx, collection, filters, target, false, findOneOptions...)
+}
+
+// cachedFindOne is findOne reading through the Cache.
+func (c *Client) cachedFindOne(ctx context.Context, collection string, filters []bson.E, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+	return c.readOne(ctx, collection, filters, target, true, findOneOptions...)
+}
+
+// readOne decodes the first document matching filters into target. Cached calls read through the Cache.
+func (c *Client) readOne(ctx context.Context, collection string, filters []bson.E, target interface{}, cached bool, findOneOptions ...*options.FindOneOptions) error {
 	if err := c.validateDocumentKind(target); err != nil {
 		return err
 	}
@@ -53,18 +87,62 @@ func (c *Client) findOne(ctx context.Context, collection string, filters []bson.
 		return err
 	}
 
+	db, filters, err := c.scope(ctx, filters)
+	if err != nil {
+		return err
+	}
+
 	if preFindOne, ok := target.(document.PreFindOne); ok {
-		if err := preFindOne.PreFindOne(c.Connection); err != nil {
-			return errors.New(fmt.Sprintf("asari: PreOneUpdate Hook Error: %v", err))
+		if err := runHook(ctx, "PreFindOne", func() error { return preFindOne.PreFindOne(db) }); err != nil {
+			return err
 		}
 	}
 
-	err := c.Connection.Collection(collection).FindOne(ctx, filters, findOneOptions...).Decode(target)
+	findOneOptions = append([]*options.FindOneOptions{{MaxTime: c.operationOptions(ctx, collection).maxTime()}}, findOneOptions...)
+	merged := options.MergeFindOneOptions(findOneOptions...)
+	if merged.Projection != nil {
+		merged.Projection = versionedProjection(merged.Projection)
+		findOneOptions = append(findOneOptions, &options.FindOneOptions{Projection: merged.Projection})
+	}
+	if err := c.prepareQuery(ctx, db, filters, command("find", collection,
+		bson.E{Key: "filter", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: merged.Projection},
+		bson.E{Key: "sort", Value: merged.Sort},
+		bson.E{Key: "skip", Value: merged.Skip},
+		bson.E{Key: "limit", Value: 1},
+	)); err != nil {
+		return err
+	}
+
+	var key string
+	if cached {
+		key = c.cacheKey(ctx, db, collection, filters, merged.Projection)
+	}
+	raw, ok := c.cachedDocument(ctx, key)
+	if !ok {
+		var generation uint64
+		if key != "" {
+			generation = c.cacheGeneration(db, collection)
+		}
+		err = c.retry(ctx, func() (err error) {
+			raw, err = c.collection(ctx, db, collection).FindOne(ctx, filters, findOneOptions...).DecodeBytes()
+			return err
+		})
+		if err == nil && key != "" {
+			c.cacheDocument(ctx, db, collection, key, raw, generation)
+		}
+	}
+	if err == nil {
+		err = Decode(raw, target)
+	}
+	if err == nil {
+		err = c.populateContext(ctx, target)
+	}
 
 	if err == nil {
 		if postFindOne, ok := target.(document.PostFindOne); ok {
-			if err := postFindOne.PostFindOne(c.Connection); err != nil {
-				return errors.New(fmt.Sprintf("asari: PostOneUpdate Hook Error: %v", err))
+			if err := runHook(ctx, "PostFindOne", func() error { return postFindOne.PostFindOne(db) }); err != nil {
+				return err
 			}
 		}
 	}
@@ -76,7 +154,11 @@ func (c *Client) findOne(ctx context.Context, collection string, filters []bson.
 // If projection is nil, all fields are returned.
 // To specify only select fields, use a bson.M - eg: bson.M{"email":1, "phone":1}
 // Target has to be a pointer to a struct where the document will be unmarshalled into.
-func (c *Client) FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+// When ctx comes from WithPopulate, the named relations of target are populated.
+func (c *Client) FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) (err error) {
+	ctx, call := c.instrument(ctx, "FindOne", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateProjection(projection); err != nil {
 		return err
 	}
@@ -92,7 +174,11 @@ func (c *Client) FindOne(ctx context.Context, collection string, filters []bson.
 // If projection is nil, all fields are returned.
 // To specify only select fields, use a bson.M - eg: bson.M{"email":1, "phone":1}
 // Target has to be a pointer to a struct where the document will be unmarshalled into.
-func (c *Client) FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) error {
+// When ctx comes from WithPopulate, the named relations of target are populated.
+func (c *Client) FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) (err error) {
+	ctx, call := c.instrument(ctx, "FindOneByID", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateProjection(projection); err != nil {
 		return err
 	}
@@ -100,14 +186,18 @@ func (c *Client) FindOneByID(ctx context.Context, collection string, id primitiv
 	opts := &options.FindOneOptions{
 		Projection: projection,
 	}
-	return c.findOne(ctx, collection, filters, target, opts)
+	return c.cachedFindOne(ctx, collection, filters, target, opts)
 }
 
 // FindOneByField finds a document that matches the provided field and value pair.
 // If projection is nil, all fields are returned.
 // To specify only select fields, use a bson.M - eg: bson.M{"email":1, "phone":1}
 // Target has to be a pointer to a struct where the document will be unmarshalled into.
-func (c *Client) FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) error {
+// When ctx comes from WithPopulate, the named relations of target are populated.
+func (c *Client) FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) (err error) {
+	ctx, call := c.instrument(ctx, "FindOneByField", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateProjection(projection); err != nil {
 		return err
 	}
@@ -116,7 +206,7 @@ func (c *Client) FindOneByField(ctx context.Context, collection, field string, v
 	opts := &options.FindOneOptions{
 		Projection: projection,
 	}
-	return c.findOne(ctx, collection, filters, target, opts)
+	return c.cachedFindOne(ctx, collection, filters, target, opts)
 }
 
 // FindPaginated searches for document that matches the provided filters.
@@ -125,8 +215,12 @@ func (c *Client) FindOneByField(ctx context.Context, collection, field string, v
 // To specify only select fields, use a bson.M - eg: bson.M{"email":1, "phone":1}
 // sort should be a bson.D - eg: bson.D{bson.E{Key: "_id", Value: -1}, bson.E{Key: "another, Value: "value"}}
 // FindPaginated will return the Mongo Cursor in the PaginatedResult struct.
+// The cursor does not populate relations. Decode it with DecodeAll and a context from WithPopulate to populate them.
 // REMEMBER TO CALL Cursor.Close(ctx) WHEN DONE READING
-func (c *Client) FindPaginated(ctx context.Context, collection string, pageOptions PageOpts, filters []bson.E, projection interface{}, sort bson.D) (*PaginatedResult, error) {
+func (c *Client) FindPaginated(ctx context.Context, collection string, pageOptions PageOpts, filters []bson.E, projection interface{}, sort bson.D) (result *PaginatedResult, err error) {
+	ctx, call := c.instrument(ctx, "FindPaginated", collection)
+	defer func() { call.end(pageDocuments(result), err) }()
+
 	if sort == nil {
 		sort = bson.D{bson.E{Key: "_id", Value: -1}}
 	}
@@ -139,23 +233,47 @@ func (c *Client) FindPaginated(ctx context.Context, collection string, pageOptio
 	if err := c.validateProjection(projection); err != nil {
 		return nil, err
 	}
+	projection = versionedProjection(projection)
+
+	db, filters, err := c.scope(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
 
 	paginator := NewPaginator(pageOptions)
 	paginator.SetOffset()
+	maxTime := c.operationOptions(ctx, collection).maxTime()
 	opts := &options.FindOptions{
 		Projection: projection,
 		Skip:       &paginator.Offset,
 		Limit:      &paginator.PerPage,
 		Sort:       sort,
+		MaxTime:    maxTime,
 	}
 
-	totalRows, err := c.Connection.Collection(collection).CountDocuments(ctx, filters)
+	if err := c.prepareQuery(ctx, db, filters, command("find", collection,
+		bson.E{Key: "filter", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: sort},
+		bson.E{Key: "skip", Value: paginator.Offset},
+		bson.E{Key: "limit", Value: paginator.PerPage},
+	)); err != nil {
+		return nil, err
+	}
+
+	err = c.retry(ctx, func() (err error) {
+		paginator.TotalRows, err = c.collection(ctx, db, collection).CountDocuments(ctx, filters, &options.CountOptions{MaxTime: maxTime})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	paginator.TotalRows = totalRows
 
-	cur, err := c.Connection.Collection(collection).Find(ctx, filters, opts)
+	var cur *mongo.Cursor
+	err = c.retry(ctx, func() (err error) {
+		cur, err = c.collection(ctx, db, collection).Find(ctx, filters, opts)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +286,10 @@ func (c *Client) FindPaginated(ctx context.Context, collection string, pageOptio
 
 // FindLast returns the most recent document in the collection that matches the provided filters.
 // It sorts based on the mongo objectId
-func (c *Client) FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) error {
+func (c *Client) FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) (err error) {
+	ctx, call := c.instrument(ctx, "FindLast", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateDocumentKind(target); err != nil {
 		return err
 	}
@@ -177,22 +298,23 @@ func (c *Client) FindLast(ctx context.Context, collection string, filters []bson
 	if err != nil {
 		return err
 	}
+	defer cur.Close(ctx)
 
-	hasResults := false
-	for cur.Next(nil) {
-		cur.Decode(target)
-		hasResults = true
-	}
-
-	if hasResults {
-		return nil
+	if !cur.Next(ctx) {
+		if err := cur.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
 	}
-	return mongo.ErrNoDocuments
+	return Decode(cur.Current, target)
 }
 
 // FindLastN returns the N (limit) most recent documents in the collection that matches the provided filters.
 // It sorts based on provided mongo objectId
-func (c *Client) FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (*mongo.Cursor, error) {
+func (c *Client) FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (cur *mongo.Cursor, err error) {
+	ctx, call := c.instrument(ctx, "FindLastN", collection)
+	defer func() { call.end(-1, err) }()
+
 	return c.findLast(ctx, collection, limit, filters, projection)
 }
 
@@ -202,19 +324,43 @@ func (c *Client) findLast(ctx context.Context, collection string, limit int, fil
 	if err := c.validateProjection(projection); err != nil {
 		return nil, err
 	}
+	projection = versionedProjection(projection)
 
 	filters = c.applyIsDeletedFilter(filters)
 	if err := c.validateFilters(filters); err != nil {
 		return nil, err
 	}
 
+	db, filters, err := c.scope(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := &options.FindOptions{
 		Projection: projection,
 		Sort:       sort,
+		MaxTime:    c.operationOptions(ctx, collection).maxTime(),
 	}
 	opts.SetLimit(int64(limit))
 
-	return c.Connection.Collection(collection).Find(ctx, filters, opts)
+	if err := c.prepareQuery(ctx, db, filters, command("find", collection,
+		bson.E{Key: "filter", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: sort},
+		bson.E{Key: "limit", Value: int64(limit)},
+	)); err != nil {
+		return nil, err
+	}
+	return c.find(ctx, db, collection, filters, opts)
+}
+
+// find runs a find command, retrying it on transient errors.
+func (c *Client) find(ctx context.Context, db *mongo.Database, collection string, filters []bson.E, opts *options.FindOptions) (cur *mongo.Cursor, err error) {
+	err = c.retry(ctx, func() error {
+		cur, err = c.collection(ctx, db, collection).Find(ctx, filters, opts)
+		return err
+	})
+	return cur, err
 }
 
 func (c *Client) applyIsDeletedFilter(filters []bson.E) []bson.E {
@@ -232,7 +378,12 @@ func (c *Client) applyIsDeletedFilter(filters []bson.E) []bson.E {
 
 // FindAll - returns a list of all the document that match the filter or returns an error.
 // To be used with care as a lot of document could be returned and use up a lot of memory.
-func (c *Client) FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (*mongo.Cursor, error) {
+// Use NewIterator to decode and process the documents of the cursor one at a time or in batches.
+// The cursor does not populate relations. Decode it with DecodeAll and a context from WithPopulate to populate them.
+func (c *Client) FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (cur *mongo.Cursor, err error) {
+	ctx, call := c.instrument(ctx, "FindAll", collection)
+	defer func() { call.end(-1, err) }()
+
 	if sort == nil {
 		sort = bson.D{bson.E{Key: "_id", Value: -1}}
 	}
@@ -240,29 +391,70 @@ func (c *Client) FindAll(ctx context.Context, collection string, filters []bson.
 	if err := c.validateProjection(projection); err != nil {
 		return nil, err
 	}
+	projection = versionedProjection(projection)
 
 	filters = c.applyIsDeletedFilter(filters)
 	if err := c.validateFilters(filters); err != nil {
 		return nil, err
 	}
 
+	db, filters, err := c.scope(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := &options.FindOptions{
 		Projection: projection,
 		Sort:       sort,
+		MaxTime:    c.operationOptions(ctx, collection).maxTime(),
 	}
 
-	return c.Connection.Collection(collection).Find(ctx, filters, opts)
+	if err := c.prepareQuery(ctx, db, filters, command("find", collection,
+		bson.E{Key: "filter", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: sort},
+	)); err != nil {
+		return nil, err
+	}
+	return c.find(ctx, db, collection, filters, opts)
+}
+
+// Decode unmarshals a raw document into target. If target implements document.Upgrader, the stored document is
+// upgraded to the current schema version first. Use Decode with Cursor.Current to read upgraded documents from the
+// cursors returned by FindAll, FindLastN and FindPaginated, or NewIterator to have them decoded.
+func Decode(raw bson.Raw, target interface{}) error {
+	if upgrader, ok := target.(document.Upgrader); ok {
+		upgraded, err := document.Upgrade(raw, upgrader)
+		if err != nil {
+			return err
+		}
+		raw = upgraded
+	}
+	return bson.Unmarshal(raw, target)
 }
 
-func (c *Client) updateDocument(ctx context.Context, collection string, filters []bson.E, doc interface{}) (*mongo.SingleResult, error) {
+func (c *Client) updateDocument(ctx context.Context, operation, collection string, filters []bson.E, doc interface{}) (*mongo.SingleResult, error) {
 	if err := c.validateFilters(filters); err != nil {
 		return nil, err
 	}
 
+	db, filters, err := c.scope(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
 	doc.(document.Document).BeforeUpdate()
-	result := c.Connection.Collection(collection).FindOneAndReplace(ctx, filters, doc)
-	if result.Err() != nil {
-		return nil, errors.New(result.Err().Error())
+	setCommand(ctx, db, filters, command("findAndModify", collection,
+		bson.E{Key: "query", Value: bson.D(filters)},
+		bson.E{Key: "update", Value: doc},
+	))
+	var result *mongo.SingleResult
+	err = c.retry(ctx, func() error {
+		result = c.collection(ctx, db, collection).FindOneAndReplace(ctx, filters, doc, &options.FindOneAndReplaceOptions{MaxTime: c.operationOptions(ctx, collection).maxTime()})
+		return result.Err()
+	})
+	if err != nil {
+		return nil, writeError(operation, collection, err)
 	}
 	return result, nil
 }
@@ -272,49 +464,98 @@ func (c *Client) updateDocument(ctx context.Context, collection string, filters
 // if doc is new and implements the PostCreator interface, the PostCreate hook will fire or return appropriate error.
 // if doc is existing and implements the PreUpdater interface, the PreUpdate hook will fire or return appropriate error.
 // if doc is new and implements the PostUpdater interface, the PostUpdate hook will fire or return appropriate error.
-func (c *Client) SaveDocument(ctx context.Context, collection string, doc interface{}) (interface{}, error) {
+// Documents implementing document.Upgrader are saved with their current schema version.
+// Documents are validated against their asari struct tags after the Pre hooks run. See validator.Validate
+// Documents embedding document.Attribution are stamped with the actor of ctx (see WithActor) before the Pre hooks run.
+// Writes rejected by the server return a *WriteError. Unique index violations wrap a *DuplicateKeyError.
+// Updates to documents implementing document.HistoryKeeper store the replaced version as a Revision.
+func (c *Client) SaveDocument(ctx context.Context, collection string, doc interface{}) (saved interface{}, err error) {
+	ctx, call := c.instrument(ctx, "SaveDocument", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateDocumentKind(doc); err != nil {
 		return nil, err
 	}
 
 	if !doc.(document.Document).CanSave() {
-		return nil, errors.New("asari: cannot save new document. call document.Setup() before calling SaveDocument()")
+		return nil, ErrNotSetup
+	}
+
+	db, err := c.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.stampTenant(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	if upgrader, ok := doc.(document.Upgrader); ok {
+		if versioned, ok := doc.(schemaVersioned); ok {
+			versioned.SetSchemaVersion(document.CurrentSchemaVersion(upgrader))
+		}
 	}
 
 	if doc.(document.Document).IsNew() {
+		stampActor(ctx, doc, AuditCreate)
 
 		if preCreator, ok := doc.(document.PreCreator); ok {
-			if err := preCreator.PreCreate(c.Connection); err != nil {
-				return nil, errors.New(fmt.Sprintf("asari: PreCreate Hook Error: %v", err))
+			if err := runHook(ctx, "PreCreate", func() error { return preCreator.PreCreate(db) }); err != nil {
+				return nil, err
 			}
 		}
 
-		_, err := c.Connection.Collection(collection).InsertOne(ctx, doc)
+		if err := c.validate(ctx, db, doc); err != nil {
+			return nil, err
+		}
+
+		err := c.retryInsert(ctx, func() error {
+			_, err := c.collection(ctx, db, collection).InsertOne(ctx, doc)
+			return err
+		})
+		err = writeError("SaveDocument", collection, err)
 		if err == nil {
 			doc.(document.Document).SetIsNew(false)
 
+			if err := c.auditDocument(ctx, AuditCreate, collection, doc.(document.Document).GetID(), nil, doc); err != nil {
+				return doc, err
+			}
+
 			if postCreator, ok := doc.(document.PostCreator); ok {
-				if err := postCreator.PostCreate(c.Connection); err != nil {
-					return nil, errors.New(fmt.Sprintf("asari: PostCreate Hook Error: %v", err))
+				if err := runHook(ctx, "PostCreate", func() error { return postCreator.PostCreate(db) }); err != nil {
+					return nil, err
 				}
 			}
 		}
 		return doc, err
 	} else {
+		stampActor(ctx, doc, AuditUpdate)
 
 		if preUpdater, ok := doc.(document.PreUpdater); ok {
-			if err := preUpdater.PreUpdate(c.Connection); err != nil {
-				return nil, errors.New(fmt.Sprintf("asari: PreUpdate Hook Error: %v", err))
+			if err := runHook(ctx, "PreUpdate", func() error { return preUpdater.PreUpdate(db) }); err != nil {
+				return nil, err
 			}
 		}
 
+		if err := c.validate(ctx, db, doc); err != nil {
+			return nil, err
+		}
+
 		qf := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: doc.(document.Document).GetID()}).GetFilters()
-		_, err := c.updateDocument(ctx, collection, qf, doc)
+		result, err := c.updateDocument(ctx, "SaveDocument", collection, qf, doc)
+		c.invalidateDocument(ctx, collection, doc.(document.Document).GetID())
 
 		if err == nil {
+			if err := c.saveRevision(ctx, collection, doc, preImage(result)); err != nil {
+				return doc, err
+			}
+
+			if err := c.auditDocument(ctx, AuditUpdate, collection, doc.(document.Document).GetID(), preImage(result), doc); err != nil {
+				return doc, err
+			}
+
 			if postUpdater, ok := doc.(document.PostUpdater); ok {
-				if err := postUpdater.PostUpdate(c.Connection); err != nil {
-					return nil, errors.New(fmt.Sprintf("asari: PostUpdate Hook Error: %v", err))
+				if err := runHook(ctx, "PostUpdate", func() error { return postUpdater.PostUpdate(db) }); err != nil {
+					return nil, err
 				}
 			}
 		}
@@ -323,45 +564,239 @@ func (c *Client) SaveDocument(ctx context.Context, collection string, doc interf
 	}
 }
 
+// InsertDocuments inserts new docs in collection with a single unordered InsertMany. Every document is stamped,
+// passed to its PreCreate and PostCreate hooks, validated and audited as SaveDocument does.
+// Documents that fail are left out, or rejected by the server, without stopping the others. Their errors are returned
+// in a DocumentErrors. Documents that are not new fail with ErrNotNew.
+func (c *Client) InsertDocuments(ctx context.Context, collection string, docs []interface{}) (err error) {
+	var inserted int64
+	ctx, call := c.instrument(ctx, "InsertDocuments", collection)
+	defer func() { call.end(inserted, err) }()
+
+	db, err := c.database(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := DocumentErrors{}
+	var pending []interface{}
+	var indexes []int
+	for i, doc := range docs {
+		if err := c.prepareInsert(ctx, db, doc); err != nil {
+			failed[i] = err
+			continue
+		}
+		pending = append(pending, doc)
+		indexes = append(indexes, i)
+	}
+
+	if len(pending) > 0 {
+		rejected, err := c.insertMany(ctx, db, collection, pending)
+		for j, i := range indexes {
+			if err == nil {
+				err = rejected[j]
+			}
+			if err != nil {
+				failed[i] = err
+				continue
+			}
+
+			doc := docs[i]
+			doc.(document.Document).SetIsNew(false)
+			inserted++
+
+			if err := c.auditDocument(ctx, AuditCreate, collection, doc.(document.Document).GetID(), nil, doc); err != nil {
+				failed[i] = err
+				continue
+			}
+			if postCreator, ok := doc.(document.PostCreator); ok {
+				if err := runHook(ctx, "PostCreate", func() error { return postCreator.PostCreate(db) }); err != nil {
+					failed[i] = err
+				}
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// prepareInsert readies a new doc for InsertDocuments as SaveDocument does before inserting it.
+func (c *Client) prepareInsert(ctx context.Context, db *mongo.Database, doc interface{}) error {
+	if err := c.validateDocumentKind(doc); err != nil {
+		return err
+	}
+	if !doc.(document.Document).CanSave() {
+		return ErrNotSetup
+	}
+	if !doc.(document.Document).IsNew() {
+		return ErrNotNew
+	}
+	if err := c.stampTenant(ctx, doc); err != nil {
+		return err
+	}
+
+	if upgrader, ok := doc.(document.Upgrader); ok {
+		if versioned, ok := doc.(schemaVersioned); ok {
+			versioned.SetSchemaVersion(document.CurrentSchemaVersion(upgrader))
+		}
+	}
+	stampActor(ctx, doc, AuditCreate)
+
+	if preCreator, ok := doc.(document.PreCreator); ok {
+		if err := runHook(ctx, "PreCreate", func() error { return preCreator.PreCreate(db) }); err != nil {
+			return err
+		}
+	}
+	return c.validate(ctx, db, doc)
+}
+
+// insertMany inserts docs and returns the errors of the documents the server rejected by their index. Like
+// retryInsert, documents a retry finds already inserted were written by an earlier attempt whose reply was lost.
+func (c *Client) insertMany(ctx context.Context, db *mongo.Database, collection string, docs []interface{}) (map[int]error, error) {
+	attempts := 0
+	rejected := map[int]error{}
+	err := c.retry(ctx, func() error {
+		attempts++
+		_, err := c.collection(ctx, db, collection).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		var bulkWriteException mongo.BulkWriteException
+		if !errors.As(err, &bulkWriteException) || len(bulkWriteException.WriteErrors) == 0 {
+			return err
+		}
+
+		rejected = map[int]error{}
+		for _, we := range bulkWriteException.WriteErrors {
+			writeException := mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}}
+			var dke *DuplicateKeyError
+			if attempts > 1 && errors.As(duplicateKeyError(writeException), &dke) && dke.Index == "_id_" {
+				continue
+			}
+			rejected[we.Index] = writeError("InsertDocuments", collection, writeException)
+		}
+		return nil
+	})
+	return rejected, writeError("InsertDocuments", collection, err)
+}
+
 // UpdateMany finds the documents that match the filter and update them based on the operators configured in the UpdateManyBuilder
-func (c *Client) UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error) {
+// When ctx carries an actor (see WithActor), updated_by is set to it on the matched documents of collections listed with
+// SetAttributedCollections.
+func (c *Client) UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (result *mongo.UpdateResult, err error) {
+	ctx, call := c.instrument(ctx, "UpdateMany", collection)
+	defer func() { call.end(updatedDocuments(result), err) }()
+
 	if updateBuilder.HasValues() {
-		return c.Connection.Collection(collection).UpdateMany(ctx, filters, updateBuilder.Get(), updateOptions)
+		if err := c.validateFilters(filters); err != nil {
+			return nil, err
+		}
+		db, filters, err := c.scope(ctx, filters)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.checkUpdate(ctx, updateBuilder.Get()); err != nil {
+			return nil, err
+		}
+
+		if ignored := updateBuilder.IgnoredAdds(); ignored > 0 {
+			c.warn(ctx, "asari: UpdateManyBuilder.Add was called without fields", "collection", collection, "ignored", ignored)
+		}
+
+		update := c.withUpdatedBy(ctx, collection, updateBuilder.Get())
+		setCommand(ctx, db, filters, command("update", collection, bson.E{Key: "updates", Value: bson.A{bson.D{
+			bson.E{Key: "q", Value: bson.D(filters)},
+			bson.E{Key: "u", Value: update},
+			bson.E{Key: "multi", Value: true},
+		}}}))
+		result, err := c.collection(ctx, db, collection).UpdateMany(ctx, filters, update, updateOptions)
+		c.invalidateCollection(ctx, collection)
+		if err != nil {
+			return result, writeError("UpdateMany", collection, err)
+		}
+		return result, c.auditMany(ctx, AuditUpdateMany, collection, filters, update)
 	}
-	return nil, errors.New("empty UpdateManyBuilder provided")
+	return nil, ErrEmptyUpdate
 }
 
 // CountDocuments returns a count of all the documents that match the provided filters or error otherwise
-func (c *Client) CountDocuments(ctx context.Context, collection string, filters interface{}) (int, error) {
-	count, err := c.Connection.Collection(collection).CountDocuments(ctx, filters)
-	return int(count), err
+func (c *Client) CountDocuments(ctx context.Context, collection string, filters interface{}) (count int, err error) {
+	ctx, call := c.instrument(ctx, "CountDocuments", collection)
+	defer func() { call.end(int64(count), err) }()
+
+	db, err := c.database(ctx)
+	if err != nil {
+		return 0, err
+	}
+	filters, err = c.scopeAnyFilters(ctx, filters)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.prepareQuery(ctx, db, filters, command("count", collection, bson.E{Key: "query", Value: filters})); err != nil {
+		return 0, err
+	}
+	var total int64
+	err = c.retry(ctx, func() (err error) {
+		total, err = c.collection(ctx, db, collection).CountDocuments(ctx, filters, &options.CountOptions{MaxTime: c.operationOptions(ctx, collection).maxTime()})
+		return err
+	})
+	return int(total), err
 }
 
 // SoftDeleteDocument marks a document as deleted and sets the deleted timestamp. This does not remove the item from the
 // DB but it hides it from future queries except deleted records is added to the filters
-func (c *Client) SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+// If doc implements document.HasDependents, the declared delete policies are applied in the same transaction and a
+// *RestrictError is returned while restricted dependents are live.
+// Documents embedding document.Attribution record the actor of ctx as DeletedBy.
+func (c *Client) SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (result *mongo.SingleResult, err error) {
+	ctx, call := c.instrument(ctx, "SoftDeleteDocument", collection)
+	defer func() { call.end(1, err) }()
+
 	if err := c.validateDocumentKind(doc); err != nil {
 		return nil, err
 	}
 
+	db, err := c.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.stampTenant(ctx, doc); err != nil {
+		return nil, err
+	}
+
 	d := doc.(document.Document)
 	d.BeforeSoftDelete()
+	stampActor(ctx, doc, AuditSoftDelete)
 	id := d.GetID()
 
 	qf := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: id}).GetFilters()
 
 	if preSoftDeleter, ok := doc.(document.PreSoftDeleter); ok {
-		if err := preSoftDeleter.PreSoftDelete(c.Connection); err != nil {
-			return nil, errors.New(fmt.Sprintf("asari: PreSoftDeleter Hook Error: %v", err))
+		if err := runHook(ctx, "PreSoftDelete", func() error { return preSoftDeleter.PreSoftDelete(db) }); err != nil {
+			return nil, err
 		}
 	}
 
-	result, err := c.updateDocument(ctx, collection, qf, doc)
+	deletedAt := time.Now().UTC()
+	if restorable, ok := doc.(document.Restorable); ok {
+		deletedAt = restorable.GetDeletedAt()
+	}
+
+	err = c.withDependents(ctx, doc, softDelete, deletedAt, func(ctx context.Context) error {
+		var err error
+		result, err = c.updateDocument(ctx, "SoftDeleteDocument", collection, qf, doc)
+		if err != nil {
+			return err
+		}
+		return c.auditDocument(ctx, AuditSoftDelete, collection, id, preImage(result), doc)
+	})
+	c.invalidateDocument(ctx, collection, id)
 
 	if err == nil {
 		if postSoftDeleter, ok := doc.(document.PostSoftDeleter); ok {
-			if err := postSoftDeleter.PostSoftDelete(c.Connection); err != nil {
-				return nil, errors.New(fmt.Sprintf("asari: PostSoftDeleter Hook Error: %v", err))
+			if err := runHook(ctx, "PostSoftDelete", func() error { return postSoftDeleter.PostSoftDelete(db) }); err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -371,40 +806,132 @@ func (c *Client) SoftDeleteDocument(ctx context.Context, collection string, doc
 
 // HardDeleteDocument deletes a record from the DB. Careful with this as the document is irrecoverable.
 // Use SoftDeleteDocument() instead except you want the document truly gone.
-func (c *Client) HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.DeleteResult, error) {
+// If doc implements document.HasDependents, the declared delete policies are applied in the same transaction and a
+// *RestrictError is returned while restricted dependents, live or soft deleted, reference it.
+func (c *Client) HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (result *mongo.DeleteResult, err error) {
+	ctx, call := c.instrument(ctx, "HardDeleteDocument", collection)
+	defer func() { call.end(deletedDocuments(result), err) }()
+
 	if err := c.validateDocumentKind(doc); err != nil {
 		return nil, err
 	}
 
+	if err := c.stampTenant(ctx, doc); err != nil {
+		return nil, err
+	}
+
 	qf := queryfilter.New().
 		AddFilter(bson.E{Key: "_id", Value: doc.(document.Document).GetID()}).
 		GetFilters()
+	db, qf, err := c.scope(ctx, qf)
+	if err != nil {
+		return nil, err
+	}
 
 	if preHardDeleter, ok := doc.(document.PreHardDeleter); ok {
-		if err := preHardDeleter.PreHardDelete(c.Connection); err != nil {
-			return nil, errors.New(fmt.Sprintf("asari: PreHardDeleter Hook Error: %v", err))
+		if err := runHook(ctx, "PreHardDelete", func() error { return preHardDeleter.PreHardDelete(db) }); err != nil {
+			return nil, err
 		}
 	}
 
-	result, err := c.Connection.Collection(collection).DeleteOne(ctx, qf)
+	setCommand(ctx, db, qf, command("delete", collection, bson.E{Key: "deletes", Value: bson.A{bson.D{
+		bson.E{Key: "q", Value: bson.D(qf)},
+		bson.E{Key: "limit", Value: 1},
+	}}}))
+	err = c.withDependents(ctx, doc, hardDelete, time.Time{}, func(ctx context.Context) error {
+		result, err = c.retryDelete(ctx, func() (*mongo.DeleteResult, error) {
+			return c.collection(ctx, db, collection).DeleteOne(ctx, qf)
+		})
+		if err != nil {
+			return writeError("HardDeleteDocument", collection, err)
+		}
+		if result.DeletedCount == 0 {
+			return nil
+		}
+		return c.auditDocument(ctx, AuditHardDelete, collection, doc.(document.Document).GetID(), c.marshalAudited(doc), nil)
+	})
+	c.invalidateDocument(ctx, collection, doc.(document.Document).GetID())
 
 	if err == nil {
 		if postHardDeleter, ok := doc.(document.PostHardDeleter); ok {
-			if err := postHardDeleter.PostHardDelete(c.Connection); err != nil {
-				return nil, errors.New(fmt.Sprintf("asari: PostHardDeleter Hook Error: %v", err))
+			if err := runHook(ctx, "PostHardDelete", func() error { return postHardDeleter.PostHardDelete(db) }); err != nil {
+				return nil, err
 			}
 		}
 	}
 	return result, err
 }
 
+// RestoreDocument reverses SoftDeleteDocument. doc must implement document.Restorable. Dependents with the Cascade policy that were soft deleted along with
+// the document are restored with it.
+func (c *Client) RestoreDocument(ctx context.Context, collection string, doc interface{}) (result *mongo.SingleResult, err error) {
+	ctx, call := c.instrument(ctx, "RestoreDocument", collection)
+	defer func() { call.end(1, err) }()
+
+	if err := c.validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	if err := c.stampTenant(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	d := doc.(document.Document)
+	restorable, ok := d.(document.Restorable)
+	if !ok {
+		return nil, ErrNotRestorable
+	}
+	deletedAt := restorable.GetDeletedAt()
+	restorable.BeforeRestore()
+	stampActor(ctx, doc, AuditRestore)
+
+	qf := queryfilter.NewWithDeleted().AddFilter(bson.E{Key: "_id", Value: d.GetID()}).GetFilters()
+
+	err = c.withDependents(ctx, doc, restore, deletedAt, func(ctx context.Context) error {
+		var err error
+		result, err = c.updateDocument(ctx, "RestoreDocument", collection, qf, doc)
+		if err != nil {
+			return err
+		}
+		return c.auditDocument(ctx, AuditRestore, collection, d.GetID(), preImage(result), doc)
+	})
+	c.invalidateDocument(ctx, collection, d.GetID())
+	return result, err
+}
+
 func (c *Client) aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error) {
-	return c.Connection.Collection(collection).Aggregate(ctx, pipeline, aggregateOptions)
+	db, err := c.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err = c.scopePipeline(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.prepareQuery(ctx, db, pipeline, command("aggregate", collection,
+		bson.E{Key: "pipeline", Value: pipeline},
+		bson.E{Key: "cursor", Value: bson.D{}},
+	)); err != nil {
+		return nil, err
+	}
+	aggregateOptions = options.MergeAggregateOptions(&options.AggregateOptions{MaxTime: c.operationOptions(ctx, collection).maxTime()}, aggregateOptions)
+	if !retryablePipeline(pipeline) {
+		return c.collection(ctx, db, collection).Aggregate(ctx, pipeline, aggregateOptions)
+	}
+
+	var cur *mongo.Cursor
+	err = c.retry(ctx, func() (err error) {
+		cur, err = c.collection(ctx, db, collection).Aggregate(ctx, pipeline, aggregateOptions)
+		return err
+	})
+	return cur, err
 }
 
 // Aggregate runs a simple aggregation pipeline and returns a cursor if successful or error if any.
 // If no aggregation options are provided, allowDiskUse is set to true by default.
-func (c *Client) Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error) {
+func (c *Client) Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (cur *mongo.Cursor, err error) {
+	ctx, call := c.instrument(ctx, "Aggregate", collection)
+	defer func() { call.end(-1, err) }()
 
 	if aggregateOptions == nil {
 		aggregateOptions = &options.AggregateOptions{}
@@ -415,8 +942,8 @@ func (c *Client) Aggregate(ctx context.Context, collection string, pipeline mong
 }
 
 func (c *Client) validateDocumentKind(obj interface{}) error {
-	if reflect.TypeOf(obj).Kind() != reflect.Ptr {
-		return errors.New("asari: doc must be a pointer to a document")
+	if obj == nil || reflect.TypeOf(obj).Kind() != reflect.Ptr {
+		return ErrNotPointer
 	}
 	return nil
 }
@@ -424,16 +951,74 @@ func (c *Client) validateDocumentKind(obj interface{}) error {
 func (c *Client) validateProjection(projection interface{}) error {
 	if projection != nil {
 		if _, ok := projection.(bson.M); !ok {
-			return errors.New("asari: projections can only be bson.M types")
+			return ErrInvalidProjection
 		}
 	}
 	return nil
 }
 
+// validate validates doc with the ref rules of tenants sharing collections scoped to the tenant of ctx.
+func (c *Client) validate(ctx context.Context, db *mongo.Database, doc interface{}) error {
+	if tenant := c.sharedTenant(ctx); tenant != "" {
+		ctx = validator.WithReferenceFilters(ctx, bson.E{Key: document.TenantField, Value: tenant})
+	}
+	return validator.Validate(ctx, db, doc)
+}
+
+// versionedProjection adds the schema version to an inclusion projection so the documents it reads are not upgraded
+// again when decoded. Other projections are returned unchanged.
+func versionedProjection(projection interface{}) interface{} {
+	fields, ok := projection.(bson.M)
+	if !ok || !isInclusion(fields) {
+		return projection
+	}
+	if _, ok := fields[document.SchemaVersionField]; ok {
+		return projection
+	}
+
+	versioned := bson.M{document.SchemaVersionField: 1}
+	for k, v := range fields {
+		versioned[k] = v
+	}
+	return versioned
+}
+
+// isInclusion reports whether projection includes fields other than _id.
+func isInclusion(projection bson.M) bool {
+	for k, v := range projection {
+		if k == "_id" {
+			continue
+		}
+		switch value := v.(type) {
+		case bool:
+			if value {
+				return true
+			}
+		case int:
+			if value != 0 {
+				return true
+			}
+		case int32:
+			if value != 0 {
+				return true
+			}
+		case int64:
+			if value != 0 {
+				return true
+			}
+		case float64:
+			if value != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *Client) validateFilters(filters []bson.E) error {
 	for _, f := range filters {
 		if f.Key == "" {
-			return errors.New("asari: document field names in filters cannot be empty. Key required")
+			return ErrEmptyFilterKey
 		}
 	}
 	return nil
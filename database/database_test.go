@@ -1,12 +1,15 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"github.com/jcobhams/asari/builder"
 	"github.com/jcobhams/asari/document"
 	"github.com/jcobhams/asari/operator"
 	"github.com/jcobhams/asari/queryfilter"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"os"
@@ -382,6 +385,114 @@ func TestClient_SaveDocument(t *testing.T) {
 	tearDown()
 }
 
+type ValidatedUser struct {
+	document.Base `bson:",inline"`
+	Email         string             `bson:"email" asari:"required,email"`
+	ReferrerID    primitive.ObjectID `bson:"referrer_id" asari:"ref=users"`
+}
+
+func TestClient_SaveDocument_Validation(t *testing.T) {
+	user := &ValidatedUser{Email: "asari"}
+	user.Setup()
+
+	_, err := TestClient.SaveDocument(nil, UserCollection, user)
+	var ve *ValidationError
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Equal(t, "email", ve.Errors[0].Path)
+	}
+
+	//Test References Must Exist
+	user.Email = "asari@gmail.com"
+	user.ReferrerID = primitive.NewObjectID()
+	_, err = TestClient.SaveDocument(nil, UserCollection, user)
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Equal(t, "referrer_id", ve.Errors[0].Path)
+	}
+
+	referrer := &ValidatedUser{Email: "referrer@gmail.com"}
+	referrer.Setup()
+	_, err = TestClient.SaveDocument(nil, UserCollection, referrer)
+	assert.Nil(t, err)
+
+	user.ReferrerID = referrer.ID
+	_, err = TestClient.SaveDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+
+	tearDown()
+}
+
+type VersionedUser struct {
+	document.Base `bson:",inline"`
+	FullName      string `bson:"full_name"`
+}
+
+func (u *VersionedUser) SchemaUpgrades() []document.UpgradeFunc {
+	return []document.UpgradeFunc{
+		func(doc bson.M) error {
+			doc["full_name"] = fmt.Sprintf("%v %v", doc["first_name"], doc["last_name"])
+			return nil
+		},
+	}
+}
+
+func TestClient_SchemaUpgrades(t *testing.T) {
+	user := &User{FirstName: "Joseph", LastName: "Cobhams"}
+	user.Setup()
+	TestClient.Connection.Collection(UserCollection).InsertOne(nil, user)
+
+	//Test Documents Are Upgraded On Read
+	var u VersionedUser
+	err := TestClient.FindOneByID(nil, UserCollection, user.ID, nil, &u)
+	assert.Nil(t, err)
+	assert.Equal(t, "Joseph Cobhams", u.FullName)
+	assert.Equal(t, 1, u.SchemaVersion)
+
+	cur, _ := TestClient.FindAll(nil, UserCollection, queryfilter.New().GetFilters(), nil, nil)
+	for cur.Next(nil) {
+		var cu VersionedUser
+		assert.Nil(t, Decode(cur.Current, &cu))
+		assert.Equal(t, "Joseph Cobhams", cu.FullName)
+	}
+	cur.Close(nil)
+
+	//Test The New Version Is Persisted On Save
+	_, err = TestClient.SaveDocument(nil, UserCollection, &u)
+	assert.Nil(t, err)
+
+	raw, _ := TestClient.Connection.Collection(UserCollection).FindOne(nil, bson.M{"_id": user.ID}).DecodeBytes()
+	assert.Equal(t, int32(1), raw.Lookup(document.SchemaVersionField).Int32())
+	assert.Equal(t, "Joseph Cobhams", raw.Lookup("full_name").StringValue())
+
+	//Test Projected Reads Of Current Documents Are Not Upgraded Again
+	var projected VersionedUser
+	err = TestClient.FindOneByID(nil, UserCollection, user.ID, bson.M{"full_name": 1}, &projected)
+	assert.Nil(t, err)
+	assert.Equal(t, "Joseph Cobhams", projected.FullName)
+	assert.Equal(t, 1, projected.SchemaVersion)
+
+	cur, _ = TestClient.FindAll(nil, UserCollection, queryfilter.New().GetFilters(), bson.M{"full_name": 1}, nil)
+	for cur.Next(nil) {
+		var cu VersionedUser
+		assert.Nil(t, Decode(cur.Current, &cu))
+		assert.Equal(t, "Joseph Cobhams", cu.FullName)
+	}
+	cur.Close(nil)
+
+	tearDown()
+}
+
+func TestVersionedProjection(t *testing.T) {
+	assert.Equal(t, bson.M{"email": 1, document.SchemaVersionField: 1}, versionedProjection(bson.M{"email": 1}))
+	assert.Equal(t, bson.M{"email": 0}, versionedProjection(bson.M{"email": 0}))
+	assert.Equal(t, bson.M{"_id": 1}, versionedProjection(bson.M{"_id": 1}))
+	assert.Equal(t, bson.M{"tags": bson.M{"$slice": 1}}, versionedProjection(bson.M{"tags": bson.M{"$slice": 1}}))
+	assert.Nil(t, versionedProjection(nil))
+
+	projection := bson.M{"email": true}
+	versionedProjection(projection)
+	assert.Len(t, projection, 1)
+}
+
 func TestClient_SoftDeleteDocument(t *testing.T) {
 	user := &User{
 		FirstName: "Joseph",
@@ -463,6 +574,41 @@ func TestClient_HardDeleteDocument(t *testing.T) {
 	tearDown()
 }
 
+func TestClient_InsertDocuments(t *testing.T) {
+	ada := &User{FirstName: "Ada", Level: 1}
+	ada.Setup()
+	grace := &User{FirstName: "Grace", Level: 2}
+	grace.Setup()
+	joseph := &User{FirstName: "Joseph", Level: 3}
+
+	//Test Failed Documents Do Not Stop The Others
+	err := TestClient.InsertDocuments(nil, UserCollection, []interface{}{ada, joseph, grace})
+	var failed DocumentErrors
+	if assert.True(t, errors.As(err, &failed)) {
+		assert.Equal(t, DocumentErrors{1: ErrNotSetup}, failed)
+	}
+	assert.False(t, ada.IsNew())
+	assert.False(t, grace.IsNew())
+
+	count, _ := TestClient.CountDocuments(nil, UserCollection, queryfilter.New().GetFilters())
+	assert.Equal(t, 2, count)
+
+	//Test Documents Rejected By The Server
+	copied := &User{FirstName: "Ada"}
+	copied.Setup()
+	copied.ID = ada.ID
+	joseph.Setup()
+	err = TestClient.InsertDocuments(nil, UserCollection, []interface{}{copied, ada, joseph})
+	if assert.True(t, errors.As(err, &failed)) && assert.Len(t, failed, 2) {
+		assert.True(t, errors.Is(failed[0], ErrDuplicateKey))
+		assert.Equal(t, ErrNotNew, failed[1])
+	}
+	assert.False(t, joseph.IsNew())
+	assert.True(t, copied.IsNew())
+
+	tearDown()
+}
+
 func TestClient_UpdateMany(t *testing.T) {
 	user1 := &User{
 		FirstName: "Joseph",
@@ -498,6 +644,10 @@ func TestClient_UpdateMany(t *testing.T) {
 	count, _ := TestClient.CountDocuments(nil, UserCollection, queryfilter.New().AddFilter(bson.E{Key: "last_name", Value: "dahryl"}).GetFilters())
 	assert.Equal(t, 2, count)
 
+	//Test Empty Filter Keys Are Rejected
+	_, err = TestClient.UpdateMany(nil, UserCollection, []bson.E{{Key: "", Value: "Dahryl"}}, ub, nil)
+	assert.Equal(t, ErrEmptyFilterKey, err)
+
 	tearDown()
 }
 
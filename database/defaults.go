@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"time"
+)
+
+type (
+	// OperationOptions are defaults applied to Client calls. Unset fields fall back to the collection defaults, then to
+	// the Client defaults, then to the settings of the connection.
+	OperationOptions struct {
+		// MaxTime limits how long a call may run. Finds, counts, aggregations and replacements send it to the server as
+		// maxTimeMS, and calls whose context has no deadline are given one.
+		MaxTime time.Duration
+		// ReadPreference selects the servers reads are sent to - eg: readpref.SecondaryPreferred() for reporting.
+		ReadPreference *readpref.ReadPref
+		ReadConcern    *readconcern.ReadConcern
+		WriteConcern   *writeconcern.WriteConcern
+	}
+
+	operationOptionsKey struct{}
+)
+
+// SetDefaults sets the OperationOptions of every call. A nil defaults removes them.
+func (c *Client) SetDefaults(defaults *OperationOptions) {
+	c.defaults = defaults
+}
+
+// SetCollectionDefaults sets the OperationOptions of calls on collection, overriding the Client defaults field by
+// field. A nil defaults removes them.
+func (c *Client) SetCollectionDefaults(collection string, defaults *OperationOptions) {
+	collections := map[string]*OperationOptions{}
+	for name, d := range c.collectionDefaults {
+		collections[name] = d
+	}
+	if defaults == nil {
+		delete(collections, collection)
+	} else {
+		collections[collection] = defaults
+	}
+	c.collectionDefaults = collections
+}
+
+// WithOperationOptions returns a copy of ctx overriding the Client and collection defaults for the calls made with it.
+func WithOperationOptions(ctx context.Context, operationOptions *OperationOptions) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, operationOptionsKey{}, operationOptions)
+}
+
+// OperationOptionsFromContext returns the OperationOptions set with WithOperationOptions or nil.
+func OperationOptionsFromContext(ctx context.Context) *OperationOptions {
+	if ctx == nil {
+		return nil
+	}
+	operationOptions, _ := ctx.Value(operationOptionsKey{}).(*OperationOptions)
+	return operationOptions
+}
+
+// operationOptions returns the options of a call on collection, merging the context, collection and Client options.
+func (c *Client) operationOptions(ctx context.Context, collection string) OperationOptions {
+	var merged OperationOptions
+	merged.merge(c.defaults)
+	merged.merge(c.collectionDefaults[collection])
+	merged.merge(OperationOptionsFromContext(ctx))
+	return merged
+}
+
+func (o *OperationOptions) merge(override *OperationOptions) {
+	if override == nil {
+		return
+	}
+	if override.MaxTime > 0 {
+		o.MaxTime = override.MaxTime
+	}
+	if override.ReadPreference != nil {
+		o.ReadPreference = override.ReadPreference
+	}
+	if override.ReadConcern != nil {
+		o.ReadConcern = override.ReadConcern
+	}
+	if override.WriteConcern != nil {
+		o.WriteConcern = override.WriteConcern
+	}
+}
+
+// maxTime returns MaxTime for driver options or nil if it is not set.
+func (o OperationOptions) maxTime() *time.Duration {
+	if o.MaxTime <= 0 {
+		return nil
+	}
+	maxTime := o.MaxTime
+	return &maxTime
+}
+
+func (o OperationOptions) collectionOptions() *options.CollectionOptions {
+	return &options.CollectionOptions{
+		ReadPreference: o.ReadPreference,
+		ReadConcern:    o.ReadConcern,
+		WriteConcern:   o.WriteConcern,
+	}
+}
+
+// collection returns the collection of db with the read preference, read concern and write concern of the call.
+func (c *Client) collection(ctx context.Context, db *mongo.Database, collection string) *mongo.Collection {
+	return db.Collection(collection, c.operationOptions(ctx, collection).collectionOptions())
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"testing"
+	"time"
+)
+
+type deadlineTracer struct {
+	deadlines []time.Duration
+}
+
+func (t *deadlineTracer) Start(ctx context.Context, op Operation) (context.Context, Span) {
+	var remaining time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining = time.Until(deadline)
+	}
+	t.deadlines = append(t.deadlines, remaining)
+	return ctx, noopSpan{}
+}
+
+func TestClient_OperationOptions(t *testing.T) {
+	c := &Client{}
+	assert.Equal(t, OperationOptions{}, c.operationOptions(nil, "users"))
+
+	c.SetDefaults(&OperationOptions{
+		MaxTime:      5 * time.Second,
+		ReadConcern:  readconcern.Majority(),
+		WriteConcern: writeconcern.New(writeconcern.WMajority()),
+	})
+	c.SetCollectionDefaults("reports", &OperationOptions{
+		MaxTime:        time.Minute,
+		ReadPreference: readpref.SecondaryPreferred(),
+	})
+
+	users := c.operationOptions(context.Background(), "users")
+	assert.Equal(t, 5*time.Second, users.MaxTime)
+	assert.Nil(t, users.ReadPreference)
+	assert.Equal(t, readconcern.Majority(), users.ReadConcern)
+
+	reports := c.operationOptions(context.Background(), "reports")
+	assert.Equal(t, time.Minute, reports.MaxTime)
+	assert.Equal(t, readpref.SecondaryPreferred(), reports.ReadPreference)
+	assert.Equal(t, readconcern.Majority(), reports.ReadConcern)
+	assert.NotNil(t, reports.WriteConcern)
+
+	//Test Context Options Override Collection Defaults
+	ctx := WithOperationOptions(context.Background(), &OperationOptions{ReadPreference: readpref.Primary()})
+	reports = c.operationOptions(ctx, "reports")
+	assert.Equal(t, time.Minute, reports.MaxTime)
+	assert.Equal(t, readpref.Primary(), reports.ReadPreference)
+
+	c.SetCollectionDefaults("reports", nil)
+	assert.Equal(t, users, c.operationOptions(context.Background(), "reports"))
+	c.SetDefaults(nil)
+	assert.Equal(t, OperationOptions{}, c.operationOptions(context.Background(), "reports"))
+	assert.Nil(t, OperationOptionsFromContext(nil))
+}
+
+func TestClient_MaxTimeDeadline(t *testing.T) {
+	tracer := &deadlineTracer{}
+	c := disconnectedClient(t)
+	c.SetTracer(tracer)
+	c.SetDefaults(&OperationOptions{MaxTime: time.Minute})
+
+	c.CountDocuments(context.Background(), "users", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	c.CountDocuments(ctx, "users", nil)
+
+	c.SetDefaults(nil)
+	c.CountDocuments(context.Background(), "users", nil)
+
+	if assert.Len(t, tracer.deadlines, 3) {
+		assert.True(t, tracer.deadlines[0] > 0 && tracer.deadlines[0] <= time.Minute)
+		assert.True(t, tracer.deadlines[1] > time.Minute)
+		assert.Equal(t, time.Duration(0), tracer.deadlines[2])
+	}
+
+	assert.Nil(t, OperationOptions{}.maxTime())
+	assert.Equal(t, time.Second, *OperationOptions{MaxTime: time.Second}.maxTime())
+}
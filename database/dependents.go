@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
+)
+
+// ErrRestricted matches any RestrictError when used with errors.Is
+var ErrRestricted = errors.New("asari: document is referenced by dependents")
+
+type (
+	// Reference is a dependent collection holding documents that block a delete.
+	Reference struct {
+		Collection string
+		ForeignKey string
+		Count      int64
+	}
+
+	// RestrictError is returned when a document cannot be deleted because dependents with the Restrict policy
+	// reference it.
+	RestrictError struct {
+		References []Reference
+	}
+)
+
+func (e *RestrictError) Error() string {
+	refs := make([]string, len(e.References))
+	for i, r := range e.References {
+		refs[i] = fmt.Sprintf("%s.%s (%d)", r.Collection, r.ForeignKey, r.Count)
+	}
+	return "asari: document is referenced by " + strings.Join(refs, ", ")
+}
+
+func (e *RestrictError) Is(target error) bool {
+	return target == ErrRestricted
+}
+
+type deleteMode int
+
+const (
+	softDelete deleteMode = iota
+	hardDelete
+	restore
+)
+
+// withDependents runs write and applies the delete policies declared by doc. If doc has dependents, both run in a
+// transaction when the deployment supports them. Nothing is written if a dependent has no policy.
+func (c *Client) withDependents(ctx context.Context, doc interface{}, mode deleteMode, deletedAt time.Time, write func(ctx context.Context) error) error {
+	hasDependents, ok := doc.(document.HasDependents)
+	if !ok || len(hasDependents.Dependents()) == 0 {
+		return write(ctx)
+	}
+	for _, d := range hasDependents.Dependents() {
+		if d.Policy == 0 {
+			return ErrNoDeletePolicy
+		}
+	}
+
+	run := func(ctx context.Context) error {
+		if err := c.applyDeletePolicies(ctx, doc.(document.Document).GetID(), hasDependents.Dependents(), mode, deletedAt); err != nil {
+			return err
+		}
+		return write(ctx)
+	}
+
+	err := c.inTransaction(ctx, run)
+	for _, d := range hasDependents.Dependents() {
+		c.invalidateCollection(ctx, d.Collection)
+	}
+	return err
+}
+
+// inTransaction runs fn in a transaction. Deployments without transaction support (standalone servers) run fn
+// without one.
+func (c *Client) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session, err := c.Connection.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	if transactionsUnsupported(err) {
+		return fn(ctx)
+	}
+	return err
+}
+
+func transactionsUnsupported(err error) bool {
+	var serverError mongo.ServerError
+	if !errors.As(err, &serverError) {
+		return false
+	}
+	//IllegalOperation: Transaction numbers are only allowed on a replica set member or mongos
+	return serverError.HasErrorCode(20) && serverError.HasErrorMessage("Transaction numbers")
+}
+
+func (c *Client) applyDeletePolicies(ctx context.Context, id interface{}, dependents []document.Dependent, mode deleteMode, deletedAt time.Time) error {
+	db, err := c.database(ctx)
+	if err != nil {
+		return err
+	}
+	//Dependents of a tenant's document belong to the same tenant
+	scoped := func(filter bson.D) bson.D {
+		if tenant := c.sharedTenant(ctx); tenant != "" {
+			return append(filter, bson.E{Key: document.TenantField, Value: tenant})
+		}
+		return filter
+	}
+
+	if mode != restore {
+		restricted := &RestrictError{}
+		for _, d := range dependents {
+			if d.Policy != document.Restrict {
+				continue
+			}
+
+			filter := bson.D{bson.E{Key: d.ForeignKey, Value: id}}
+			if mode == softDelete {
+				filter = append(filter, bson.E{Key: "is_deleted", Value: false})
+			}
+			count, err := c.collection(ctx, db, d.Collection).CountDocuments(ctx, scoped(filter))
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				restricted.References = append(restricted.References, Reference{Collection: d.Collection, ForeignKey: d.ForeignKey, Count: count})
+			}
+		}
+		if len(restricted.References) > 0 {
+			return restricted
+		}
+	}
+
+	for _, d := range dependents {
+		var err error
+		collection := c.collection(ctx, db, d.Collection)
+
+		switch {
+		case d.Policy == document.Cascade && mode == softDelete:
+			_, err = collection.UpdateMany(ctx,
+				scoped(bson.D{bson.E{Key: d.ForeignKey, Value: id}, bson.E{Key: "is_deleted", Value: false}}),
+				bson.D{bson.E{Key: operator.Set, Value: bson.D{
+					bson.E{Key: "is_deleted", Value: true},
+					bson.E{Key: "deleted_at", Value: deletedAt},
+				}}},
+			)
+		case d.Policy == document.Cascade && mode == restore:
+			//Only restore dependents deleted by the cascade, they share the document's deleted_at
+			_, err = collection.UpdateMany(ctx,
+				scoped(bson.D{
+					bson.E{Key: d.ForeignKey, Value: id},
+					bson.E{Key: "is_deleted", Value: true},
+					bson.E{Key: "deleted_at", Value: deletedAt},
+				}),
+				bson.D{
+					bson.E{Key: operator.Set, Value: bson.D{bson.E{Key: "is_deleted", Value: false}}},
+					bson.E{Key: operator.Unset, Value: bson.D{bson.E{Key: "deleted_at", Value: ""}}},
+				},
+			)
+		case d.Policy == document.Cascade && mode == hardDelete:
+			_, err = collection.DeleteMany(ctx, scoped(bson.D{bson.E{Key: d.ForeignKey, Value: id}}))
+		case d.Policy == document.Nullify && mode != restore:
+			_, err = collection.UpdateMany(ctx,
+				scoped(bson.D{bson.E{Key: d.ForeignKey, Value: id}}),
+				bson.D{bson.E{Key: operator.Set, Value: bson.D{bson.E{Key: d.ForeignKey, Value: nil}}}},
+			)
+		}
+
+		if err != nil {
+			return writeError("cascade to "+d.Collection, d.Collection, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+const (
+	OrderCollection  string = "orders"
+	ReviewCollection string = "reviews"
+)
+
+type Owner struct {
+	document.Base `bson:",inline"`
+	Name          string `bson:"name"`
+}
+
+func (o *Owner) Dependents() []document.Dependent {
+	return []document.Dependent{
+		{Collection: PetCollection, ForeignKey: "owner_id", Policy: document.Cascade},
+		{Collection: OrderCollection, ForeignKey: "owner_id", Policy: document.Restrict},
+		{Collection: ReviewCollection, ForeignKey: "owner_id", Policy: document.Nullify},
+	}
+}
+
+type Order struct {
+	document.Base `bson:",inline"`
+	OwnerID       primitive.ObjectID `bson:"owner_id"`
+}
+
+type Review struct {
+	document.Base `bson:",inline"`
+	OwnerID       *primitive.ObjectID `bson:"owner_id"`
+}
+
+func TestRestrictError(t *testing.T) {
+	err := error(&RestrictError{References: []Reference{{Collection: OrderCollection, ForeignKey: "owner_id", Count: 2}}})
+	assert.True(t, errors.Is(err, ErrRestricted))
+	assert.Equal(t, "asari: document is referenced by orders.owner_id (2)", err.Error())
+}
+
+type unpoliced struct {
+	document.Base `bson:",inline"`
+}
+
+func (u *unpoliced) Dependents() []document.Dependent {
+	return []document.Dependent{{Collection: PetCollection, ForeignKey: "owner_id"}}
+}
+
+func TestClient_WithDependents(t *testing.T) {
+	c := disconnectedClient(t)
+	doc := &unpoliced{}
+	doc.Setup()
+
+	written := false
+	err := c.withDependents(context.Background(), doc, hardDelete, time.Time{}, func(ctx context.Context) error {
+		written = true
+		return nil
+	})
+	assert.Equal(t, ErrNoDeletePolicy, err)
+	assert.False(t, written)
+}
+
+func TestClient_SoftDeleteDocument_Dependents(t *testing.T) {
+	owner := &Owner{Name: "Joseph"}
+	owner.Setup()
+	TestClient.SaveDocument(nil, UserCollection, owner)
+
+	pet := &Pet{Name: "Rex", OwnerID: owner.ID}
+	pet.Setup()
+	TestClient.SaveDocument(nil, PetCollection, pet)
+
+	order := &Order{OwnerID: owner.ID}
+	order.Setup()
+	TestClient.SaveDocument(nil, OrderCollection, order)
+
+	review := &Review{OwnerID: &owner.ID}
+	review.Setup()
+	TestClient.SaveDocument(nil, ReviewCollection, review)
+
+	//Test Restricted Dependents Block The Delete
+	_, err := TestClient.SoftDeleteDocument(nil, UserCollection, owner)
+	var re *RestrictError
+	if assert.True(t, errors.As(err, &re)) {
+		assert.Equal(t, OrderCollection, re.References[0].Collection)
+		assert.Equal(t, int64(1), re.References[0].Count)
+	}
+	count, _ := TestClient.CountDocuments(nil, PetCollection, queryfilter.New().GetFilters())
+	assert.Equal(t, 1, count)
+
+	//Test Cascade And Nullify
+	TestClient.HardDeleteDocument(nil, OrderCollection, order)
+	owner.BeforeRestore()
+	_, err = TestClient.SoftDeleteDocument(nil, UserCollection, owner)
+	assert.Nil(t, err)
+
+	count, _ = TestClient.CountDocuments(nil, PetCollection, queryfilter.New().GetFilters())
+	assert.Equal(t, 0, count)
+
+	var r Review
+	TestClient.FindOneByID(nil, ReviewCollection, review.ID, nil, &r)
+	assert.Nil(t, r.OwnerID)
+
+	//Test Restore Brings Back Cascaded Dependents Only
+	other := &Pet{Name: "Fido", OwnerID: owner.ID}
+	other.Setup()
+	TestClient.SaveDocument(nil, PetCollection, other)
+	TestClient.SoftDeleteDocument(nil, PetCollection, other)
+
+	_, err = TestClient.RestoreDocument(nil, UserCollection, owner)
+	assert.Nil(t, err)
+	assert.False(t, owner.IsDeleted)
+
+	var u Owner
+	assert.Nil(t, TestClient.FindOneByID(nil, UserCollection, owner.ID, nil, &u))
+
+	var p Pet
+	assert.Nil(t, TestClient.FindOneByID(nil, PetCollection, pet.ID, nil, &p))
+	assert.Equal(t, ErrNotFound, TestClient.FindOneByID(nil, PetCollection, other.ID, nil, &p))
+
+	//Test Hard Delete Cascades
+	_, err = TestClient.HardDeleteDocument(nil, UserCollection, owner)
+	assert.Nil(t, err)
+	count, _ = TestClient.CountDocuments(nil, PetCollection, bson.M{"owner_id": owner.ID})
+	assert.Equal(t, 0, count)
+
+	tearDown()
+	for _, collection := range []string{PetCollection, OrderCollection, ReviewCollection} {
+		TestClient.Connection.Collection(collection).DeleteMany(nil, bson.M{})
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when no document matches the filters.
+	// It is mongo.ErrNoDocuments so existing comparisons against the driver error keep working.
+	ErrNotFound = mongo.ErrNoDocuments
+
+	ErrNotPointer        = errors.New("asari: doc must be a pointer to a document")
+	ErrNotSetup          = errors.New("asari: cannot save new document. call document.Setup() before calling SaveDocument()")
+	ErrInvalidProjection = errors.New("asari: projections can only be bson.M types")
+	ErrEmptyFilterKey    = errors.New("asari: document field names in filters cannot be empty. Key required")
+	ErrEmptyUpdate       = errors.New("asari: empty UpdateManyBuilder provided")
+	ErrNoHandler         = errors.New("asari: a change handler is required")
+	ErrNotRestorable     = errors.New("asari: doc must implement document.Restorable to be restored")
+	ErrNotDocument       = errors.New("asari: doc must implement document.Document")
+	ErrNotNew            = errors.New("asari: InsertDocuments only inserts new documents")
+	ErrNoDeletePolicy    = errors.New("asari: every document.Dependent must declare a delete policy")
+
+	// ErrDuplicateKey matches any DuplicateKeyError when used with errors.Is
+	ErrDuplicateKey = errors.New("asari: duplicate key")
+
+	// ErrPopulateTarget is returned when a populate target is not a pointer to a document or a slice of documents.
+	ErrPopulateTarget = errors.New("asari: populate target must be a pointer to a document or a slice of documents")
+	// ErrNotSlice is returned by DecodeAll when results is not a pointer to a slice.
+	ErrNotSlice = errors.New("asari: results must be a pointer to a slice")
+
+	// ErrUnknownRelation matches the RelationError of a relation a document does not declare when used with errors.Is
+	ErrUnknownRelation = errors.New("asari: unknown relation")
+	// ErrInvalidRelation matches the RelationError of a relation with an invalid populate tag when used with errors.Is
+	ErrInvalidRelation = errors.New("asari: invalid relation")
+
+	duplicateKeyMessage = regexp.MustCompile(`index: (\S+) dup key: \{(.*)\}`)
+	duplicateKeyField   = regexp.MustCompile(`([\w.$]+)\s*:`)
+	quotedValue         = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// HookError is returned when a document hook fails. Hook is the name of the hook - eg: "PreCreate"
+type HookError struct {
+	Hook string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("asari: %s Hook Error: %v", e.Hook, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// WriteError is returned when the server rejects a write. Operation is the Client method that made the write.
+// Err is the driver error, a *DuplicateKeyError for unique index violations or ErrNotFound when no document matched.
+type WriteError struct {
+	Operation  string
+	Collection string
+	Err        error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("asari: %s on %s failed: %v", e.Operation, e.Collection, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+func writeError(operation, collection string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &WriteError{Operation: operation, Collection: collection, Err: duplicateKeyError(err)}
+}
+
+// DocumentErrors is returned by InsertDocuments when some of the documents fail. It holds the error of every failed
+// document by its index, the other documents were inserted.
+type DocumentErrors map[int]error
+
+func (e DocumentErrors) Error() string {
+	return fmt.Sprintf("asari: %d documents failed", len(e))
+}
+
+// ValidationError is returned by SaveDocument when a document fails its asari struct tag rules.
+type ValidationError = validator.ValidationError
+
+// DuplicateKeyError is returned when a write violates a unique index.
+// Index is the name of the violated index and Fields the indexed fields when the server reports them.
+type DuplicateKeyError struct {
+	Index  string
+	Fields []string
+	Err    error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if len(e.Fields) > 0 {
+		return fmt.Sprintf("asari: duplicate key on index %s (%s)", e.Index, strings.Join(e.Fields, ", "))
+	}
+	return fmt.Sprintf("asari: duplicate key on index %s", e.Index)
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// duplicateKeyError returns a *DuplicateKeyError if err is a duplicate key error or err unchanged otherwise.
+func duplicateKeyError(err error) error {
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	dke := &DuplicateKeyError{Err: err}
+
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, we := range writeException.WriteErrors {
+			if keyPattern, ok := we.Raw.Lookup("keyPattern").DocumentOK(); ok {
+				var keys bson.D
+				if bson.Unmarshal(keyPattern, &keys) == nil {
+					for _, k := range keys {
+						dke.Fields = append(dke.Fields, k.Key)
+					}
+				}
+			}
+		}
+	}
+
+	if matches := duplicateKeyMessage.FindStringSubmatch(err.Error()); matches != nil {
+		dke.Index = matches[1]
+		if len(dke.Fields) == 0 {
+			for _, field := range duplicateKeyField.FindAllStringSubmatch(quotedValue.ReplaceAllString(matches[2], ""), -1) {
+				dke.Fields = append(dke.Fields, field[1])
+			}
+		}
+	}
+
+	return dke
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"github.com/jcobhams/asari/builder"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestDuplicateKeyError(t *testing.T) {
+	err := mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: asari.users index: email_1 dup key: { email: "a: b@asari.io" }`,
+	}}}
+
+	dke := duplicateKeyError(err)
+	assert.True(t, errors.Is(dke, ErrDuplicateKey))
+
+	var target *DuplicateKeyError
+	if assert.True(t, errors.As(dke, &target)) {
+		assert.Equal(t, "email_1", target.Index)
+		assert.Equal(t, []string{"email"}, target.Fields)
+	}
+
+	//Test Other Errors Are Returned Unchanged
+	other := errors.New("asari")
+	assert.Equal(t, other, duplicateKeyError(other))
+	assert.Nil(t, duplicateKeyError(nil))
+}
+
+func TestHookError(t *testing.T) {
+	cause := errors.New("hook failed")
+	err := error(&HookError{Hook: "PreCreate", Err: cause})
+
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "asari: PreCreate Hook Error: hook failed", err.Error())
+}
+
+func TestWriteError(t *testing.T) {
+	assert.Nil(t, writeError("SaveDocument", UserCollection, nil))
+
+	err := writeError("SaveDocument", UserCollection, mongo.ErrNoDocuments)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	var we *WriteError
+	if assert.True(t, errors.As(err, &we)) {
+		assert.Equal(t, "SaveDocument", we.Operation)
+		assert.Equal(t, UserCollection, we.Collection)
+	}
+
+	//Test Duplicate Keys Are Wrapped
+	err = writeError("SaveDocument", UserCollection, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})
+	assert.True(t, errors.Is(err, ErrDuplicateKey))
+}
+
+func TestClient_ValidationErrors(t *testing.T) {
+	assert.Equal(t, ErrNotPointer, TestClient.validateDocumentKind(User{}))
+	assert.Equal(t, ErrNotPointer, TestClient.validateDocumentKind(nil))
+	assert.Equal(t, ErrInvalidProjection, TestClient.validateProjection(map[string]interface{}{"email": 1}))
+	assert.Equal(t, ErrEmptyFilterKey, TestClient.validateFilters([]bson.E{{Key: "", Value: 1}}))
+
+	_, err := TestClient.SaveDocument(nil, UserCollection, &User{})
+	assert.Equal(t, ErrNotSetup, err)
+
+	_, err = TestClient.UpdateMany(nil, UserCollection, nil, builder.NewUpdateManyBuilder(), nil)
+	assert.Equal(t, ErrEmptyUpdate, err)
+}
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Explainable query commands.
+const (
+	ExplainFind      = "find"
+	ExplainCount     = "count"
+	ExplainAggregate = "aggregate"
+)
+
+var (
+	// ErrCollectionScan matches any CollectionScanError when used with errors.Is
+	ErrCollectionScan = errors.New("asari: query plan uses a collection scan")
+	// ErrNotExplainable is returned by Explain for commands other than find, count and aggregate.
+	ErrNotExplainable = errors.New("asari: only find, count and aggregate can be explained")
+)
+
+type (
+	// ExplainOp is a find, count or aggregate call to explain. Filters, Projection and Sort apply to find and count
+	// calls, Pipeline to aggregate calls. The filters are scoped like the calls they describe: find filters exclude
+	// soft deleted documents unless they filter on is_deleted, and tenancy scopes every command to the context tenant.
+	ExplainOp struct {
+		// Command is ExplainFind, ExplainCount or ExplainAggregate.
+		Command    string
+		Collection string
+		Filters    []bson.E
+		Projection interface{}
+		Sort       bson.D
+		Pipeline   mongo.Pipeline
+	}
+
+	// Plan summarises the winning query plan of an explained call.
+	Plan struct {
+		// WinningStage is the root stage of the winning plan - eg: "FETCH", "COLLSCAN".
+		WinningStage string
+		// Stages lists every stage of the winning plan, from the root down.
+		Stages []string
+		// Indexes lists the names of the indexes the winning plan reads.
+		Indexes        []string
+		CollectionScan bool
+		DocsExamined   int64
+		KeysExamined   int64
+		DocsReturned   int64
+		// Raw is the explain output of the server.
+		Raw bson.Raw
+	}
+
+	// CollectionScanError is returned in strict index mode when a call on a collection requiring indexes would scan
+	// the collection. See EnableStrictIndexes.
+	CollectionScanError struct {
+		Collection string
+		Plan       *Plan
+	}
+
+	planNode struct {
+		Stage       string     `bson:"stage"`
+		IndexName   string     `bson:"indexName"`
+		InputStage  *planNode  `bson:"inputStage"`
+		InputStages []planNode `bson:"inputStages"`
+		// QueryPlan wraps the plan of queries run by the slot based execution engine.
+		QueryPlan *planNode `bson:"queryPlan"`
+		// Shards holds the plan of every shard when the collection is sharded.
+		Shards []struct {
+			WinningPlan planNode `bson:"winningPlan"`
+		} `bson:"shards"`
+	}
+
+	explainOutput struct {
+		QueryPlanner *struct {
+			WinningPlan planNode `bson:"winningPlan"`
+		} `bson:"queryPlanner"`
+		ExecutionStats *struct {
+			NReturned         int64 `bson:"nReturned"`
+			TotalKeysExamined int64 `bson:"totalKeysExamined"`
+			TotalDocsExamined int64 `bson:"totalDocsExamined"`
+		} `bson:"executionStats"`
+		Stages []bson.Raw `bson:"stages"`
+	}
+)
+
+func (e *CollectionScanError) Error() string {
+	return fmt.Sprintf("asari: query on %s uses a collection scan", e.Collection)
+}
+
+func (e *CollectionScanError) Is(target error) bool {
+	return target == ErrCollectionScan
+}
+
+// EnableStrictIndexes marks collections as requiring indexes. Every find, count and aggregate call on them is explained
+// first and fails with a *CollectionScanError instead of running when its plan scans the collection.
+// Explaining costs an extra round trip per call, strict mode is meant for tests.
+// Only the plan of the collection a call runs on is checked: collections an aggregation reads with $lookup are not, so
+// scans of them go undetected.
+func (c *Client) EnableStrictIndexes(collections ...string) {
+	if c.strictIndexes == nil {
+		c.strictIndexes = map[string]bool{}
+	}
+	for _, collection := range collections {
+		c.strictIndexes[collection] = true
+	}
+}
+
+// DisableStrictIndexes stops checking the plans of calls on every collection.
+func (c *Client) DisableStrictIndexes() {
+	c.strictIndexes = nil
+}
+
+// Explain returns the winning plan of op with the executionStats verbosity. The call is run by the server to collect
+// its statistics but no documents are returned or modified.
+func (c *Client) Explain(ctx context.Context, op ExplainOp) (*Plan, error) {
+	db, err := c.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd bson.D
+	switch op.Command {
+	case ExplainFind:
+		filters := c.applyIsDeletedFilter(op.Filters)
+		if err := c.validateFilters(filters); err != nil {
+			return nil, err
+		}
+		if err := c.validateProjection(op.Projection); err != nil {
+			return nil, err
+		}
+		if filters, err = c.scopeFilters(ctx, filters); err != nil {
+			return nil, err
+		}
+		cmd = command(ExplainFind, op.Collection,
+			bson.E{Key: "filter", Value: bson.D(filters)},
+			bson.E{Key: "projection", Value: op.Projection},
+			bson.E{Key: "sort", Value: op.Sort},
+		)
+	case ExplainCount:
+		filters, err := c.scopeFilters(ctx, op.Filters)
+		if err != nil {
+			return nil, err
+		}
+		cmd = command(ExplainCount, op.Collection, bson.E{Key: "query", Value: bson.D(filters)})
+	case ExplainAggregate:
+		pipeline, err := c.scopePipeline(ctx, op.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		cmd = command(ExplainAggregate, op.Collection,
+			bson.E{Key: "pipeline", Value: pipeline},
+			bson.E{Key: "cursor", Value: bson.D{}},
+		)
+	default:
+		return nil, ErrNotExplainable
+	}
+
+	raw, err := explain(ctx, db, cmd, "executionStats")
+	if err != nil {
+		return nil, err
+	}
+	return parsePlan(raw)
+}
+
+// prepareQuery records a find, count or aggregate command on the instrumented call of ctx (see setCommand). In strict
+// index mode, it explains the command first and returns a *CollectionScanError if its plan scans a collection
+// requiring indexes.
+func (c *Client) prepareQuery(ctx context.Context, db *mongo.Database, filters interface{}, cmd bson.D) error {
+	setCommand(ctx, db, filters, cmd)
+
+	if len(c.strictIndexes) == 0 {
+		return nil
+	}
+	collection, _ := cmd[0].Value.(string)
+	if !c.strictIndexes[collection] {
+		return nil
+	}
+
+	raw, err := explain(ctx, db, cmd, "queryPlanner")
+	if err != nil {
+		return err
+	}
+	plan, err := parsePlan(raw)
+	if err != nil {
+		return err
+	}
+	if plan.CollectionScan {
+		return &CollectionScanError{Collection: collection, Plan: plan}
+	}
+	return nil
+}
+
+// explain returns the explain output of command at the given verbosity.
+func explain(ctx context.Context, db *mongo.Database, command bson.D, verbosity string) (bson.Raw, error) {
+	return db.RunCommand(ctx, bson.D{
+		bson.E{Key: "explain", Value: command},
+		bson.E{Key: "verbosity", Value: verbosity},
+	}).DecodeBytes()
+}
+
+// parsePlan summarises explain output. Aggregations report the plan of the $cursor stage feeding the pipeline, those
+// not reading a collection have no WinningStage.
+func parsePlan(raw bson.Raw) (*Plan, error) {
+	plan := &Plan{Raw: raw}
+	if err := plan.add(raw); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (p *Plan) add(raw bson.Raw) error {
+	var out explainOutput
+	if err := bson.Unmarshal(raw, &out); err != nil {
+		return err
+	}
+
+	if out.QueryPlanner != nil {
+		p.walk(&out.QueryPlanner.WinningPlan)
+	}
+	if out.ExecutionStats != nil {
+		p.DocsReturned += out.ExecutionStats.NReturned
+		p.KeysExamined += out.ExecutionStats.TotalKeysExamined
+		p.DocsExamined += out.ExecutionStats.TotalDocsExamined
+	}
+	for _, stage := range out.Stages {
+		if cursor, ok := stage.Lookup("$cursor").DocumentOK(); ok {
+			if err := p.add(cursor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plan) walk(node *planNode) {
+	if node.QueryPlan != nil {
+		node = node.QueryPlan
+	}
+	if node.Stage == "" {
+		return
+	}
+
+	if p.WinningStage == "" {
+		p.WinningStage = node.Stage
+	}
+	p.Stages = append(p.Stages, node.Stage)
+	if node.Stage == "COLLSCAN" {
+		p.CollectionScan = true
+	}
+	if node.IndexName != "" {
+		p.Indexes = append(p.Indexes, node.IndexName)
+	}
+
+	if node.InputStage != nil {
+		p.walk(node.InputStage)
+	}
+	for i := range node.InputStages {
+		p.walk(&node.InputStages[i])
+	}
+	for i := range node.Shards {
+		p.walk(&node.Shards[i].WinningPlan)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/index"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func explainOutputFromJSON(t *testing.T, extJSON string) bson.Raw {
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(extJSON), false, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestParsePlan(t *testing.T) {
+	plan, err := parsePlan(explainOutputFromJSON(t, `{
+		"queryPlanner": {"winningPlan": {"stage": "FETCH", "inputStage": {"stage": "IXSCAN", "indexName": "email_1"}}},
+		"executionStats": {"nReturned": 1, "totalKeysExamined": 1, "totalDocsExamined": 1}
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "FETCH", plan.WinningStage)
+	assert.Equal(t, []string{"FETCH", "IXSCAN"}, plan.Stages)
+	assert.Equal(t, []string{"email_1"}, plan.Indexes)
+	assert.False(t, plan.CollectionScan)
+	assert.Equal(t, int64(1), plan.DocsReturned)
+	assert.Equal(t, int64(1), plan.KeysExamined)
+
+	//Test Slot Based Engine Plans
+	plan, err = parsePlan(explainOutputFromJSON(t, `{
+		"queryPlanner": {"winningPlan": {"queryPlan": {"stage": "COLLSCAN"}, "slotBasedPlan": {}}},
+		"executionStats": {"nReturned": 2, "totalKeysExamined": 0, "totalDocsExamined": 50}
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "COLLSCAN", plan.WinningStage)
+	assert.True(t, plan.CollectionScan)
+	assert.Equal(t, int64(50), plan.DocsExamined)
+
+	//Test Aggregations Report Their $cursor Stage
+	plan, err = parsePlan(explainOutputFromJSON(t, `{
+		"stages": [
+			{"$cursor": {"queryPlanner": {"winningPlan": {"stage": "OR", "inputStages": [
+				{"stage": "IXSCAN", "indexName": "level_1"}, {"stage": "COLLSCAN"}
+			]}}}},
+			{"$group": {"_id": "$level"}}
+		]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"OR", "IXSCAN", "COLLSCAN"}, plan.Stages)
+	assert.True(t, plan.CollectionScan)
+
+	//Test Sharded Plans
+	plan, err = parsePlan(explainOutputFromJSON(t, `{
+		"queryPlanner": {"winningPlan": {"stage": "SHARD_MERGE", "shards": [
+			{"shardName": "a", "winningPlan": {"stage": "IXSCAN", "indexName": "email_1"}},
+			{"shardName": "b", "winningPlan": {"stage": "IXSCAN", "indexName": "email_1"}}
+		]}}
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SHARD_MERGE", "IXSCAN", "IXSCAN"}, plan.Stages)
+
+	plan, err = parsePlan(explainOutputFromJSON(t, `{"stages": [{"$documents": []}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", plan.WinningStage)
+}
+
+func TestCollectionScanError(t *testing.T) {
+	err := error(&CollectionScanError{Collection: UserCollection, Plan: &Plan{WinningStage: "COLLSCAN"}})
+	assert.True(t, errors.Is(err, ErrCollectionScan))
+	assert.Equal(t, "collection_scan", errorClass(err))
+}
+
+func TestClient_Explain(t *testing.T) {
+	_, err := TestClient.Explain(context.Background(), ExplainOp{Command: "distinct", Collection: UserCollection})
+	assert.Equal(t, ErrNotExplainable, err)
+
+	for _, name := range []string{"Joseph", "Ada", "Grace"} {
+		user := &User{FirstName: name, Email: name + "@asari.dev"}
+		user.Setup()
+		TestClient.SaveDocument(nil, UserCollection, user)
+	}
+	TestClient.Connection.Collection(UserCollection).Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "email", Value: index.Ascending}},
+	})
+
+	filters := []bson.E{{Key: "email", Value: "Ada@asari.dev"}}
+	plan, err := TestClient.Explain(context.Background(), ExplainOp{Command: ExplainFind, Collection: UserCollection, Filters: filters})
+	assert.Nil(t, err)
+	assert.Contains(t, plan.Indexes, "email_1")
+	assert.False(t, plan.CollectionScan)
+	assert.Equal(t, int64(1), plan.DocsReturned)
+
+	plan, err = TestClient.Explain(context.Background(), ExplainOp{
+		Command:    ExplainAggregate,
+		Collection: UserCollection,
+		Pipeline:   mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "first_name", Value: "Ada"}}}}},
+	})
+	assert.Nil(t, err)
+	assert.True(t, plan.CollectionScan)
+
+	//Test Strict Mode Rejects Collection Scans
+	TestClient.EnableStrictIndexes(UserCollection)
+	defer TestClient.DisableStrictIndexes()
+
+	_, err = TestClient.FindPaginated(nil, UserCollection, PageOpts{Page: 1, PerPage: 10}, []bson.E{{Key: "first_name", Value: "Ada"}}, nil, nil)
+	var scanError *CollectionScanError
+	if assert.True(t, errors.As(err, &scanError)) {
+		assert.Equal(t, UserCollection, scanError.Collection)
+		assert.True(t, scanError.Plan.CollectionScan)
+	}
+
+	user := &User{}
+	assert.Nil(t, TestClient.FindOne(nil, UserCollection, filters, nil, user))
+	assert.Equal(t, "Ada", user.FirstName)
+
+	tearDownIndexes()
+	tearDown()
+}
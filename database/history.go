@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/index"
+	"github.com/jcobhams/asari/queryfilter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sync"
+)
+
+// HistorySuffix is appended to a collection name to get the collection its revisions are stored in.
+const HistorySuffix = "_history"
+
+// revisionAttempts is the number of times a revision is numbered before concurrent saves make saveRevision give up.
+const revisionAttempts = 5
+
+var (
+	// revisionIndex keeps two revisions of a document from sharing a number.
+	revisionIndex = index.Index{
+		Name:   "document_id_1_revision_1",
+		Keys:   bson.D{bson.E{Key: "document_id", Value: index.Ascending}, bson.E{Key: "revision", Value: index.Ascending}},
+		Unique: true,
+	}
+
+	// revisionIndexes holds the "<database>.<collection>" history collections known to have the revision index.
+	revisionIndexes sync.Map
+)
+
+// Revision is a previous version of a document. Revisions of a document are numbered from 1 in the order they were
+// replaced.
+type Revision struct {
+	document.Base   `bson:",inline"`
+	document.Tenant `bson:",inline"`
+	DocumentID      primitive.ObjectID `bson:"document_id"`
+	Number          int                `bson:"revision"`
+	Actor           interface{}        `bson:"actor,omitempty"`
+	Snapshot        bson.Raw           `bson:"snapshot"`
+}
+
+// Decode decodes the snapshot of the revision into target. Schema upgrades apply. See Decode
+func (r *Revision) Decode(target interface{}) error {
+	return Decode(r.Snapshot, target)
+}
+
+// HistoryCollection returns the collection the revisions of documents in collection are stored in.
+func HistoryCollection(collection string) string {
+	return collection + HistorySuffix
+}
+
+// ListRevisions returns the revisions of a document, newest first.
+func (c *Client) ListRevisions(ctx context.Context, collection string, id primitive.ObjectID) ([]Revision, error) {
+	filters := queryfilter.New().AddFilter(bson.E{Key: "document_id", Value: id}).GetFilters()
+	ctx = withoutPopulate(ctx)
+	cur, err := c.FindAll(ctx, HistoryCollection(collection), filters, nil, bson.D{bson.E{Key: "revision", Value: -1}})
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	return revisions, c.DecodeAll(ctx, cur, &revisions)
+}
+
+// GetRevision returns a revision of a document or ErrNotFound if it does not exist.
+func (c *Client) GetRevision(ctx context.Context, collection string, id primitive.ObjectID, number int) (*Revision, error) {
+	filters := queryfilter.New().
+		AddFilter(bson.E{Key: "document_id", Value: id}).
+		AddFilter(bson.E{Key: "revision", Value: number}).
+		GetFilters()
+
+	revision := &Revision{}
+	if err := c.FindOne(withoutPopulate(ctx), HistoryCollection(collection), filters, nil, revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// RevertToRevision replaces doc with a revision of it and saves it with SaveDocument so hooks and validation run and
+// the version being replaced becomes a revision itself. doc must be a live (not soft deleted) document.
+func (c *Client) RevertToRevision(ctx context.Context, collection string, doc interface{}, number int) (interface{}, error) {
+	if err := c.validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	d, ok := doc.(document.Document)
+	if !ok {
+		return nil, ErrNotDocument
+	}
+
+	revision, err := c.GetRevision(ctx, collection, d.GetID(), number)
+	if err != nil {
+		return nil, err
+	}
+
+	target := reflect.ValueOf(doc).Elem()
+	target.Set(reflect.Zero(target.Type()))
+	if err := revision.Decode(doc); err != nil {
+		return nil, err
+	}
+	d.SetIsNew(false)
+
+	return c.SaveDocument(ctx, collection, doc)
+}
+
+// saveRevision stores the version of doc an update replaced when doc keeps history.
+func (c *Client) saveRevision(ctx context.Context, collection string, doc interface{}, replaced bson.Raw) error {
+	keeper, ok := doc.(document.HistoryKeeper)
+	if !ok || !keeper.KeepHistory() || replaced == nil {
+		return nil
+	}
+
+	db, err := c.database(ctx)
+	if err != nil {
+		return err
+	}
+
+	id := doc.(document.Document).GetID()
+	history := c.collection(ctx, db, HistoryCollection(collection))
+	if err := ensureRevisionIndex(history); err != nil {
+		return err
+	}
+
+	//Concurrent saves can pick the same number, the unique revision index rejects all but one of them
+	for attempt := 1; ; attempt++ {
+		number, err := nextRevision(ctx, history, id)
+		if err != nil {
+			return err
+		}
+
+		revision := &Revision{
+			DocumentID: id,
+			Number:     number,
+			Actor:      ActorFromContext(ctx),
+			Snapshot:   replaced,
+		}
+		revision.Setup()
+		revision.TenantID = c.sharedTenant(ctx)
+
+		_, err = history.InsertOne(ctx, revision)
+		var dke *DuplicateKeyError
+		if attempt < revisionAttempts && errors.As(duplicateKeyError(err), &dke) && dke.Index == revisionIndex.Name {
+			continue
+		}
+		return writeError("SaveDocument", HistoryCollection(collection), err)
+	}
+}
+
+// nextRevision returns the number of the next revision of the document with id.
+func nextRevision(ctx context.Context, history *mongo.Collection, id primitive.ObjectID) (int, error) {
+	var last Revision
+	err := history.FindOne(ctx, bson.D{bson.E{Key: "document_id", Value: id}}, options.FindOne().
+		SetSort(bson.D{bson.E{Key: "revision", Value: -1}}).
+		SetProjection(bson.D{bson.E{Key: "revision", Value: 1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	return last.Number + 1, err
+}
+
+// ensureRevisionIndex creates the unique revision index on a history collection the first time a revision is saved in
+// it. The index is created outside of any transaction the save runs in.
+func ensureRevisionIndex(history *mongo.Collection) error {
+	key := history.Database().Name() + "." + history.Name()
+	if _, ok := revisionIndexes.Load(key); ok {
+		return nil
+	}
+	if _, err := history.Indexes().CreateOne(context.Background(), revisionIndex.Model()); err != nil {
+		return err
+	}
+	revisionIndexes.Store(key, true)
+	return nil
+}
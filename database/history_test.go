@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"sync"
+	"testing"
+)
+
+type Article struct {
+	document.Base `bson:",inline"`
+	Title         string `bson:"title"`
+	Body          string `bson:"body"`
+}
+
+func (a *Article) KeepHistory() bool {
+	return true
+}
+
+const ArticleCollection string = "articles"
+
+func TestHistoryCollection(t *testing.T) {
+	assert.Equal(t, "articles_history", HistoryCollection(ArticleCollection))
+}
+
+func TestClient_RevertToRevision(t *testing.T) {
+	_, err := disconnectedClient(t).RevertToRevision(nil, ArticleCollection, &struct{}{}, 1)
+	assert.Equal(t, ErrNotDocument, err)
+}
+
+func TestClient_Revisions(t *testing.T) {
+	defer tearDownArticles()
+
+	article := &Article{Title: "Draft", Body: "First"}
+	article.Setup()
+	_, err := TestClient.SaveDocument(nil, ArticleCollection, article)
+	assert.Nil(t, err)
+
+	//Test Inserts Do Not Create Revisions
+	revisions, err := TestClient.ListRevisions(nil, ArticleCollection, article.ID)
+	assert.Nil(t, err)
+	assert.Len(t, revisions, 0)
+
+	article.Title = "Published"
+	TestClient.SaveDocument(nil, ArticleCollection, article)
+	article.Body = "Second"
+	TestClient.SaveDocument(nil, ArticleCollection, article)
+
+	revisions, err = TestClient.ListRevisions(nil, ArticleCollection, article.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 2, revisions[0].Number)
+		assert.Equal(t, 1, revisions[1].Number)
+	}
+
+	revision, err := TestClient.GetRevision(nil, ArticleCollection, article.ID, 1)
+	assert.Nil(t, err)
+	first := &Article{}
+	assert.Nil(t, revision.Decode(first))
+	assert.Equal(t, "Draft", first.Title)
+	assert.Equal(t, "First", first.Body)
+
+	_, err = TestClient.GetRevision(nil, ArticleCollection, article.ID, 5)
+	assert.Equal(t, ErrNotFound, err)
+
+	//Test Reverting Saves The Revision And Keeps The Replaced Version
+	_, err = TestClient.RevertToRevision(nil, ArticleCollection, article, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Draft", article.Title)
+	assert.Equal(t, "First", article.Body)
+
+	stored := &Article{}
+	TestClient.FindOneByID(nil, ArticleCollection, article.ID, nil, stored)
+	assert.Equal(t, "Draft", stored.Title)
+
+	revision, err = TestClient.GetRevision(nil, ArticleCollection, article.ID, 3)
+	if assert.Nil(t, err) {
+		latest := &Article{}
+		revision.Decode(latest)
+		assert.Equal(t, "Published", latest.Title)
+		assert.Equal(t, "Second", latest.Body)
+	}
+
+	//Test Concurrent Saves Get Distinct Revision Numbers
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a := *article
+			a.Body = fmt.Sprint(i)
+			TestClient.SaveDocument(nil, ArticleCollection, &a)
+		}(i)
+	}
+	wg.Wait()
+
+	revisions, err = TestClient.ListRevisions(nil, ArticleCollection, article.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 8) {
+		for i, r := range revisions {
+			assert.Equal(t, 8-i, r.Number)
+		}
+	}
+}
+
+func tearDownArticles() {
+	TestClient.Connection.Collection(ArticleCollection).DeleteMany(nil, []bson.E{})
+	TestClient.Connection.Collection(HistoryCollection(ArticleCollection)).Drop(nil)
+	revisionIndexes.Delete(TestClient.Connection.Name() + "." + HistoryCollection(ArticleCollection))
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/jcobhams/asari/index"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+)
+
+type (
+	EnsureIndexesOptions struct {
+		// DropUnmanaged drops existing indexes that are not declared by the document. The _id index is never dropped.
+		DropUnmanaged bool
+	}
+
+	// IndexReport describes the difference between the declared and existing indexes of a collection.
+	IndexReport struct {
+		Created   []string
+		Unchanged []string
+		// Conflicting lists indexes that exist with a declared name but a different definition. They are left untouched.
+		Conflicting []string
+		Unmanaged   []string
+		Dropped     []string
+	}
+
+	existingIndex struct {
+		Name               string   `bson:"name"`
+		Key                bson.D   `bson:"key"`
+		Unique             bool     `bson:"unique"`
+		Sparse             bool     `bson:"sparse"`
+		ExpireAfterSeconds *int32   `bson:"expireAfterSeconds"`
+		PartialFilter      bson.Raw `bson:"partialFilterExpression"`
+		Weights            bson.M   `bson:"weights"`
+	}
+)
+
+// EnsureIndexes creates the indexes declared by doc (see index.Declared) that do not yet exist on the collection and
+// reports existing indexes that are not declared. Unmanaged indexes are only dropped if DropUnmanaged is set.
+// doc can be any value of the document type - eg: &User{}
+func (c *Client) EnsureIndexes(ctx context.Context, collection string, doc interface{}, ensureOptions *EnsureIndexesOptions) (*IndexReport, error) {
+	if err := c.validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+	if ensureOptions == nil {
+		ensureOptions = &EnsureIndexesOptions{}
+	}
+
+	declared, err := index.Declared(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := c.collectionDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := c.listIndexes(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{}
+	var missing []mongo.IndexModel
+	managed := map[string]bool{"_id_": true}
+
+	for _, idx := range declared {
+		managed[idx.Name] = true
+
+		current, ok := existing[idx.Name]
+		if !ok {
+			missing = append(missing, idx.Model())
+			report.Created = append(report.Created, idx.Name)
+			continue
+		}
+
+		if current.matches(idx) {
+			report.Unchanged = append(report.Unchanged, idx.Name)
+		} else {
+			report.Conflicting = append(report.Conflicting, idx.Name)
+		}
+	}
+
+	for name := range existing {
+		if !managed[name] {
+			report.Unmanaged = append(report.Unmanaged, name)
+		}
+	}
+	sort.Strings(report.Unmanaged)
+
+	if len(missing) > 0 {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, missing); err != nil {
+			return report, err
+		}
+	}
+
+	if ensureOptions.DropUnmanaged {
+		for _, name := range report.Unmanaged {
+			if _, err := db.Collection(collection).Indexes().DropOne(ctx, name); err != nil {
+				return report, err
+			}
+			report.Dropped = append(report.Dropped, name)
+		}
+	}
+
+	return report, nil
+}
+
+func (c *Client) listIndexes(ctx context.Context, collection string) (map[string]existingIndex, error) {
+	db, err := c.collectionDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := db.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	existing := map[string]existingIndex{}
+	for cur.Next(ctx) {
+		var idx existingIndex
+		if err := cur.Decode(&idx); err != nil {
+			return nil, err
+		}
+		existing[idx.Name] = idx
+	}
+	return existing, cur.Err()
+}
+
+func (e existingIndex) matches(idx index.Index) bool {
+	if e.Unique != idx.Unique || e.Sparse != idx.Sparse {
+		return false
+	}
+
+	if (e.ExpireAfterSeconds == nil) != (idx.ExpireAfterSeconds == nil) {
+		return false
+	}
+	if e.ExpireAfterSeconds != nil && *e.ExpireAfterSeconds != *idx.ExpireAfterSeconds {
+		return false
+	}
+
+	if len(idx.PartialFilter) > 0 || len(e.PartialFilter) > 0 {
+		declaredFilter, err := bson.Marshal(idx.PartialFilter)
+		if err != nil || !bytes.Equal(declaredFilter, e.PartialFilter) {
+			return false
+		}
+	}
+
+	return e.keysMatch(idx.Keys)
+}
+
+func (e existingIndex) keysMatch(keys bson.D) bool {
+	//Text indexes are stored as {_fts: "text", _ftsx: 1} with the text fields listed in weights
+	var plain bson.D
+	textFields := map[string]bool{}
+	for _, k := range keys {
+		if k.Value == index.Text {
+			textFields[k.Key] = true
+			continue
+		}
+		plain = append(plain, k)
+	}
+
+	var existingPlain bson.D
+	for _, k := range e.Key {
+		if k.Key == "_fts" || k.Key == "_ftsx" {
+			continue
+		}
+		existingPlain = append(existingPlain, k)
+	}
+
+	if len(textFields) != len(e.Weights) || len(plain) != len(existingPlain) {
+		return false
+	}
+	for field := range e.Weights {
+		if !textFields[field] {
+			return false
+		}
+	}
+	for i := range plain {
+		if plain[i].Key != existingPlain[i].Key || fmt.Sprint(plain[i].Value) != fmt.Sprint(existingPlain[i].Value) {
+			return false
+		}
+	}
+	return true
+}
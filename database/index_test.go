@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/index"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+type IndexedUser struct {
+	document.Base `bson:",inline"`
+	Email         string `bson:"email" index:"unique"`
+	LastName      string `bson:"last_name" index:"name=name_level"`
+	Level         int    `bson:"level" index:"desc,name=name_level"`
+}
+
+func TestClient_EnsureIndexes(t *testing.T) {
+	//Test error returned if document is not a pointer
+	_, err := TestClient.EnsureIndexes(nil, UserCollection, IndexedUser{}, nil)
+	assert.Error(t, err)
+
+	TestClient.Connection.Collection(UserCollection).Indexes().CreateOne(nil, mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "first_name", Value: index.Ascending}},
+	})
+
+	report, err := TestClient.EnsureIndexes(nil, UserCollection, &IndexedUser{}, nil)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"email_1", "name_level"}, report.Created)
+	assert.Equal(t, []string{"first_name_1"}, report.Unmanaged)
+	assert.Empty(t, report.Dropped)
+
+	//Test Existing Indexes Are Left Alone And Unmanaged Indexes Dropped
+	report, err = TestClient.EnsureIndexes(nil, UserCollection, &IndexedUser{}, &EnsureIndexesOptions{DropUnmanaged: true})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Created)
+	assert.ElementsMatch(t, []string{"email_1", "name_level"}, report.Unchanged)
+	assert.Empty(t, report.Conflicting)
+	assert.Equal(t, []string{"first_name_1"}, report.Dropped)
+
+	existing, _ := TestClient.listIndexes(nil, UserCollection)
+	assert.Equal(t, 3, len(existing))
+
+	tearDownIndexes()
+}
+
+type LiveUniqueUser struct {
+	document.Base `bson:",inline"`
+	Email         string `bson:"email" index:"unique,live"`
+}
+
+func TestClient_SaveDocument_UniqueLive(t *testing.T) {
+	_, err := TestClient.EnsureIndexes(nil, UserCollection, &LiveUniqueUser{}, nil)
+	assert.Nil(t, err)
+
+	user := &LiveUniqueUser{Email: "asari@gmail.com"}
+	user.Setup()
+	_, err = TestClient.SaveDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+
+	//Test Duplicate Live Documents Are Rejected
+	duplicate := &LiveUniqueUser{Email: "asari@gmail.com"}
+	duplicate.Setup()
+	_, err = TestClient.SaveDocument(nil, UserCollection, duplicate)
+	assert.True(t, errors.Is(err, ErrDuplicateKey))
+
+	var dke *DuplicateKeyError
+	if assert.True(t, errors.As(err, &dke)) {
+		assert.Equal(t, "email_1", dke.Index)
+		assert.Equal(t, []string{"email"}, dke.Fields)
+	}
+
+	//Test Soft Deleted Documents Do Not Block New Ones
+	_, err = TestClient.SoftDeleteDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+	_, err = TestClient.SaveDocument(nil, UserCollection, duplicate)
+	assert.Nil(t, err)
+
+	tearDown()
+	tearDownIndexes()
+}
+
+func tearDownIndexes() {
+	TestClient.Connection.Collection(UserCollection).Indexes().DropAll(nil)
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type (
+	// Operation identifies an instrumented Client call.
+	Operation struct {
+		// Name is the Client method - eg: "FindOne", "SaveDocument".
+		Name       string
+		Collection string
+		Database   string
+	}
+
+	// OperationResult describes how an instrumented Client call ended.
+	OperationResult struct {
+		Duration time.Duration
+		// Documents is the number of documents found, written or counted. Calls returning a cursor report -1 as the
+		// documents are read after the call ends.
+		Documents int64
+		Err       error
+		// ErrorClass groups Err into a small set of values fit for metric labels - eg: "not_found", "validation",
+		// "hook", "duplicate_key", "timeout". It is empty when the call succeeded.
+		ErrorClass string
+		// HookDuration is the time spent in document hooks during the call.
+		HookDuration time.Duration
+		// Retries is the number of times the call was retried. See EnableRetries.
+		Retries int
+	}
+
+	// Span is an instrumented Client call in progress.
+	Span interface {
+		End(result OperationResult)
+	}
+
+	// Tracer starts a Span around every Client call. The context it returns is used for the rest of the call so spans
+	// started by the driver or by nested calls are children of the Span.
+	Tracer interface {
+		Start(ctx context.Context, op Operation) (context.Context, Span)
+	}
+
+	// Metrics records every finished Client call.
+	Metrics interface {
+		Record(ctx context.Context, op Operation, result OperationResult)
+	}
+
+	// NoopTracer is the default Tracer, it starts spans that record nothing.
+	NoopTracer struct{}
+
+	// NoopMetrics is the default Metrics, it records nothing.
+	NoopMetrics struct{}
+
+	noopSpan struct{}
+
+	call struct {
+		ctx     context.Context
+		client  *Client
+		op      Operation
+		span    Span
+		started time.Time
+		hooks   time.Duration
+		db      *mongo.Database
+		filters interface{}
+		command bson.D
+		cancel  context.CancelFunc
+		retries int
+	}
+
+	callKey struct{}
+)
+
+func (NoopTracer) Start(ctx context.Context, op Operation) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) End(result OperationResult) {}
+
+func (NoopMetrics) Record(ctx context.Context, op Operation, result OperationResult) {}
+
+// SetTracer sets the Tracer started around every Client call. A nil tracer restores the NoopTracer.
+func (c *Client) SetTracer(tracer Tracer) {
+	c.tracer = tracer
+}
+
+// SetMetrics sets the Metrics every finished Client call is recorded with. A nil metrics restores NoopMetrics.
+func (c *Client) SetMetrics(metrics Metrics) {
+	c.metrics = metrics
+}
+
+// instrument starts the span of a Client call. The returned ctx carries the call so hook durations are added to it.
+// When the call has a MaxTime and ctx no deadline, the returned ctx expires after MaxTime.
+func (c *Client) instrument(ctx context.Context, name, collection string) (context.Context, *call) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); !ok {
+		if maxTime := c.operationOptions(ctx, collection).MaxTime; maxTime > 0 {
+			ctx, cancel = context.WithTimeout(ctx, maxTime)
+		}
+	}
+
+	op := Operation{Name: name, Collection: collection}
+	if db, err := c.database(ctx); err == nil && db != nil {
+		op.Database = db.Name()
+	}
+
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	ctx, span := tracer.Start(ctx, op)
+
+	cl := &call{client: c, op: op, span: span, started: time.Now(), cancel: cancel}
+	cl.ctx = context.WithValue(ctx, callKey{}, cl)
+	return cl.ctx, cl
+}
+
+// end ends the span of the call and records its metrics.
+func (cl *call) end(documents int64, err error) {
+	result := OperationResult{
+		Duration:     time.Since(cl.started),
+		Documents:    documents,
+		Err:          err,
+		ErrorClass:   errorClass(err),
+		HookDuration: cl.hooks,
+		Retries:      cl.retries,
+	}
+	if err != nil && documents > 0 {
+		result.Documents = 0
+	}
+
+	cl.span.End(result)
+	cl.log(result)
+	metrics := cl.client.metrics
+	if metrics == nil {
+		metrics = NoopMetrics{}
+	}
+	metrics.Record(cl.ctx, cl.op, result)
+
+	if cl.cancel != nil {
+		cl.cancel()
+	}
+}
+
+// runHook runs a document hook and adds its duration to the instrumented call of ctx.
+// Errors returned by the hook are wrapped in a *HookError.
+func runHook(ctx context.Context, hook string, fn func() error) error {
+	started := time.Now()
+	err := fn()
+	if ctx != nil {
+		if cl, ok := ctx.Value(callKey{}).(*call); ok {
+			cl.hooks += time.Since(started)
+		}
+	}
+
+	if err != nil {
+		return &HookError{Hook: hook, Err: err}
+	}
+	return nil
+}
+
+// pageDocuments returns the number of documents on the page of result.
+func pageDocuments(result *PaginatedResult) int64 {
+	if result == nil {
+		return 0
+	}
+	rows := result.TotalRows - result.Offset
+	if rows > result.PerPage {
+		rows = result.PerPage
+	}
+	if rows < 0 {
+		return 0
+	}
+	return rows
+}
+
+func updatedDocuments(result *mongo.UpdateResult) int64 {
+	if result == nil {
+		return 0
+	}
+	return result.ModifiedCount + result.UpsertedCount
+}
+
+func deletedDocuments(result *mongo.DeleteResult) int64 {
+	if result == nil {
+		return 0
+	}
+	return result.DeletedCount
+}
+
+func errorClass(err error) string {
+	var validationError *validator.ValidationError
+	var hookError *HookError
+	var serverError mongo.ServerError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.As(err, &validationError):
+		return "validation"
+	case errors.As(err, &hookError):
+		return "hook"
+	case errors.Is(err, ErrDuplicateKey):
+		return "duplicate_key"
+	case errors.Is(err, ErrCollectionScan):
+		return "collection_scan"
+	case errors.Is(err, ErrRestricted):
+		return "restricted"
+	case errors.Is(err, ErrNoTenant), errors.Is(err, ErrCrossTenant):
+		return "tenancy"
+	case errors.Is(err, ErrNotPointer), errors.Is(err, ErrNotSetup), errors.Is(err, ErrInvalidProjection),
+		errors.Is(err, ErrEmptyFilterKey), errors.Is(err, ErrEmptyUpdate):
+		return "invalid_argument"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return "timeout"
+	case mongo.IsNetworkError(err):
+		return "network"
+	case errors.As(err, &serverError):
+		return "server"
+	}
+	return "other"
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/validator"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+type (
+	recordingTracer struct {
+		started []Operation
+		ended   []OperationResult
+	}
+
+	recordingSpan struct {
+		tracer *recordingTracer
+	}
+
+	recordingMetrics struct {
+		ops     []Operation
+		results []OperationResult
+	}
+
+	hookedUser struct {
+		document.Base `bson:",inline"`
+		FirstName     string `bson:"first_name"`
+	}
+)
+
+func (t *recordingTracer) Start(ctx context.Context, op Operation) (context.Context, Span) {
+	t.started = append(t.started, op)
+	return ctx, &recordingSpan{tracer: t}
+}
+
+func (s *recordingSpan) End(result OperationResult) {
+	s.tracer.ended = append(s.tracer.ended, result)
+}
+
+func (m *recordingMetrics) Record(ctx context.Context, op Operation, result OperationResult) {
+	m.ops = append(m.ops, op)
+	m.results = append(m.results, result)
+}
+
+func (u *hookedUser) PreCreate(dbConnection *mongo.Database) error {
+	time.Sleep(5 * time.Millisecond)
+	return errors.New("signups are closed")
+}
+
+func TestClient_Instrumentation(t *testing.T) {
+	mClient, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tracer := &recordingTracer{}
+	metrics := &recordingMetrics{}
+	c := &Client{Connection: mClient.Database("main")}
+	c.SetTracer(tracer)
+	c.SetMetrics(metrics)
+
+	err = c.FindOne(context.Background(), "users", nil, bson.D{}, &User{})
+	assert.Equal(t, ErrInvalidProjection, err)
+
+	user := &hookedUser{FirstName: "Joseph"}
+	user.Setup()
+	_, err = c.SaveDocument(context.Background(), "users", user)
+	assert.IsType(t, &HookError{}, err)
+
+	assert.Equal(t, []Operation{
+		{Name: "FindOne", Collection: "users", Database: "main"},
+		{Name: "SaveDocument", Collection: "users", Database: "main"},
+	}, tracer.started)
+	assert.Equal(t, tracer.started, metrics.ops)
+	assert.Equal(t, tracer.ended, metrics.results)
+
+	assert.Equal(t, "invalid_argument", metrics.results[0].ErrorClass)
+	assert.Equal(t, int64(0), metrics.results[0].Documents)
+	assert.Equal(t, "hook", metrics.results[1].ErrorClass)
+	assert.True(t, metrics.results[1].HookDuration >= 5*time.Millisecond)
+	assert.True(t, metrics.results[1].Duration >= metrics.results[1].HookDuration)
+
+	c.SetTracer(nil)
+	c.SetMetrics(nil)
+	_, err = c.SaveDocument(context.Background(), "users", user)
+	assert.IsType(t, &HookError{}, err)
+	assert.Len(t, metrics.ops, 2)
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "", errorClass(nil))
+	assert.Equal(t, "not_found", errorClass(ErrNotFound))
+	assert.Equal(t, "validation", errorClass(&validator.ValidationError{}))
+	assert.Equal(t, "hook", errorClass(&HookError{Hook: "PreCreate", Err: errors.New("denied")}))
+	assert.Equal(t, "duplicate_key", errorClass(&WriteError{Err: &DuplicateKeyError{Index: "email_1"}}))
+	assert.Equal(t, "tenancy", errorClass(ErrNoTenant))
+	assert.Equal(t, "invalid_argument", errorClass(ErrEmptyUpdate))
+	assert.Equal(t, "timeout", errorClass(context.DeadlineExceeded))
+	assert.Equal(t, "canceled", errorClass(context.Canceled))
+	assert.Equal(t, "other", errorClass(errors.New("boom")))
+}
+
+func TestPageDocuments(t *testing.T) {
+	assert.Equal(t, int64(0), pageDocuments(nil))
+	assert.Equal(t, int64(10), pageDocuments(&PaginatedResult{Paginator: Paginator{TotalRows: 25, PerPage: 10, Offset: 10}}))
+	assert.Equal(t, int64(5), pageDocuments(&PaginatedResult{Paginator: Paginator{TotalRows: 25, PerPage: 10, Offset: 20}}))
+	assert.Equal(t, int64(0), pageDocuments(&PaginatedResult{Paginator: Paginator{TotalRows: 5, PerPage: 10, Offset: 20}}))
+}
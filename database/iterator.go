@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Iterator decodes the documents of a cursor one at a time, so large results are processed without being loaded
+	// in memory. Each, EachBatch and Map read the whole cursor and close it, an Iterator is used once.
+	Iterator struct {
+		cursor      *mongo.Cursor
+		newDocument func() interface{}
+		workers     int
+	}
+
+	// IteratorOptions configures an Iterator.
+	IteratorOptions struct {
+		// Workers is the number of documents or batches processed concurrently. Defaults to 1, processing them in
+		// order. With more workers, the cursor is read while up to Workers callbacks run.
+		Workers int
+	}
+)
+
+// NewIterator returns an Iterator over cur, decoding every document with Decode into a new value returned by
+// newDocument - eg: func() interface{} { return &User{} }. A nil iteratorOptions processes documents in order.
+//
+//	cur, err := client.FindAll(ctx, "users", filters, nil, nil)
+//	if err != nil { ... }
+//	err = database.NewIterator(cur, func() interface{} { return &User{} }, nil).Each(ctx, func(ctx context.Context, doc interface{}) error {
+//		user := doc.(*User)
+//		...
+//	})
+func NewIterator(cur *mongo.Cursor, newDocument func() interface{}, iteratorOptions *IteratorOptions) *Iterator {
+	workers := 1
+	if iteratorOptions != nil && iteratorOptions.Workers > 1 {
+		workers = iteratorOptions.Workers
+	}
+	return &Iterator{cursor: cur, newDocument: newDocument, workers: workers}
+}
+
+// Each calls fn with every document. It stops at the first error returned by fn, the cursor or Decode, or when ctx is
+// done, and returns it.
+func (it *Iterator) Each(ctx context.Context, fn func(ctx context.Context, doc interface{}) error) error {
+	return it.run(ctx, 1, func(ctx context.Context, docs []interface{}) error {
+		return fn(ctx, docs[0])
+	})
+}
+
+// EachBatch calls fn with the documents in batches of size, the last batch holding the remaining documents. It stops
+// like Each. Batches are not reused, fn may keep them.
+func (it *Iterator) EachBatch(ctx context.Context, size int, fn func(ctx context.Context, docs []interface{}) error) error {
+	if size < 1 {
+		size = 1
+	}
+	return it.run(ctx, size, fn)
+}
+
+// Map sends the value fn returns for every document on the returned channel, or the documents themselves when fn is
+// nil. The channel is closed once the cursor is read, then the error channel receives the error that stopped Map, if
+// any, and is closed. Callers must read the values until the channel is closed or cancel ctx.
+func (it *Iterator) Map(ctx context.Context, fn func(ctx context.Context, doc interface{}) (interface{}, error)) (<-chan interface{}, <-chan error) {
+	values := make(chan interface{})
+	errs := make(chan error, 1)
+
+	go func() {
+		err := it.Each(ctx, func(ctx context.Context, doc interface{}) error {
+			value := doc
+			if fn != nil {
+				var err error
+				if value, err = fn(ctx, doc); err != nil {
+					return err
+				}
+			}
+			select {
+			case values <- value:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(values)
+		if err != nil {
+			errs <- err
+		}
+		close(errs)
+	}()
+
+	return values, errs
+}
+
+// run reads the cursor into batches of size and passes them to fn, concurrently when the Iterator has workers.
+func (it *Iterator) run(ctx context.Context, size int, fn func(ctx context.Context, docs []interface{}) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	//The cursor is closed even when ctx is done, so the server does not keep it open until it times out
+	defer it.cursor.Close(context.Background())
+
+	if it.workers == 1 {
+		return it.read(ctx, size, func(docs []interface{}) error {
+			return fn(ctx, docs)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var failure error
+	fail := func(err error) {
+		once.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+
+	batches := make(chan []interface{})
+	var wg sync.WaitGroup
+	for i := 0; i < it.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for docs := range batches {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, docs); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	err := it.read(ctx, size, func(docs []interface{}) error {
+		select {
+		case batches <- docs:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(batches)
+	wg.Wait()
+
+	if err != nil {
+		fail(err)
+	}
+	return failure
+}
+
+// read decodes the documents of the cursor and passes them to send in batches of size.
+func (it *Iterator) read(ctx context.Context, size int, send func(docs []interface{}) error) error {
+	batch := make([]interface{}, 0, size)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !it.cursor.Next(ctx) {
+			break
+		}
+
+		doc := it.newDocument()
+		if doc == nil || reflect.TypeOf(doc).Kind() != reflect.Ptr {
+			return ErrNotPointer
+		}
+		if err := Decode(it.cursor.Current, doc); err != nil {
+			return err
+		}
+
+		batch = append(batch, doc)
+		if len(batch) == size {
+			if err := send(batch); err != nil {
+				return err
+			}
+			batch = make([]interface{}, 0, size)
+		}
+	}
+	if err := it.cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return send(batch)
+	}
+	return nil
+}
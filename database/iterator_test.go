@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func userCursor(t *testing.T, levels ...interface{}) *mongo.Cursor {
+	docs := make([]interface{}, len(levels))
+	for i, level := range levels {
+		docs[i] = bson.D{bson.E{Key: "first_name", Value: "Joseph"}, bson.E{Key: "level", Value: level}}
+	}
+	cur, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cur
+}
+
+func newUser() interface{} {
+	return &User{}
+}
+
+func TestIterator_Each(t *testing.T) {
+	var levels []int
+	err := NewIterator(userCursor(t, 1, 2, 3), newUser, nil).Each(context.Background(), func(ctx context.Context, doc interface{}) error {
+		levels = append(levels, doc.(*User).Level)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3}, levels)
+
+	//Test Errors Stop Iteration
+	boom := errors.New("boom")
+	calls := 0
+	err = NewIterator(userCursor(t, 1, 2, 3), newUser, nil).Each(context.Background(), func(ctx context.Context, doc interface{}) error {
+		calls++
+		return boom
+	})
+	assert.Equal(t, boom, err)
+	assert.Equal(t, 1, calls)
+
+	//Test Decode Errors Are Returned
+	calls = 0
+	err = NewIterator(userCursor(t, 1, "two", 3), newUser, nil).Each(context.Background(), func(ctx context.Context, doc interface{}) error {
+		calls++
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+
+	err = NewIterator(userCursor(t, 1), func() interface{} { return User{} }, nil).Each(context.Background(), func(ctx context.Context, doc interface{}) error {
+		return nil
+	})
+	assert.Equal(t, ErrNotPointer, err)
+
+	//Test Cancellation Stops Iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = NewIterator(userCursor(t, 1, 2, 3), newUser, nil).Each(ctx, func(ctx context.Context, doc interface{}) error {
+		calls++
+		cancel()
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIterator_EachBatch(t *testing.T) {
+	var batches [][]int
+	err := NewIterator(userCursor(t, 1, 2, 3, 4, 5), newUser, nil).EachBatch(context.Background(), 2, func(ctx context.Context, docs []interface{}) error {
+		var levels []int
+		for _, doc := range docs {
+			levels = append(levels, doc.(*User).Level)
+		}
+		batches = append(batches, levels)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches)
+
+	//Test Workers Process Every Batch
+	var mu sync.Mutex
+	var levels []int
+	var running, maxRunning int32
+	err = NewIterator(userCursor(t, 1, 2, 3, 4, 5, 6, 7), newUser, &IteratorOptions{Workers: 3}).EachBatch(context.Background(), 2, func(ctx context.Context, docs []interface{}) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, doc := range docs {
+			levels = append(levels, doc.(*User).Level)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	sort.Ints(levels)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, levels)
+	assert.True(t, maxRunning <= 3)
+
+	//Test The First Worker Error Is Returned
+	boom := errors.New("boom")
+	err = NewIterator(userCursor(t, 1, 2, 3, 4, 5, 6), newUser, &IteratorOptions{Workers: 2}).EachBatch(context.Background(), 1, func(ctx context.Context, docs []interface{}) error {
+		return boom
+	})
+	assert.Equal(t, boom, err)
+}
+
+func TestIterator_Map(t *testing.T) {
+	values, errs := NewIterator(userCursor(t, 1, 2, 3), newUser, nil).Map(context.Background(), func(ctx context.Context, doc interface{}) (interface{}, error) {
+		return doc.(*User).Level * 10, nil
+	})
+	var mapped []interface{}
+	for value := range values {
+		mapped = append(mapped, value)
+	}
+	assert.Equal(t, []interface{}{10, 20, 30}, mapped)
+	assert.Nil(t, <-errs)
+
+	values, errs = NewIterator(userCursor(t, 1, "two"), newUser, nil).Map(context.Background(), nil)
+	var users []interface{}
+	for value := range values {
+		users = append(users, value)
+	}
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, 1, users[0].(*User).Level)
+	}
+	assert.NotNil(t, <-errs)
+
+	//Test Cancelling Releases Map
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs = NewIterator(userCursor(t, 1, 2, 3), newUser, nil).Map(ctx, nil)
+	<-values
+	cancel()
+	for range values {
+	}
+	assert.Equal(t, context.Canceled, <-errs)
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DefaultSlowQueryThreshold is the Threshold used when SlowQueryOptions does not set one.
+const DefaultSlowQueryThreshold = 100 * time.Millisecond
+
+// Redacted replaces the values of redacted fields in logs and slow queries.
+const Redacted = "[REDACTED]"
+
+type (
+	// Logger is the structured logger of Client. Arguments are alternating keys and values. *slog.Logger satisfies
+	// Logger.
+	Logger interface {
+		DebugContext(ctx context.Context, msg string, args ...interface{})
+		WarnContext(ctx context.Context, msg string, args ...interface{})
+	}
+
+	// LogOptions configures how Client logs.
+	LogOptions struct {
+		// RedactFields are the fields whose values are replaced with Redacted in logged filters and slow queries - eg:
+		// "email". A field matches keys equal to it or ending with it after a dot - eg: "email" matches "owner.email".
+		RedactFields []string
+	}
+
+	// SlowQueryOptions configures slow query detection.
+	SlowQueryOptions struct {
+		// Threshold is the duration from which a call is slow. Defaults to DefaultSlowQueryThreshold.
+		Threshold time.Duration
+		// Explain fetches the query plan of slow calls from the server. It costs an extra round trip per slow call.
+		Explain bool
+		// OnSlowQuery is called with every slow call. When nil, slow calls are logged at warn level.
+		OnSlowQuery func(ctx context.Context, query SlowQuery)
+	}
+
+	// SlowQuery describes a call that took longer than the slow query threshold.
+	SlowQuery struct {
+		Operation
+		Duration  time.Duration
+		Documents int64
+		// Filters are the filters or pipeline the call ran with, redacted with LogOptions.RedactFields.
+		Filters interface{}
+		Err     error
+		// Plan is the queryPlanner explain output when SlowQueryOptions.Explain is set and the call reached the server.
+		// It echoes the filters, so it is redacted with LogOptions.RedactFields too.
+		Plan       bson.Raw
+		ExplainErr error
+	}
+)
+
+// SetLogger makes the Client log every call at debug level with its filters. A nil logger disables logging.
+func (c *Client) SetLogger(logger Logger, logOptions *LogOptions) {
+	if logOptions == nil {
+		logOptions = &LogOptions{}
+	}
+	c.logger = logger
+	c.logOptions = logOptions
+}
+
+// EnableSlowQueries reports calls that take longer than the threshold to OnSlowQuery, or logs them when it is nil.
+func (c *Client) EnableSlowQueries(slowQueryOptions *SlowQueryOptions) {
+	if slowQueryOptions == nil {
+		slowQueryOptions = &SlowQueryOptions{}
+	}
+	if slowQueryOptions.Threshold <= 0 {
+		slowQueryOptions.Threshold = DefaultSlowQueryThreshold
+	}
+	c.slowQueries = slowQueryOptions
+}
+
+// DisableSlowQueries stops slow query detection.
+func (c *Client) DisableSlowQueries() {
+	c.slowQueries = nil
+}
+
+// setCommand records on the instrumented call of ctx the filters it runs with and the command sent to the server,
+// used to log the call and explain it when it is slow.
+func setCommand(ctx context.Context, db *mongo.Database, filters interface{}, command bson.D) {
+	if ctx == nil {
+		return
+	}
+	if cl, ok := ctx.Value(callKey{}).(*call); ok {
+		cl.db = db
+		cl.filters = filters
+		cl.command = command
+	}
+}
+
+// command returns a server command on collection, leaving out the fields with nil values.
+func command(name, collection string, fields ...bson.E) bson.D {
+	cmd := bson.D{bson.E{Key: name, Value: collection}}
+	for _, f := range fields {
+		if f.Value == nil {
+			continue
+		}
+		switch v := reflect.ValueOf(f.Value); v.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if v.IsNil() {
+				continue
+			}
+		}
+		cmd = append(cmd, f)
+	}
+	return cmd
+}
+
+// log logs the finished call and reports it if it is slow.
+func (cl *call) log(result OperationResult) {
+	c := cl.client
+	slow := c.slowQueries != nil && result.Duration >= c.slowQueries.Threshold
+	if c.logger == nil && !slow {
+		return
+	}
+
+	filters := c.redact(cl.filters)
+	if c.logger != nil {
+		c.logger.DebugContext(cl.ctx, "asari: operation", logArgs(cl.op, result, filters)...)
+	}
+	if !slow {
+		return
+	}
+
+	query := SlowQuery{
+		Operation: cl.op,
+		Duration:  result.Duration,
+		Documents: result.Documents,
+		Filters:   filters,
+		Err:       result.Err,
+	}
+	if c.slowQueries.Explain && cl.db != nil && cl.command != nil {
+		query.Plan, query.ExplainErr = explain(cl.ctx, cl.db, cl.command, "queryPlanner")
+		query.Plan = c.redactPlan(query.Plan)
+	}
+
+	if c.slowQueries.OnSlowQuery != nil {
+		c.slowQueries.OnSlowQuery(cl.ctx, query)
+	} else if c.logger != nil {
+		args := logArgs(cl.op, result, filters)
+		if query.Plan != nil {
+			args = append(args, "plan", extJSON(query.Plan))
+		}
+		c.logger.WarnContext(cl.ctx, "asari: slow query", args...)
+	}
+}
+
+// warn logs a misuse of the Client at warn level.
+func (c *Client) warn(ctx context.Context, msg string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.WarnContext(ctx, msg, args...)
+	}
+}
+
+func logArgs(op Operation, result OperationResult, filters interface{}) []interface{} {
+	args := []interface{}{
+		"operation", op.Name,
+		"collection", op.Collection,
+		"database", op.Database,
+		"duration", result.Duration,
+		"documents", result.Documents,
+	}
+	if filters != nil {
+		args = append(args, "filters", extJSON(filters))
+	}
+	if result.Err != nil {
+		args = append(args, "error", result.Err.Error(), "error_type", result.ErrorClass)
+	}
+	return args
+}
+
+// extJSON returns v as relaxed Extended JSON, wrapping values that are not documents.
+func extJSON(v interface{}) string {
+	if out, err := bson.MarshalExtJSON(v, false, false); err == nil {
+		return string(out)
+	}
+	out, err := bson.MarshalExtJSON(bson.D{bson.E{Key: "value", Value: v}}, false, false)
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// redact returns a copy of filters with the values of LogOptions.RedactFields replaced with Redacted.
+func (c *Client) redact(filters interface{}) interface{} {
+	if filters == nil || c.logOptions == nil || len(c.logOptions.RedactFields) == 0 {
+		return filters
+	}
+	return redact(filters, c.logOptions.RedactFields)
+}
+
+// redactPlan returns a copy of explain output with the values of LogOptions.RedactFields replaced with Redacted, at any
+// depth - eg: in parsedQuery, index bounds and the echoed command. Output that cannot be redacted is left out.
+func (c *Client) redactPlan(plan bson.Raw) bson.Raw {
+	if plan == nil || c.logOptions == nil || len(c.logOptions.RedactFields) == 0 {
+		return plan
+	}
+
+	var d bson.D
+	if err := bson.Unmarshal(plan, &d); err != nil {
+		return nil
+	}
+	redacted, err := bson.Marshal(redactD(d, c.logOptions.RedactFields))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redact(v interface{}, fields []string) interface{} {
+	switch t := v.(type) {
+	case []bson.E:
+		return []bson.E(redactD(t, fields))
+	case bson.D:
+		return redactD(t, fields)
+	case bson.M:
+		redacted := bson.M{}
+		for key, value := range t {
+			if redactedField(key, fields) {
+				redacted[key] = Redacted
+			} else {
+				redacted[key] = redact(value, fields)
+			}
+		}
+		return redacted
+	case bson.A:
+		redacted := make(bson.A, len(t))
+		for i, value := range t {
+			redacted[i] = redact(value, fields)
+		}
+		return redacted
+	case []interface{}:
+		return []interface{}(redact(bson.A(t), fields).(bson.A))
+	case mongo.Pipeline:
+		redacted := make(mongo.Pipeline, len(t))
+		for i, stage := range t {
+			redacted[i] = redactD(stage, fields)
+		}
+		return redacted
+	case []bson.D:
+		return []bson.D(redact(mongo.Pipeline(t), fields).(mongo.Pipeline))
+	}
+	return v
+}
+
+func redactD(d []bson.E, fields []string) primitive.D {
+	redacted := make(primitive.D, len(d))
+	for i, e := range d {
+		redacted[i] = bson.E{Key: e.Key, Value: e.Value}
+		if redactedField(e.Key, fields) {
+			redacted[i].Value = Redacted
+		} else {
+			redacted[i].Value = redact(e.Value, fields)
+		}
+	}
+	return redacted
+}
+
+func redactedField(key string, fields []string) bool {
+	for _, field := range fields {
+		if key == field || strings.HasSuffix(key, "."+field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/operator"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+type (
+	logEntry struct {
+		level string
+		msg   string
+		args  map[string]interface{}
+	}
+
+	recordingLogger struct {
+		entries []logEntry
+	}
+)
+
+func (l *recordingLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.add("debug", msg, args)
+}
+
+func (l *recordingLogger) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	l.add("warn", msg, args)
+}
+
+func (l *recordingLogger) add(level, msg string, args []interface{}) {
+	entry := logEntry{level: level, msg: msg, args: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry.args[args[i].(string)] = args[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func disconnectedClient(t *testing.T) *Client {
+	mClient, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return &Client{Connection: mClient.Database("main")}
+}
+
+func TestClient_SetLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	c := disconnectedClient(t)
+	c.SetLogger(logger, &LogOptions{RedactFields: []string{"email"}})
+
+	filters := []bson.E{{Key: "email", Value: "joseph@asari.dev"}, {Key: "age", Value: bson.M{"$gt": 18}}}
+	_, err := c.FindAll(context.Background(), "users", filters, nil, nil)
+	assert.NotNil(t, err)
+
+	if assert.Len(t, logger.entries, 1) {
+		entry := logger.entries[0]
+		assert.Equal(t, "debug", entry.level)
+		assert.Equal(t, "asari: operation", entry.msg)
+		assert.Equal(t, "FindAll", entry.args["operation"])
+		assert.Equal(t, "users", entry.args["collection"])
+		assert.Equal(t, "main", entry.args["database"])
+		assert.Equal(t, `{"email":"[REDACTED]","age":{"$gt":18},"is_deleted":false}`, entry.args["filters"])
+		assert.Equal(t, "other", entry.args["error_type"])
+	}
+
+	update := builder.NewUpdateManyBuilder()
+	update.Add(operator.Set).Add(operator.Set, bson.E{Key: "level", Value: 2})
+	_, err = c.UpdateMany(context.Background(), "users", nil, update, nil)
+	assert.NotNil(t, err)
+	if assert.Len(t, logger.entries, 3) {
+		assert.Equal(t, "warn", logger.entries[1].level)
+		assert.Equal(t, 1, logger.entries[1].args["ignored"])
+		assert.Equal(t, "UpdateMany", logger.entries[2].args["operation"])
+	}
+
+	c.SetLogger(nil, nil)
+	c.FindAll(context.Background(), "users", filters, nil, nil)
+	assert.Len(t, logger.entries, 3)
+}
+
+func TestClient_EnableSlowQueries(t *testing.T) {
+	c := disconnectedClient(t)
+
+	var queries []SlowQuery
+	c.SetLogger(&recordingLogger{}, &LogOptions{RedactFields: []string{"email"}})
+	c.EnableSlowQueries(&SlowQueryOptions{
+		Threshold: time.Nanosecond,
+		Explain:   true,
+		OnSlowQuery: func(ctx context.Context, query SlowQuery) {
+			queries = append(queries, query)
+		},
+	})
+
+	c.CountDocuments(context.Background(), "users", bson.M{"email": "joseph@asari.dev"})
+	if assert.Len(t, queries, 1) {
+		assert.Equal(t, "CountDocuments", queries[0].Name)
+		assert.Equal(t, bson.M{"email": Redacted}, queries[0].Filters)
+		assert.NotNil(t, queries[0].Err)
+		assert.Nil(t, queries[0].Plan)
+		assert.NotNil(t, queries[0].ExplainErr)
+	}
+
+	logger := &recordingLogger{}
+	c.SetLogger(logger, nil)
+	c.EnableSlowQueries(&SlowQueryOptions{Threshold: time.Nanosecond})
+	c.CountDocuments(context.Background(), "users", bson.M{"email": "joseph@asari.dev"})
+	if assert.Len(t, logger.entries, 2) {
+		assert.Equal(t, "warn", logger.entries[1].level)
+		assert.Equal(t, "asari: slow query", logger.entries[1].msg)
+		assert.Equal(t, `{"email":"joseph@asari.dev"}`, logger.entries[1].args["filters"])
+	}
+
+	c.EnableSlowQueries(nil)
+	assert.Equal(t, DefaultSlowQueryThreshold, c.slowQueries.Threshold)
+	c.DisableSlowQueries()
+	assert.Nil(t, c.slowQueries)
+}
+
+func TestRedact(t *testing.T) {
+	fields := []string{"email", "token"}
+
+	assert.Equal(t, []bson.E{{Key: "email", Value: Redacted}, {Key: "name", Value: "Joseph"}},
+		redact([]bson.E{{Key: "email", Value: "joseph@asari.dev"}, {Key: "name", Value: "Joseph"}}, fields))
+	assert.Equal(t, bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "owner.email", Value: Redacted}}, bson.M{"token": Redacted}}}},
+		redact(bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "owner.email", Value: "a@b.c"}}, bson.M{"token": "secret"}}}}, fields))
+	assert.Equal(t, mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "email", Value: Redacted}}}}},
+		redact(mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "email", Value: "a@b.c"}}}}}, fields))
+	assert.Equal(t, "emails", redact("emails", fields))
+}
+
+func TestClient_RedactPlan(t *testing.T) {
+	c := disconnectedClient(t)
+	plan, _ := bson.Marshal(bson.D{{Key: "queryPlanner", Value: bson.D{
+		{Key: "parsedQuery", Value: bson.D{{Key: "$and", Value: bson.A{
+			bson.D{{Key: "email", Value: bson.D{{Key: "$eq", Value: "joseph@asari.dev"}}}},
+			bson.D{{Key: "level", Value: bson.D{{Key: "$gt", Value: 1}}}},
+		}}}},
+		{Key: "winningPlan", Value: bson.D{{Key: "indexBounds", Value: bson.D{{Key: "email", Value: bson.A{`["joseph@asari.dev", "joseph@asari.dev"]`}}}}}},
+	}}})
+
+	assert.Equal(t, bson.Raw(plan), c.redactPlan(plan))
+
+	c.SetLogger(&recordingLogger{}, &LogOptions{RedactFields: []string{"email"}})
+	redacted := c.redactPlan(plan)
+	assert.NotContains(t, redacted.String(), "joseph@asari.dev")
+	assert.Equal(t, Redacted, redacted.Lookup("queryPlanner", "winningPlan", "indexBounds", "email").StringValue())
+	assert.Equal(t, int32(1), redacted.Lookup("queryPlanner", "parsedQuery", "$and").Array().Index(1).Value().Document().Lookup("level", "$gt").Int32())
+	assert.Nil(t, c.redactPlan(bson.Raw{0}))
+}
+
+func TestCommand(t *testing.T) {
+	var skip *int64
+	assert.Equal(t, bson.D{{Key: "find", Value: "users"}, {Key: "limit", Value: 1}},
+		command("find", "users", bson.E{Key: "projection", Value: nil}, bson.E{Key: "skip", Value: skip}, bson.E{Key: "limit", Value: 1}))
+}
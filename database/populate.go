@@ -0,0 +1,352 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+)
+
+// PopulateTag is the struct tag that declares a relation on a document field.
+const PopulateTag = "populate"
+
+type (
+	// RelationError is returned when a relation of Document cannot be populated. Err is ErrUnknownRelation or
+	// ErrInvalidRelation and Reason explains why an invalid relation is rejected.
+	RelationError struct {
+		Document string
+		Relation string
+		Reason   string
+		Err      error
+	}
+
+	populateKey struct{}
+
+	relation struct {
+		collection string
+		localIndex []int
+		fieldIndex []int
+		fieldType  reflect.Type
+	}
+)
+
+func (e *RelationError) Error() string {
+	if e.Err == ErrUnknownRelation {
+		return fmt.Sprintf("asari: %s has no relation named %s", e.Document, e.Relation)
+	}
+	return fmt.Sprintf("asari: invalid relation %s on %s: %s", e.Relation, e.Document, e.Reason)
+}
+
+func (e *RelationError) Unwrap() error {
+	return e.Err
+}
+
+// WithPopulate returns a context that makes FindOne, FindOneByID, FindOneByField and DecodeAll populate the named
+// relations of the documents they decode. Relations are named after the Go field holding the referenced documents.
+// Relations a document does not declare are skipped for it, and reads the Client makes for itself - eg: revisions and
+// audit entries - never populate.
+func WithPopulate(ctx context.Context, relations ...string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, populateKey{}, relations)
+}
+
+func populateFromContext(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	relations, _ := ctx.Value(populateKey{}).([]string)
+	return relations
+}
+
+// withoutPopulate returns ctx without the relations named with WithPopulate.
+func withoutPopulate(ctx context.Context) context.Context {
+	if populateFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, populateKey{}, []string(nil))
+}
+
+// populateContext populates the relations named with WithPopulate that target declares.
+func (c *Client) populateContext(ctx context.Context, target interface{}) error {
+	relations := populateFromContext(ctx)
+	if len(relations) == 0 || reflect.ValueOf(target).Kind() != reflect.Ptr {
+		return nil
+	}
+
+	_, docType := populateTargets(reflect.ValueOf(target))
+	if docType == nil {
+		return nil
+	}
+	declared, err := relationsOf(docType)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, name := range relations {
+		if _, ok := declared[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return c.Populate(ctx, target, names...)
+}
+
+// Populate loads the documents referenced by the named relations of target and sets them on the relation fields.
+// target is a pointer to a document or a pointer to a slice of documents (or document pointers).
+// Each relation is loaded with a single $in query no matter how many documents target holds. Soft deleted references
+// are not loaded.
+//
+// Relations are declared on a field that is not stored with the bson key of the field holding the reference and the
+// collection the referenced documents live in:
+// OwnerID primitive.ObjectID `bson:"owner_id"`
+// Owner *User `bson:"-" populate:"owner_id,users"`
+// Reference fields can be primitive.ObjectID or []primitive.ObjectID and relation fields a struct, a pointer to a
+// struct or a slice of either.
+func (c *Client) Populate(ctx context.Context, target interface{}, relations ...string) error {
+	if err := c.validateDocumentKind(target); err != nil {
+		return err
+	}
+	if len(relations) == 0 {
+		return nil
+	}
+
+	docs, docType := populateTargets(reflect.ValueOf(target))
+	if docType == nil {
+		return ErrPopulateTarget
+	}
+
+	declared, err := relationsOf(docType)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range relations {
+		r, ok := declared[name]
+		if !ok {
+			return &RelationError{Document: docType.Name(), Relation: name, Err: ErrUnknownRelation}
+		}
+		if err := c.populateRelation(ctx, r, docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeAll decodes every document left in cur into results, which must be a pointer to a slice, and closes the cursor.
+// Documents are decoded with Decode so schema upgrades apply, and relations named with WithPopulate are populated.
+func (c *Client) DecodeAll(ctx context.Context, cur *mongo.Cursor, results interface{}) error {
+	defer cur.Close(context.Background())
+
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return ErrNotSlice
+	}
+
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	for cur.Next(ctx) {
+		elem := reflect.New(derefType(elemType))
+		if err := Decode(cur.Current, elem.Interface()); err != nil {
+			return err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	rv.Elem().Set(slice)
+
+	return c.populateContext(ctx, results)
+}
+
+func (c *Client) populateRelation(ctx context.Context, r relation, docs []reflect.Value) error {
+	var ids []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{}
+	for _, doc := range docs {
+		for _, id := range referencedIDs(doc.FieldByIndex(r.localIndex)) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	filters := queryfilter.New().
+		AddFilter(bson.E{Key: "_id", Value: bson.D{bson.E{Key: operator.In, Value: ids}}}).
+		GetFilters()
+	cur, err := c.FindAll(ctx, r.collection, filters, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.Background())
+
+	refType := derefType(elemOrSelf(r.fieldType))
+	loaded := map[primitive.ObjectID]reflect.Value{}
+	for cur.Next(ctx) {
+		ref := reflect.New(refType)
+		if err := Decode(cur.Current, ref.Interface()); err != nil {
+			return err
+		}
+		if id, ok := cur.Current.Lookup("_id").ObjectIDOK(); ok {
+			loaded[id] = ref
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		field := doc.FieldByIndex(r.fieldIndex)
+		refs := referencedIDs(doc.FieldByIndex(r.localIndex))
+
+		if r.fieldType.Kind() != reflect.Slice {
+			if len(refs) > 0 {
+				if ref, ok := loaded[refs[0]]; ok {
+					field.Set(asType(ref, r.fieldType))
+				}
+			}
+			continue
+		}
+
+		values := reflect.MakeSlice(r.fieldType, 0, len(refs))
+		for _, id := range refs {
+			if ref, ok := loaded[id]; ok {
+				values = reflect.Append(values, asType(ref, r.fieldType.Elem()))
+			}
+		}
+		field.Set(values)
+	}
+	return nil
+}
+
+func relationsOf(t reflect.Type) (map[string]relation, error) {
+	locals := map[string][]int{}
+	for _, f := range document.Fields(t) {
+		locals[f.Name] = f.Index
+	}
+
+	docName := derefType(t).Name()
+	relations := map[string]relation{}
+	var walk func(t reflect.Type, index []int) error
+	walk = func(t reflect.Type, index []int) error {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			fieldIndex := append(append([]int{}, index...), i)
+
+			if sf.Anonymous && strings.Contains(sf.Tag.Get("bson"), "inline") && derefType(sf.Type).Kind() == reflect.Struct {
+				if err := walk(derefType(sf.Type), fieldIndex); err != nil {
+					return err
+				}
+				continue
+			}
+
+			tag, ok := sf.Tag.Lookup(PopulateTag)
+			if !ok {
+				continue
+			}
+
+			parts := strings.Split(tag, ",")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return invalidRelation(docName, sf.Name, `populate tag must be "<reference field>,<collection>"`)
+			}
+			localIndex, ok := locals[parts[0]]
+			if !ok {
+				return invalidRelation(docName, sf.Name, "references unknown field "+parts[0])
+			}
+			if derefType(elemOrSelf(sf.Type)).Kind() != reflect.Struct {
+				return invalidRelation(docName, sf.Name, "relation field must hold documents")
+			}
+
+			relations[sf.Name] = relation{
+				collection: parts[1],
+				localIndex: localIndex,
+				fieldIndex: fieldIndex,
+				fieldType:  sf.Type,
+			}
+		}
+		return nil
+	}
+
+	return relations, walk(derefType(t), nil)
+}
+
+func invalidRelation(docName, name, reason string) error {
+	return &RelationError{Document: docName, Relation: name, Reason: reason, Err: ErrInvalidRelation}
+}
+
+func populateTargets(v reflect.Value) ([]reflect.Value, reflect.Type) {
+	v = v.Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{v}, v.Type()
+	case reflect.Slice:
+		elemType := derefType(v.Type().Elem())
+		if elemType.Kind() != reflect.Struct {
+			return nil, nil
+		}
+		docs := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			docs = append(docs, elem)
+		}
+		return docs, elemType
+	}
+	return nil, nil
+}
+
+func referencedIDs(v reflect.Value) []primitive.ObjectID {
+	switch value := v.Interface().(type) {
+	case primitive.ObjectID:
+		if value != primitive.NilObjectID {
+			return []primitive.ObjectID{value}
+		}
+	case *primitive.ObjectID:
+		if value != nil && *value != primitive.NilObjectID {
+			return []primitive.ObjectID{*value}
+		}
+	case []primitive.ObjectID:
+		return value
+	}
+	return nil
+}
+
+func asType(ptr reflect.Value, t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return ptr
+	}
+	return ptr.Elem()
+}
+
+func elemOrSelf(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		return t.Elem()
+	}
+	return t
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
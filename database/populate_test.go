@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+const PetCollection string = "pets"
+
+type Pet struct {
+	document.Base `bson:",inline"`
+	Name          string               `bson:"name"`
+	OwnerID       primitive.ObjectID   `bson:"owner_id"`
+	Owner         *User                `bson:"-" populate:"owner_id,users"`
+	FriendIDs     []primitive.ObjectID `bson:"friend_ids"`
+	Friends       []User               `bson:"-" populate:"friend_ids,users"`
+}
+
+type BadRelationPet struct {
+	document.Base `bson:",inline"`
+	Owner         *User `bson:"-" populate:"owner_id,users"`
+}
+
+func TestRelationsOf(t *testing.T) {
+	relations, err := relationsOf(reflect.TypeOf(Pet{}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(relations))
+	assert.Equal(t, "users", relations["Owner"].collection)
+	assert.Equal(t, "users", relations["Friends"].collection)
+
+	_, err = relationsOf(reflect.TypeOf(BadRelationPet{}))
+	assert.True(t, errors.Is(err, ErrInvalidRelation), err)
+	assert.Equal(t, "BadRelationPet", err.(*RelationError).Document)
+	assert.Equal(t, "Owner", err.(*RelationError).Relation)
+
+	//Test Unknown Relations
+	err = disconnectedClient(t).Populate(nil, &Pet{}, "Vet")
+	assert.True(t, errors.Is(err, ErrUnknownRelation), err)
+	assert.Equal(t, "asari: Pet has no relation named Vet", err.Error())
+	assert.Equal(t, ErrPopulateTarget, disconnectedClient(t).Populate(nil, &[]int{}, "Owner"))
+}
+
+func TestClient_PopulateContext(t *testing.T) {
+	c := disconnectedClient(t)
+	ctx := WithPopulate(context.Background(), "Owner")
+
+	//Test Relations Are Skipped On Documents That Do Not Declare Them
+	assert.Nil(t, c.populateContext(ctx, &Revision{}))
+	assert.Nil(t, c.populateContext(ctx, &[]AuditEntry{}))
+	assert.Nil(t, c.populateContext(ctx, &Pet{}))
+
+	//Test Internal Reads Drop The Relations
+	assert.Nil(t, populateFromContext(withoutPopulate(ctx)))
+	assert.Equal(t, []string{"Owner"}, populateFromContext(ctx))
+}
+
+func TestClient_Populate(t *testing.T) {
+	joseph := &User{FirstName: "Joseph", LastName: "Cobhams"}
+	joseph.Setup()
+	TestClient.SaveDocument(nil, UserCollection, joseph)
+
+	asari := &User{FirstName: "Asari", LastName: "Cobhams"}
+	asari.Setup()
+	TestClient.SaveDocument(nil, UserCollection, asari)
+
+	rex := &Pet{Name: "Rex", OwnerID: joseph.ID, FriendIDs: []primitive.ObjectID{asari.ID, joseph.ID}}
+	rex.Setup()
+	TestClient.SaveDocument(nil, PetCollection, rex)
+
+	fido := &Pet{Name: "Fido", OwnerID: asari.ID}
+	fido.Setup()
+	TestClient.SaveDocument(nil, PetCollection, fido)
+
+	//Test FindOne Populates Relations From The Context
+	var pet Pet
+	ctx := WithPopulate(context.Background(), "Owner", "Friends")
+	err := TestClient.FindOneByID(ctx, PetCollection, rex.ID, nil, &pet)
+	assert.Nil(t, err)
+	if assert.NotNil(t, pet.Owner) {
+		assert.Equal(t, "Joseph", pet.Owner.FirstName)
+	}
+	if assert.Equal(t, 2, len(pet.Friends)) {
+		assert.Equal(t, "Asari", pet.Friends[0].FirstName)
+		assert.Equal(t, "Joseph", pet.Friends[1].FirstName)
+	}
+
+	//Test DecodeAll Populates Every Document
+	cur, err := TestClient.FindAll(ctx, PetCollection, queryfilter.New().GetFilters(), nil, nil)
+	assert.Nil(t, err)
+	var pets []*Pet
+	assert.Nil(t, TestClient.DecodeAll(ctx, cur, &pets))
+	if assert.Equal(t, 2, len(pets)) {
+		assert.Equal(t, "Asari", pets[0].Owner.FirstName)
+		assert.Equal(t, "Joseph", pets[1].Owner.FirstName)
+		assert.Empty(t, pets[0].Friends)
+	}
+
+	//Test Soft Deleted References Are Not Loaded
+	TestClient.SoftDeleteDocument(nil, UserCollection, asari)
+	pet = Pet{}
+	assert.Nil(t, TestClient.FindOneByID(nil, PetCollection, fido.ID, nil, &pet))
+	assert.Nil(t, pet.Owner)
+	assert.Nil(t, TestClient.Populate(nil, &pet, "Owner"))
+	assert.Nil(t, pet.Owner)
+
+	//Test Unknown Relations
+	assert.Error(t, TestClient.Populate(nil, &pet, "Vet"))
+
+	tearDown()
+	TestClient.Connection.Collection(PetCollection).DeleteMany(nil, bson.M{})
+}
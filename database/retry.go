@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math/rand"
+	"time"
+)
+
+// Retry defaults used when RetryOptions does not set them.
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBackoff    = 50 * time.Millisecond
+	DefaultMaxRetryBackoff = 2 * time.Second
+)
+
+// DefaultRetryableLabels are the error labels retried when RetryOptions does not set RetryableLabels.
+var DefaultRetryableLabels = []string{"NetworkError", "RetryableWriteError"}
+
+// DefaultRetryableCodes are the server error codes retried when RetryOptions does not set RetryableCodes. They are
+// returned while a replica set elects a new primary or a server shuts down.
+var DefaultRetryableCodes = []int{
+	6,     //HostUnreachable
+	7,     //HostNotFound
+	89,    //NetworkTimeout
+	91,    //ShutdownInProgress
+	189,   //PrimarySteppedDown
+	262,   //ExceededTimeLimit
+	9001,  //SocketException
+	10107, //NotWritablePrimary
+	11600, //InterruptedAtShutdown
+	11602, //InterruptedDueToReplStateChange
+	13435, //NotPrimaryNoSecondaryOk
+	13436, //NotPrimaryOrSecondary
+}
+
+type (
+	// RetryOptions configures how Client retries calls failing with transient errors.
+	// Reads are retried, as are the idempotent writes of SaveDocument, InsertDocuments, SoftDeleteDocument,
+	// RestoreDocument and HardDeleteDocument. UpdateMany and aggregations writing with $out or $merge are never
+	// retried. Calls made in a transaction are not retried either, the transaction is retried as a whole by the driver.
+	// Only the request to the server is retried, document hooks run once per call.
+	RetryOptions struct {
+		// MaxAttempts is the number of times a call is tried, including the first attempt. Defaults to
+		// DefaultRetryAttempts.
+		MaxAttempts int
+		// Backoff is the delay before the first retry, doubled for every following retry up to MaxBackoff.
+		// Every delay is picked at random between half and all of its value. Defaults to DefaultRetryBackoff.
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		// RetryableLabels are the error labels making an error retryable. Defaults to DefaultRetryableLabels.
+		RetryableLabels []string
+		// RetryableCodes are the server error codes making an error retryable. Defaults to DefaultRetryableCodes.
+		RetryableCodes []int
+		// OnRetry is called before every retry.
+		OnRetry func(ctx context.Context, retry Retry)
+	}
+
+	// Retry describes a retry of a call that failed with a transient error.
+	Retry struct {
+		Operation
+		// Attempt is the attempt about to be made, starting at 2.
+		Attempt int
+		Delay   time.Duration
+		// Err is the error of the previous attempt.
+		Err error
+	}
+)
+
+// EnableRetries retries calls failing with transient errors. A nil retryOptions uses the defaults.
+// retryOptions is copied, changing it afterwards has no effect.
+func (c *Client) EnableRetries(retryOptions *RetryOptions) {
+	if retryOptions == nil {
+		retryOptions = &RetryOptions{}
+	}
+	copied := *retryOptions
+	retryOptions = &copied
+	if retryOptions.MaxAttempts <= 0 {
+		retryOptions.MaxAttempts = DefaultRetryAttempts
+	}
+	if retryOptions.Backoff <= 0 {
+		retryOptions.Backoff = DefaultRetryBackoff
+	}
+	if retryOptions.MaxBackoff <= 0 {
+		retryOptions.MaxBackoff = DefaultMaxRetryBackoff
+	}
+	if retryOptions.RetryableLabels == nil {
+		retryOptions.RetryableLabels = DefaultRetryableLabels
+	}
+	if retryOptions.RetryableCodes == nil {
+		retryOptions.RetryableCodes = DefaultRetryableCodes
+	}
+	c.retries = retryOptions
+}
+
+// DisableRetries stops retrying calls.
+func (c *Client) DisableRetries() {
+	c.retries = nil
+}
+
+// retry runs fn until it succeeds, fails with an error that is not retryable or runs out of attempts. fn must only
+// make an idempotent request to the server. Retries are added to the instrumented call of ctx.
+func (c *Client) retry(ctx context.Context, fn func() error) error {
+	retries := c.retries
+	err := fn()
+	if retries == nil || err == nil || mongo.SessionFromContext(ctx) != nil {
+		return err
+	}
+
+	cl, _ := ctx.Value(callKey{}).(*call)
+	for attempt := 2; attempt <= retries.MaxAttempts && retries.retryable(err); attempt++ {
+		retry := Retry{Attempt: attempt, Delay: retries.delay(attempt), Err: err}
+		if cl != nil {
+			cl.retries++
+			retry.Operation = cl.op
+		}
+		if retries.OnRetry != nil {
+			retries.OnRetry(ctx, retry)
+		}
+
+		timer := time.NewTimer(retry.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// retryInsert is retry for inserts. A retried insert failing on the _id index was written by an earlier attempt whose
+// reply was lost, it succeeded.
+func (c *Client) retryInsert(ctx context.Context, fn func() error) error {
+	attempts := 0
+	return c.retry(ctx, func() error {
+		attempts++
+		err := fn()
+		var dke *DuplicateKeyError
+		if attempts > 1 && errors.As(duplicateKeyError(err), &dke) && dke.Index == "_id_" {
+			return nil
+		}
+		return err
+	})
+}
+
+// retryDelete is retry for deletes. A retried delete matching nothing after an earlier attempt reached the server was
+// written by that attempt, it deleted the document. Attempts failing before reaching the server deleted nothing.
+func (c *Client) retryDelete(ctx context.Context, fn func() (*mongo.DeleteResult, error)) (*mongo.DeleteResult, error) {
+	reached := false
+	var result *mongo.DeleteResult
+	err := c.retry(ctx, func() (err error) {
+		result, err = fn()
+		if err != nil && reachedServer(err) {
+			reached = true
+		}
+		return err
+	})
+	if err == nil && reached && result.DeletedCount == 0 {
+		result.DeletedCount = 1
+	}
+	return result, err
+}
+
+// reachedServer reports whether a failed write is known to have been applied by the server: its write concern failed
+// or the server labelled it retryable.
+func reachedServer(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) && writeException.WriteConcernError != nil {
+		return true
+	}
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorLabel("RetryableWriteError")
+}
+
+func (o *RetryOptions) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var serverError mongo.ServerError
+	if !errors.As(err, &serverError) {
+		return false
+	}
+	for _, label := range o.RetryableLabels {
+		if serverError.HasErrorLabel(label) {
+			return true
+		}
+	}
+	for _, code := range o.RetryableCodes {
+		if serverError.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the jittered backoff before attempt.
+func (o *RetryOptions) delay(attempt int) time.Duration {
+	backoff := o.Backoff
+	for i := 2; i < attempt && backoff < o.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.MaxBackoff {
+		backoff = o.MaxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half <= 0 {
+		return backoff
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retryablePipeline reports whether an aggregation can be retried, those writing their results cannot.
+func retryablePipeline(pipeline mongo.Pipeline) bool {
+	for _, stage := range pipeline {
+		for _, e := range stage {
+			if e.Key == "$out" || e.Key == "$merge" {
+				return false
+			}
+		}
+	}
+	return true
+}
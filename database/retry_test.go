@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+func TestClient_Retry(t *testing.T) {
+	networkError := mongo.CommandError{Code: 6, Message: "connection reset", Labels: []string{"NetworkError"}}
+	c := &Client{}
+
+	var retries []Retry
+	c.EnableRetries(&RetryOptions{
+		Backoff: time.Millisecond,
+		OnRetry: func(ctx context.Context, retry Retry) {
+			retries = append(retries, retry)
+		},
+	})
+	metrics := &recordingMetrics{}
+	c.SetMetrics(metrics)
+
+	attempts := 0
+	ctx, call := c.instrument(context.Background(), "FindOne", "users")
+	err := c.retry(ctx, func() error {
+		attempts++
+		if attempts < 3 {
+			return networkError
+		}
+		return nil
+	})
+	call.end(1, err)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+	if assert.Len(t, retries, 2) {
+		assert.Equal(t, "FindOne", retries[0].Name)
+		assert.Equal(t, 2, retries[0].Attempt)
+		assert.Equal(t, networkError, retries[0].Err)
+		assert.Equal(t, 3, retries[1].Attempt)
+	}
+	assert.Equal(t, 2, metrics.results[0].Retries)
+
+	//Test Attempts Are Limited
+	attempts = 0
+	err = c.retry(context.Background(), func() error {
+		attempts++
+		return networkError
+	})
+	assert.Equal(t, networkError, err)
+	assert.Equal(t, DefaultRetryAttempts, attempts)
+
+	//Test Other Errors Are Not Retried
+	attempts = 0
+	err = c.retry(context.Background(), func() error {
+		attempts++
+		return ErrNotFound
+	})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 1, attempts)
+
+	//Test Retried Inserts Written By An Earlier Attempt Succeed
+	attempts = 0
+	err = c.retryInsert(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return networkError
+		}
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+			Code:    11000,
+			Message: "E11000 duplicate key error collection: main.users index: _id_ dup key: { _id: 1 }",
+		}}}
+	})
+	assert.Nil(t, err)
+
+	//Test Retried Deletes Written By An Earlier Attempt Succeed
+	attempts = 0
+	result, err := c.retryDelete(context.Background(), func() (*mongo.DeleteResult, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 91, Message: "shutting down"}}
+		}
+		return &mongo.DeleteResult{}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, int64(1), result.DeletedCount)
+
+	//Test Deletes Failing Before Reaching The Server Return The Real Count
+	attempts = 0
+	result, err = c.retryDelete(context.Background(), func() (*mongo.DeleteResult, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, networkError
+		}
+		return &mongo.DeleteResult{}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, int64(0), result.DeletedCount)
+
+	result, err = c.retryDelete(context.Background(), func() (*mongo.DeleteResult, error) {
+		return &mongo.DeleteResult{}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.DeletedCount)
+
+	c.DisableRetries()
+	attempts = 0
+	c.retry(context.Background(), func() error {
+		attempts++
+		return networkError
+	})
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryOptions(t *testing.T) {
+	c := &Client{}
+	retryOptions := &RetryOptions{RetryableLabels: []string{"TransientTransactionError"}}
+	c.EnableRetries(retryOptions)
+	retries := c.retries
+	assert.Equal(t, 0, retryOptions.MaxAttempts)
+	assert.Nil(t, retryOptions.RetryableCodes)
+
+	assert.True(t, retries.retryable(mongo.CommandError{Labels: []string{"TransientTransactionError"}}))
+	assert.False(t, retries.retryable(mongo.CommandError{Labels: []string{"NetworkError"}}))
+	assert.True(t, retries.retryable(mongo.CommandError{Code: 189}))
+	assert.True(t, retries.retryable(&WriteError{Err: mongo.CommandError{Code: 10107}}))
+	assert.False(t, retries.retryable(errors.New("boom")))
+	assert.False(t, retries.retryable(context.DeadlineExceeded))
+
+	for attempt := 2; attempt <= 10; attempt++ {
+		delay := retries.delay(attempt)
+		assert.True(t, delay >= DefaultRetryBackoff/2)
+		assert.True(t, delay <= DefaultMaxRetryBackoff)
+	}
+	assert.True(t, retries.delay(8) >= DefaultMaxRetryBackoff/2)
+
+	assert.True(t, retryablePipeline(mongo.Pipeline{{{Key: "$match", Value: nil}}}))
+	assert.False(t, retryablePipeline(mongo.Pipeline{{{Key: "$match", Value: nil}}, {{Key: "$out", Value: "archive"}}}))
+}
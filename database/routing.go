@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type (
+	databaseKey struct{}
+
+	// DatabaseResolver returns the name of the database an operation made with ctx runs against. An empty name runs
+	// it against the Client's database.
+	DatabaseResolver func(ctx context.Context) string
+)
+
+// WithDatabase returns a context naming the database the operations made with it run against when the Client resolves
+// databases with DatabaseFromContext.
+func WithDatabase(ctx context.Context, name string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, databaseKey{}, name)
+}
+
+// DatabaseFromContext returns the database name set with WithDatabase or an empty string if there is none.
+// It is a DatabaseResolver - eg: client.SetDatabaseResolver(database.DatabaseFromContext)
+func DatabaseFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(databaseKey{}).(string)
+	return name
+}
+
+// DB returns a view of the Client bound to another database on the same connection. Views share the connection pool
+// and the Client's configuration except its DatabaseResolver, and every Client method works on them.
+func (c *Client) DB(name string) *Client {
+	view := *c
+	view.Connection = c.Connection.Client().Database(name)
+	view.resolver = nil
+	return &view
+}
+
+// SetDatabaseResolver makes the Client pick the database of each operation with resolver. Pass nil to always use the
+// Client's database. Tenants with their own database (see TenancyOptions.DatabaseName) are not resolved.
+func (c *Client) SetDatabaseResolver(resolver DatabaseResolver) {
+	c.resolver = resolver
+}
+
+// Database returns the database the operations made with ctx run against, picked by the DatabaseResolver or the
+// tenancy of the Client.
+func (c *Client) Database(ctx context.Context) (*mongo.Database, error) {
+	return c.database(ctx)
+}
+
+// resolve returns the database the resolver picks for ctx.
+func (c *Client) resolve(ctx context.Context) *mongo.Database {
+	if c.resolver == nil {
+		return c.Connection
+	}
+	if name := c.resolver(ctx); name != "" && name != c.Connection.Name() {
+		return c.Connection.Client().Database(name)
+	}
+	return c.Connection
+}
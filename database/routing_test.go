@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+)
+
+func TestWithDatabase(t *testing.T) {
+	assert.Equal(t, "", DatabaseFromContext(nil))
+	assert.Equal(t, "reports", DatabaseFromContext(WithDatabase(nil, "reports")))
+}
+
+func TestClient_DB(t *testing.T) {
+	mClient, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	c := &Client{Connection: mClient.Database("main")}
+	c.EnableAudit(nil)
+	c.SetDatabaseResolver(DatabaseFromContext)
+
+	view := c.DB("reports")
+	assert.Equal(t, "reports", view.Connection.Name())
+	assert.Equal(t, mClient, view.Connection.Client())
+	assert.Equal(t, c.audit, view.audit)
+	assert.Nil(t, view.resolver)
+	assert.Equal(t, "main", c.Connection.Name())
+
+	assert.Equal(t, "main", c.resolve(context.Background()).Name())
+	assert.Equal(t, "reports", c.resolve(WithDatabase(nil, "reports")).Name())
+	assert.Equal(t, "reports", view.resolve(WithDatabase(nil, "billing")).Name())
+}
+
+func TestClient_DBView(t *testing.T) {
+	view := TestClient.DB(TestClient.Connection.Name() + "_view")
+	defer view.Connection.Drop(nil)
+
+	user := &User{FirstName: "Joseph"}
+	user.Setup()
+	_, err := view.SaveDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+
+	assert.Nil(t, view.FindOneByID(nil, UserCollection, user.ID, nil, &User{}))
+	assert.Equal(t, ErrNotFound, TestClient.FindOneByID(nil, UserCollection, user.ID, nil, &User{}))
+
+	//Test The Resolver Routes Calls To The View's Database
+	c := &Client{Connection: TestClient.Connection}
+	c.SetDatabaseResolver(DatabaseFromContext)
+	count, err := c.CountDocuments(WithDatabase(nil, view.Connection.Name()), UserCollection, bson.D{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ValidationLevelOff      = "off"
+	ValidationLevelStrict   = "strict"
+	ValidationLevelModerate = "moderate"
+
+	ValidationActionError = "error"
+	ValidationActionWarn  = "warn"
+)
+
+// SyncSchemaValidator generates a $jsonSchema from doc (see schema.Generate) and applies it as the collection's
+// validator. The collection is created if it does not exist, otherwise collMod updates the existing validator.
+// level is one of the ValidationLevel* values and action one of the ValidationAction* values.
+// Use ValidationLevelModerate to keep accepting updates to existing documents that do not yet match the schema.
+func (c *Client) SyncSchemaValidator(ctx context.Context, collection string, doc interface{}, level, action string) (bson.M, error) {
+	if err := c.validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	jsonSchema, err := schema.Generate(doc)
+	if err != nil {
+		return nil, err
+	}
+	validator := bson.M{operator.JSONSchema: jsonSchema}
+
+	db, err := c.collectionDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := db.ListCollectionNames(ctx, bson.D{bson.E{Key: "name", Value: collection}})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		opts := options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel(level).
+			SetValidationAction(action)
+		return jsonSchema, db.CreateCollection(ctx, collection, opts)
+	}
+
+	command := bson.D{
+		bson.E{Key: "collMod", Value: collection},
+		bson.E{Key: "validator", Value: validator},
+		bson.E{Key: "validationLevel", Value: level},
+		bson.E{Key: "validationAction", Value: action},
+	}
+	return jsonSchema, db.RunCommand(ctx, command).Err()
+}
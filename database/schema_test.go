@@ -0,0 +1,37 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+const SchemaCollection string = "schema_users"
+
+func TestClient_SyncSchemaValidator(t *testing.T) {
+	//Test error returned if document is not a pointer
+	_, err := TestClient.SyncSchemaValidator(nil, SchemaCollection, User{}, ValidationLevelStrict, ValidationActionError)
+	assert.Error(t, err)
+
+	//Test Collection Is Created With The Validator
+	s, err := TestClient.SyncSchemaValidator(nil, SchemaCollection, &User{}, ValidationLevelStrict, ValidationActionError)
+	assert.Nil(t, err)
+	assert.Equal(t, "object", s["bsonType"])
+
+	_, err = TestClient.Connection.Collection(SchemaCollection).InsertOne(nil, bson.M{"first_name": 1})
+	assert.Error(t, err)
+
+	user := &User{FirstName: "Joseph", LastName: "Cobhams", Email: "asari@gmail.com"}
+	user.Setup()
+	_, err = TestClient.SaveDocument(nil, SchemaCollection, user)
+	assert.Nil(t, err)
+
+	//Test Existing Collections Are Updated
+	_, err = TestClient.SyncSchemaValidator(nil, SchemaCollection, &User{}, ValidationLevelModerate, ValidationActionWarn)
+	assert.Nil(t, err)
+
+	_, err = TestClient.Connection.Collection(SchemaCollection).InsertOne(nil, bson.M{"first_name": 1})
+	assert.Nil(t, err)
+
+	TestClient.Connection.Collection(SchemaCollection).Drop(nil)
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store holds the document operations of Client. Depend on Store instead of *Client to swap in another
+// implementation - eg: the in-memory memstore.Client in unit tests.
+type Store interface {
+	FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) error
+	FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) error
+	FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) error
+	FindPaginated(ctx context.Context, collection string, pageOptions PageOpts, filters []bson.E, projection interface{}, sort bson.D) (*PaginatedResult, error)
+	FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) error
+	FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (*mongo.Cursor, error)
+	FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (*mongo.Cursor, error)
+	DecodeAll(ctx context.Context, cur *mongo.Cursor, results interface{}) error
+	SaveDocument(ctx context.Context, collection string, doc interface{}) (interface{}, error)
+	UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error)
+	CountDocuments(ctx context.Context, collection string, filters interface{}) (int, error)
+	SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error)
+	HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.DeleteResult, error)
+	RestoreDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error)
+	Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+// BatchInserter is implemented by stores that insert many new documents at once. See Client.InsertDocuments
+type BatchInserter interface {
+	InsertDocuments(ctx context.Context, collection string, docs []interface{}) error
+}
+
+var (
+	_ Store         = (*Client)(nil)
+	_ BatchInserter = (*Client)(nil)
+)
@@ -0,0 +1,379 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrNoTenant is returned by every operation of a Client with tenancy enabled when the context carries no tenant.
+	ErrNoTenant = errors.New("asari: tenancy is enabled but the context carries no tenant")
+	// ErrCrossTenant is returned when a write targets a document or field of another tenant.
+	ErrCrossTenant = errors.New("asari: cross tenant write rejected")
+	// ErrNotTenantScoped is returned when a document saved or deleted with tenancy enabled does not embed document.Tenant.
+	ErrNotTenantScoped = errors.New("asari: documents must embed document.Tenant when tenancy is enabled")
+	// ErrUnscopedFilters is returned by CountDocuments for filters of a type tenancy cannot scope.
+	ErrUnscopedFilters = errors.New("asari: tenancy cannot scope filters of this type")
+	// ErrUnscopedStage is returned when an aggregation stage reading another collection cannot be scoped to the tenant.
+	ErrUnscopedStage = errors.New("asari: tenancy cannot scope aggregation stage")
+)
+
+type (
+	tenantKey struct{}
+
+	// tenantExemption is stored under tenantKey by WithoutTenant.
+	tenantExemption struct{}
+
+	TenancyOptions struct {
+		// DatabaseName maps a tenant to the database holding its documents. When set, each tenant gets its own
+		// database instead of sharing collections scoped by document.TenantField.
+		DatabaseName func(tenant string) string
+	}
+)
+
+// WithTenant returns a context scoping the operations made with it to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// WithoutTenant returns a context whose operations are not scoped to a tenant when tenancy is enabled - eg: for system
+// collections shared by every tenant like migration records, or jobs working across tenants. Documents saved with it are
+// neither stamped nor checked and need not embed document.Tenant. Tenants with their own database use the Client's
+// database instead.
+func WithoutTenant(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, tenantKey{}, tenantExemption{})
+}
+
+func tenantExempt(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	_, ok := ctx.Value(tenantKey{}).(tenantExemption)
+	return ok
+}
+
+// TenantFromContext returns the tenant set with WithTenant or an empty string if there is none.
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// EnableTenancy scopes every operation of the Client to the tenant of its context (see WithTenant).
+// By default tenants share collections: document.TenantField is added to every filter, aggregation and update filter,
+// new documents are stamped with the tenant and must embed document.Tenant, and writes to documents or fields of
+// another tenant return ErrCrossTenant. With TenancyOptions.DatabaseName, each tenant's documents live in their own
+// database instead.
+// Operations without a tenant in their context return ErrNoTenant, unless the context is made with WithoutTenant.
+func (c *Client) EnableTenancy(tenancyOptions *TenancyOptions) {
+	if tenancyOptions == nil {
+		tenancyOptions = &TenancyOptions{}
+	}
+	c.tenancy = tenancyOptions
+}
+
+// DisableTenancy stops scoping operations to tenants.
+func (c *Client) DisableTenancy() {
+	c.tenancy = nil
+}
+
+// database returns the database the operations made with ctx run against.
+func (c *Client) database(ctx context.Context) (*mongo.Database, error) {
+	if c.tenancy == nil || tenantExempt(ctx) {
+		return c.resolve(ctx), nil
+	}
+
+	tenant := TenantFromContext(ctx)
+	if tenant == "" {
+		return nil, ErrNoTenant
+	}
+	if c.tenancy.DatabaseName == nil {
+		return c.resolve(ctx), nil
+	}
+	return c.Connection.Client().Database(c.tenancy.DatabaseName(tenant)), nil
+}
+
+// collectionDatabase returns the database for operations on collections rather than documents - eg: managing indexes.
+// Tenants sharing collections share these so no tenant is required.
+func (c *Client) collectionDatabase(ctx context.Context) (*mongo.Database, error) {
+	if c.tenancy == nil || c.tenancy.DatabaseName == nil {
+		return c.resolve(ctx), nil
+	}
+	return c.database(ctx)
+}
+
+// scope returns the database and tenant scoped filters for an operation made with ctx.
+func (c *Client) scope(ctx context.Context, filters []bson.E) (*mongo.Database, []bson.E, error) {
+	db, err := c.database(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	filters, err = c.scopeFilters(ctx, filters)
+	return db, filters, err
+}
+
+// sharedTenant returns the tenant documents are scoped to by document.TenantField or an empty string when tenants
+// don't share collections.
+func (c *Client) sharedTenant(ctx context.Context) string {
+	if c.tenancy == nil || c.tenancy.DatabaseName != nil {
+		return ""
+	}
+	return TenantFromContext(ctx)
+}
+
+// scopeFilters adds the tenant of ctx to filters. Filters on another tenant return ErrCrossTenant.
+func (c *Client) scopeFilters(ctx context.Context, filters []bson.E) ([]bson.E, error) {
+	tenant := c.sharedTenant(ctx)
+	if tenant == "" {
+		return filters, nil
+	}
+
+	for _, f := range filters {
+		if f.Key == document.TenantField {
+			if f.Value != tenant {
+				return nil, ErrCrossTenant
+			}
+			return filters, nil
+		}
+	}
+	return append(append([]bson.E{}, filters...), bson.E{Key: document.TenantField, Value: tenant}), nil
+}
+
+// scopeAnyFilters is scopeFilters for the filter types accepted by CountDocuments.
+func (c *Client) scopeAnyFilters(ctx context.Context, filters interface{}) (interface{}, error) {
+	if c.sharedTenant(ctx) == "" {
+		return filters, nil
+	}
+
+	switch f := filters.(type) {
+	case nil:
+		return c.scopeFilters(ctx, nil)
+	case []bson.E:
+		return c.scopeFilters(ctx, f)
+	case bson.D:
+		return c.scopeFilters(ctx, f)
+	case bson.M:
+		scoped, err := c.scopeFilters(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{bson.E{Key: operator.And, Value: bson.A{f, bson.D(scoped)}}}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnscopedFilters, filters)
+}
+
+// scopePipeline adds a $match on the tenant of ctx to pipeline. The match follows stages that must come first.
+// Stages reading other collections are scoped too: the tenant is matched in the pipelines of $lookup and $unionWith
+// and in the restrictSearchWithMatch of $graphLookup, including those nested in sub-pipelines and $facet.
+func (c *Client) scopePipeline(ctx context.Context, pipeline mongo.Pipeline) (mongo.Pipeline, error) {
+	tenant := c.sharedTenant(ctx)
+	if tenant == "" {
+		return pipeline, nil
+	}
+	return tenantPipeline(tenant, pipeline, true)
+}
+
+// tenantPipeline scopes the stages of pipeline reading other collections to tenant and, when match is true, adds a
+// $match on the tenant to pipeline itself.
+func tenantPipeline(tenant string, pipeline []bson.D, match bool) (mongo.Pipeline, error) {
+	at := -1
+	if match {
+		at = 0
+		if len(pipeline) > 0 && len(pipeline[0]) > 0 {
+			switch pipeline[0][0].Key {
+			case "$geoNear", "$search", "$searchMeta", "$collStats", "$indexStats", "$documents":
+				at = 1
+			}
+		}
+	}
+
+	scoped := make(mongo.Pipeline, 0, len(pipeline)+1)
+	for i, stage := range pipeline {
+		if i == at {
+			scoped = append(scoped, tenantMatch(tenant))
+		}
+		stage, err := tenantStage(tenant, stage)
+		if err != nil {
+			return nil, err
+		}
+		scoped = append(scoped, stage)
+	}
+	if at >= len(pipeline) {
+		scoped = append(scoped, tenantMatch(tenant))
+	}
+	return scoped, nil
+}
+
+func tenantMatch(tenant string) bson.D {
+	return bson.D{bson.E{Key: operator.Match, Value: bson.D{bson.E{Key: document.TenantField, Value: tenant}}}}
+}
+
+// tenantStage scopes a stage reading other collections to tenant. Other stages are returned as is.
+func tenantStage(tenant string, stage bson.D) (bson.D, error) {
+	if len(stage) == 0 {
+		return stage, nil
+	}
+
+	name := stage[0].Key
+	var spec bson.D
+	var err error
+	switch name {
+	case "$lookup", "$graphLookup", "$facet":
+		spec, err = stageDocument(stage[0].Value)
+	case "$unionWith":
+		if collection, ok := stage[0].Value.(string); ok {
+			spec = bson.D{bson.E{Key: "coll", Value: collection}}
+		} else {
+			spec, err = stageDocument(stage[0].Value)
+		}
+	default:
+		return stage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnscopedStage, name, err)
+	}
+
+	switch name {
+	case "$lookup", "$unionWith":
+		//$lookup with localField and foreignField takes a pipeline from MongoDB 5.0, older servers reject the stage
+		spec, err = scopeSubPipeline(tenant, spec, "pipeline", true)
+	case "$facet":
+		for i := range spec {
+			if spec, err = scopeSubPipeline(tenant, spec, spec[i].Key, false); err != nil {
+				break
+			}
+		}
+	case "$graphLookup":
+		restrict := bson.E{Key: "restrictSearchWithMatch", Value: bson.D{bson.E{Key: document.TenantField, Value: tenant}}}
+		found := false
+		for i, e := range spec {
+			if e.Key == restrict.Key {
+				spec[i].Value = bson.D{bson.E{Key: operator.And, Value: bson.A{e.Value, restrict.Value}}}
+				found = true
+			}
+		}
+		if !found {
+			spec = append(spec, restrict)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnscopedStage, name, err)
+	}
+
+	return append(bson.D{bson.E{Key: name, Value: spec}}, stage[1:]...), nil
+}
+
+// scopeSubPipeline scopes the pipeline of spec under key, adding it when spec has none.
+func scopeSubPipeline(tenant string, spec bson.D, key string, match bool) (bson.D, error) {
+	for i, e := range spec {
+		if e.Key != key {
+			continue
+		}
+		pipeline, err := stagePipeline(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		if spec[i].Value, err = tenantPipeline(tenant, pipeline, match); err != nil {
+			return nil, err
+		}
+		return spec, nil
+	}
+
+	pipeline, err := tenantPipeline(tenant, nil, match)
+	return append(spec, bson.E{Key: key, Value: pipeline}), err
+}
+
+// stageDocument returns a copy of the specification of a stage as a bson.D whatever type it was built with.
+func stageDocument(value interface{}) (bson.D, error) {
+	switch spec := value.(type) {
+	case bson.D:
+		return append(bson.D{}, spec...), nil
+	case bson.M:
+		d := make(bson.D, 0, len(spec))
+		for k, v := range spec {
+			d = append(d, bson.E{Key: k, Value: v})
+		}
+		return d, nil
+	}
+
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var spec bson.D
+	return spec, bson.Unmarshal(data, &spec)
+}
+
+// stagePipeline returns a sub-pipeline as a slice of stages whatever type it was built with.
+func stagePipeline(value interface{}) ([]bson.D, error) {
+	switch pipeline := value.(type) {
+	case mongo.Pipeline:
+		return pipeline, nil
+	case []bson.D:
+		return pipeline, nil
+	}
+
+	data, err := bson.Marshal(bson.D{bson.E{Key: "pipeline", Value: value}})
+	if err != nil {
+		return nil, err
+	}
+	var wrapper struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	return wrapper.Pipeline, bson.Unmarshal(data, &wrapper)
+}
+
+// checkUpdate rejects updates that change document.TenantField, including renaming another field to it.
+func (c *Client) checkUpdate(ctx context.Context, update bson.D) error {
+	if c.sharedTenant(ctx) == "" {
+		return nil
+	}
+
+	for _, op := range update {
+		values, ok := setValues(op.Value)
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			if v.Key == document.TenantField || (op.Key == "$rename" && v.Value == document.TenantField) {
+				return ErrCrossTenant
+			}
+		}
+	}
+	return nil
+}
+
+// stampTenant sets the tenant of ctx on a new doc or checks an existing doc belongs to it.
+func (c *Client) stampTenant(ctx context.Context, doc interface{}) error {
+	tenant := c.sharedTenant(ctx)
+	if tenant == "" {
+		return nil
+	}
+
+	scoped, ok := doc.(document.TenantScoped)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotTenantScoped, doc)
+	}
+
+	switch scoped.GetTenantID() {
+	case tenant:
+	case "":
+		scoped.SetTenantID(tenant)
+	default:
+		return ErrCrossTenant
+	}
+	return nil
+}
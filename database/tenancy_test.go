@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+type TenantUser struct {
+	document.Base   `bson:",inline"`
+	document.Tenant `bson:",inline"`
+	FirstName       string `bson:"first_name"`
+}
+
+type TenantPet struct {
+	document.Base   `bson:",inline"`
+	document.Tenant `bson:",inline"`
+	OwnerID         primitive.ObjectID `bson:"owner_id" asari:"ref=users"`
+}
+
+func TestWithTenant(t *testing.T) {
+	assert.Equal(t, "", TenantFromContext(nil))
+	assert.Equal(t, "acme", TenantFromContext(WithTenant(nil, "acme")))
+
+	exempt := WithoutTenant(WithTenant(nil, "acme"))
+	assert.Equal(t, "", TenantFromContext(exempt))
+	assert.True(t, tenantExempt(exempt))
+	assert.False(t, tenantExempt(WithTenant(exempt, "acme")))
+}
+
+func TestClient_ScopeFilters(t *testing.T) {
+	c := &Client{}
+	ctx := WithTenant(context.Background(), "acme")
+
+	//Test Filters Are Untouched Without Tenancy
+	filters := []bson.E{{Key: "email", Value: "a@b.c"}}
+	scoped, err := c.scopeFilters(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, filters, scoped)
+
+	c.EnableTenancy(nil)
+	scoped, err = c.scopeFilters(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.E{{Key: "email", Value: "a@b.c"}, {Key: document.TenantField, Value: "acme"}}, scoped)
+	assert.Len(t, filters, 1)
+
+	_, err = c.scopeFilters(ctx, []bson.E{{Key: document.TenantField, Value: "globex"}})
+	assert.Equal(t, ErrCrossTenant, err)
+
+	_, err = c.database(nil)
+	assert.Equal(t, ErrNoTenant, err)
+
+	scopedAny, err := c.scopeAnyFilters(ctx, bson.M{"email": "a@b.c"})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{bson.E{Key: operator.And, Value: bson.A{bson.M{"email": "a@b.c"}, bson.D{bson.E{Key: document.TenantField, Value: "acme"}}}}}, scopedAny)
+
+	_, err = c.scopeAnyFilters(ctx, "email")
+	assert.True(t, errors.Is(err, ErrUnscopedFilters), err)
+
+	//Test Tenants In Their Own Database Are Not Scoped By Field
+	c.EnableTenancy(&TenancyOptions{DatabaseName: func(tenant string) string { return "tenant_" + tenant }})
+	scoped, err = c.scopeFilters(ctx, filters)
+	assert.Nil(t, err)
+	assert.Equal(t, filters, scoped)
+}
+
+func TestClient_ScopePipeline(t *testing.T) {
+	c := &Client{}
+	c.EnableTenancy(nil)
+	ctx := WithTenant(context.Background(), "acme")
+	match := bson.D{bson.E{Key: "$match", Value: bson.D{bson.E{Key: document.TenantField, Value: "acme"}}}}
+	sort := bson.D{bson.E{Key: "$sort", Value: bson.D{bson.E{Key: "_id", Value: 1}}}}
+	geoNear := bson.D{bson.E{Key: "$geoNear", Value: bson.D{}}}
+
+	scoped, err := c.scopePipeline(ctx, mongo.Pipeline{sort})
+	assert.Nil(t, err)
+	assert.Equal(t, mongo.Pipeline{match, sort}, scoped)
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{geoNear, sort})
+	assert.Nil(t, err)
+	assert.Equal(t, mongo.Pipeline{geoNear, match, sort}, scoped)
+
+	//Test Stages Reading Other Collections Are Scoped
+	lookup := bson.D{bson.E{Key: "$lookup", Value: bson.M{"from": "pets", "localField": "_id", "foreignField": "owner_id", "as": "pets"}}}
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{lookup})
+	assert.Nil(t, err)
+	spec := scoped[1][0].Value.(bson.D)
+	assert.Contains(t, spec, bson.E{Key: "pipeline", Value: mongo.Pipeline{match}})
+
+	nested := bson.D{bson.E{Key: "$lookup", Value: bson.D{
+		bson.E{Key: "from", Value: "pets"},
+		bson.E{Key: "pipeline", Value: mongo.Pipeline{sort, lookup}},
+		bson.E{Key: "as", Value: "pets"},
+	}}}
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{nested})
+	assert.Nil(t, err)
+	pipeline := scoped[1][0].Value.(bson.D)[1].Value.(mongo.Pipeline)
+	if assert.Len(t, pipeline, 3) {
+		assert.Equal(t, mongo.Pipeline{match, sort}, pipeline[:2])
+		assert.Contains(t, pipeline[2][0].Value.(bson.D), bson.E{Key: "pipeline", Value: mongo.Pipeline{match}})
+	}
+
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{bson.D{bson.E{Key: "$unionWith", Value: "archived_users"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{bson.E{Key: "$unionWith", Value: bson.D{
+		bson.E{Key: "coll", Value: "archived_users"},
+		bson.E{Key: "pipeline", Value: mongo.Pipeline{match}},
+	}}}, scoped[1])
+
+	graphLookup := bson.D{bson.E{Key: "$graphLookup", Value: bson.D{
+		bson.E{Key: "from", Value: "users"},
+		bson.E{Key: "restrictSearchWithMatch", Value: bson.D{bson.E{Key: "level", Value: 2}}},
+	}}}
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{graphLookup})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.E{Key: "restrictSearchWithMatch", Value: bson.D{bson.E{Key: operator.And, Value: bson.A{
+		bson.D{bson.E{Key: "level", Value: 2}},
+		bson.D{bson.E{Key: document.TenantField, Value: "acme"}},
+	}}}}, scoped[1][0].Value.(bson.D)[1])
+
+	facet := bson.D{bson.E{Key: "$facet", Value: bson.D{bson.E{Key: "owned", Value: mongo.Pipeline{lookup}}}}}
+	scoped, err = c.scopePipeline(ctx, mongo.Pipeline{facet})
+	assert.Nil(t, err)
+	owned := scoped[1][0].Value.(bson.D)[0].Value.(mongo.Pipeline)
+	if assert.Len(t, owned, 1) {
+		assert.Contains(t, owned[0][0].Value.(bson.D), bson.E{Key: "pipeline", Value: mongo.Pipeline{match}})
+	}
+
+	_, err = c.scopePipeline(ctx, mongo.Pipeline{bson.D{bson.E{Key: "$unionWith", Value: 5}}})
+	assert.True(t, errors.Is(err, ErrUnscopedStage), err)
+
+	//Test Exempt Contexts Are Not Scoped
+	scoped, err = c.scopePipeline(WithoutTenant(ctx), mongo.Pipeline{lookup})
+	assert.Nil(t, err)
+	assert.Equal(t, mongo.Pipeline{lookup}, scoped)
+}
+
+func TestClient_StampTenant(t *testing.T) {
+	c := &Client{}
+	c.EnableTenancy(nil)
+	ctx := WithTenant(context.Background(), "acme")
+
+	user := &TenantUser{}
+	assert.Nil(t, c.stampTenant(ctx, user))
+	assert.Equal(t, "acme", user.TenantID)
+
+	user.TenantID = "globex"
+	assert.Equal(t, ErrCrossTenant, c.stampTenant(ctx, user))
+	assert.True(t, errors.Is(c.stampTenant(ctx, &User{}), ErrNotTenantScoped))
+
+	update := builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: document.TenantField, Value: "globex"}).Get()
+	assert.Equal(t, ErrCrossTenant, c.checkUpdate(ctx, update))
+	update = builder.NewUpdateManyBuilder().Add("$rename", bson.E{Key: "owner", Value: document.TenantField}).Get()
+	assert.Equal(t, ErrCrossTenant, c.checkUpdate(ctx, update))
+
+	//Test Exempt Contexts Neither Stamp Nor Require A Tenant
+	assert.Nil(t, c.stampTenant(WithoutTenant(ctx), &User{}))
+	_, err := c.database(WithoutTenant(nil))
+	assert.Nil(t, err)
+}
+
+func TestClient_Tenancy(t *testing.T) {
+	defer tearDown()
+
+	c := &Client{Connection: TestClient.Connection}
+	c.EnableTenancy(nil)
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	user := &TenantUser{FirstName: "Joseph"}
+	user.Setup()
+	_, err := c.SaveDocument(acme, UserCollection, user)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", user.TenantID)
+
+	_, err = c.SaveDocument(nil, UserCollection, user)
+	assert.Equal(t, ErrNoTenant, err)
+
+	//Test Other Tenants Cannot Read Or Write The Document
+	found := &TenantUser{}
+	assert.Equal(t, ErrNotFound, c.FindOneByID(globex, UserCollection, user.ID, nil, found))
+	assert.Nil(t, c.FindOneByID(acme, UserCollection, user.ID, nil, found))
+
+	_, err = c.SaveDocument(globex, UserCollection, user)
+	assert.Equal(t, ErrCrossTenant, err)
+	_, err = c.SoftDeleteDocument(globex, UserCollection, user)
+	assert.Equal(t, ErrCrossTenant, err)
+
+	count, err := c.CountDocuments(globex, UserCollection, bson.M{"first_name": "Joseph"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	ub := builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "first_name", Value: "Jo"})
+	result, err := c.UpdateMany(globex, UserCollection, queryfilter.New().GetFilters(), ub, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.MatchedCount)
+
+	cur, err := c.Aggregate(globex, UserCollection, mongo.Pipeline{}, nil)
+	if assert.Nil(t, err) {
+		assert.False(t, cur.Next(nil))
+	}
+
+	cur, err = c.FindAll(acme, UserCollection, nil, nil, nil)
+	if assert.Nil(t, err) {
+		assert.True(t, cur.Next(nil))
+	}
+
+	//Test Documents Cannot Reference The Documents Of Another Tenant
+	pet := &TenantPet{OwnerID: user.ID}
+	pet.Setup()
+	_, err = c.SaveDocument(globex, PetCollection, pet)
+	var validationError *ValidationError
+	assert.True(t, errors.As(err, &validationError))
+
+	pet = &TenantPet{OwnerID: user.ID}
+	pet.Setup()
+	_, err = c.SaveDocument(acme, PetCollection, pet)
+	assert.Nil(t, err)
+	c.HardDeleteDocument(acme, PetCollection, pet)
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sync"
+)
+
+type OperationType string
+
+const (
+	OperationInsert      OperationType = "insert"
+	OperationUpdate      OperationType = "update"
+	OperationReplace     OperationType = "replace"
+	OperationDelete      OperationType = "delete"
+	OperationInvalidate  OperationType = "invalidate"
+	OperationSoftDeleted OperationType = "soft-deleted"
+)
+
+type (
+	// ChangeEvent is a decoded change stream event.
+	// FullDocument holds a pointer to a new value of the WatchOptions.Document type or is nil if the event carries no
+	// document (deletes, or updates when the document no longer exists).
+	ChangeEvent struct {
+		ResumeToken   bson.Raw
+		OperationType OperationType
+		DocumentKey   primitive.ObjectID
+		FullDocument  interface{}
+		UpdatedFields bson.M
+		RemovedFields []string
+		ClusterTime   primitive.Timestamp
+		Raw           bson.Raw
+	}
+
+	// ChangeHandler is called once for every event received by Watch. Returning an error stops the watch and the
+	// event's resume token is not persisted.
+	ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+	// ResumeTokenStore persists change stream resume tokens so a watch can continue where it stopped.
+	ResumeTokenStore interface {
+		// LoadResumeToken returns the last saved token for key or nil if none has been saved yet.
+		LoadResumeToken(ctx context.Context, key string) (bson.Raw, error)
+		// SaveResumeToken stores token as the latest processed position for key.
+		SaveResumeToken(ctx context.Context, key string, token bson.Raw) error
+	}
+
+	WatchOptions struct {
+		// Document is a pointer to the document type full documents are decoded into - eg: &User{}
+		// If nil, FullDocument is left empty and the document is only available in Raw.
+		Document interface{}
+		// TokenStore, if set, is used to resume the watch and is updated after every successfully handled event.
+		TokenStore ResumeTokenStore
+		// TokenKey is the key used with TokenStore. Defaults to the collection name.
+		TokenKey string
+		// FullDocument controls lookup of the full document on update events. Defaults to options.UpdateLookup.
+		FullDocument *options.FullDocument
+	}
+
+	rawChangeEvent struct {
+		ID            bson.Raw            `bson:"_id"`
+		OperationType string              `bson:"operationType"`
+		FullDocument  bson.Raw            `bson:"fullDocument,omitempty"`
+		ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+		DocumentKey   struct {
+			ID primitive.ObjectID `bson:"_id"`
+		} `bson:"documentKey"`
+		UpdateDescription struct {
+			UpdatedFields bson.M   `bson:"updatedFields"`
+			RemovedFields []string `bson:"removedFields"`
+		} `bson:"updateDescription"`
+	}
+)
+
+// Watch opens a change stream on the collection and calls handler for every event until ctx is cancelled or the
+// handler returns an error.
+// filters are applied as a $match stage on the change events - eg: bson.E{Key: "operationType", Value: "insert"}
+// Replacements and updates that mark a document as deleted are delivered as OperationSoftDeleted events.
+// With tenancy enabled, tenants sharing collections only receive events carrying a full document of theirs, so
+// OperationDelete events are not delivered.
+func (c *Client) Watch(ctx context.Context, collection string, filters []bson.E, handler ChangeHandler, watchOptions *WatchOptions) error {
+	if handler == nil {
+		return ErrNoHandler
+	}
+	if err := c.validateFilters(filters); err != nil {
+		return err
+	}
+
+	if watchOptions == nil {
+		watchOptions = &WatchOptions{}
+	}
+	if watchOptions.Document != nil {
+		if err := c.validateDocumentKind(watchOptions.Document); err != nil {
+			return err
+		}
+	}
+
+	tokenKey := watchOptions.TokenKey
+	if tokenKey == "" {
+		tokenKey = collection
+	}
+
+	fullDocument := options.UpdateLookup
+	if watchOptions.FullDocument != nil {
+		fullDocument = *watchOptions.FullDocument
+	}
+	opts := options.ChangeStream().SetFullDocument(fullDocument)
+
+	if watchOptions.TokenStore != nil {
+		token, err := watchOptions.TokenStore.LoadResumeToken(ctx, tokenKey)
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			opts.SetResumeAfter(token)
+		}
+	}
+
+	db, err := c.database(ctx)
+	if err != nil {
+		return err
+	}
+	if tenant := c.sharedTenant(ctx); tenant != "" {
+		filters = append(append([]bson.E{}, filters...), bson.E{Key: "fullDocument." + document.TenantField, Value: tenant})
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(filters) > 0 {
+		pipeline = append(pipeline, bson.D{bson.E{Key: operator.Match, Value: bson.D(filters)}})
+	}
+
+	stream, err := c.collection(ctx, db, collection).Watch(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		event, err := newChangeEvent(stream.Current, watchOptions.Document)
+		if err != nil {
+			return err
+		}
+
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+
+		if watchOptions.TokenStore != nil {
+			if err := watchOptions.TokenStore.SaveResumeToken(ctx, tokenKey, event.ResumeToken); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func newChangeEvent(raw bson.Raw, doc interface{}) (*ChangeEvent, error) {
+	var re rawChangeEvent
+	if err := bson.Unmarshal(raw, &re); err != nil {
+		return nil, err
+	}
+
+	event := &ChangeEvent{
+		ResumeToken:   re.ID,
+		OperationType: OperationType(re.OperationType),
+		DocumentKey:   re.DocumentKey.ID,
+		UpdatedFields: re.UpdateDescription.UpdatedFields,
+		RemovedFields: re.UpdateDescription.RemovedFields,
+		ClusterTime:   re.ClusterTime,
+		Raw:           raw,
+	}
+
+	if len(re.FullDocument) > 0 {
+		if isDeleted, ok := re.FullDocument.Lookup("is_deleted").BooleanOK(); ok && isDeleted {
+			if event.OperationType == OperationReplace {
+				event.OperationType = OperationSoftDeleted
+			}
+		}
+
+		if doc != nil {
+			target := reflect.New(reflect.TypeOf(doc).Elem()).Interface()
+			if err := Decode(re.FullDocument, target); err != nil {
+				return nil, err
+			}
+			event.FullDocument = target
+		}
+	}
+
+	if event.OperationType == OperationUpdate {
+		if isDeleted, ok := event.UpdatedFields["is_deleted"].(bool); ok && isDeleted {
+			event.OperationType = OperationSoftDeleted
+		}
+	}
+
+	return event, nil
+}
+
+// MemoryResumeTokenStore keeps resume tokens in memory. Tokens are lost when the process exits.
+type MemoryResumeTokenStore struct {
+	m      sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+func NewMemoryResumeTokenStore() *MemoryResumeTokenStore {
+	return &MemoryResumeTokenStore{tokens: map[string]bson.Raw{}}
+}
+
+func (s *MemoryResumeTokenStore) LoadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.tokens[key], nil
+}
+
+func (s *MemoryResumeTokenStore) SaveResumeToken(ctx context.Context, key string, token bson.Raw) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tokens[key] = token
+	return nil
+}
+
+// CollectionResumeTokenStore persists resume tokens in a collection, one document per key.
+type CollectionResumeTokenStore struct {
+	client     *Client
+	collection string
+}
+
+func NewCollectionResumeTokenStore(client *Client, collection string) *CollectionResumeTokenStore {
+	return &CollectionResumeTokenStore{client: client, collection: collection}
+}
+
+func (s *CollectionResumeTokenStore) LoadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	var result struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.client.Connection.Collection(s.collection).FindOne(ctx, bson.D{bson.E{Key: "_id", Value: key}}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Token, nil
+}
+
+func (s *CollectionResumeTokenStore) SaveResumeToken(ctx context.Context, key string, token bson.Raw) error {
+	filter := bson.D{bson.E{Key: "_id", Value: key}}
+	update := bson.D{bson.E{Key: operator.Set, Value: bson.D{bson.E{Key: "token", Value: token}}}}
+	_, err := s.client.Connection.Collection(s.collection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
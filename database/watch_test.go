@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestNewChangeEvent(t *testing.T) {
+	user := &User{FirstName: "Joseph", LastName: "Cobhams"}
+	user.Setup()
+
+	fullDocument, _ := bson.Marshal(user)
+	raw, _ := bson.Marshal(bson.M{
+		"_id":           bson.M{"_data": "token"},
+		"operationType": "insert",
+		"documentKey":   bson.M{"_id": user.ID},
+		"fullDocument":  bson.Raw(fullDocument),
+	})
+
+	event, err := newChangeEvent(raw, &User{})
+	assert.Nil(t, err)
+	assert.Equal(t, OperationInsert, event.OperationType)
+	assert.Equal(t, user.ID, event.DocumentKey)
+	assert.Equal(t, "token", event.ResumeToken.Lookup("_data").StringValue())
+	if assert.IsType(t, &User{}, event.FullDocument) {
+		assert.Equal(t, "Joseph", event.FullDocument.(*User).FirstName)
+	}
+
+	//Test Full Document Is Not Decoded Without A Document Type
+	event, err = newChangeEvent(raw, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, event.FullDocument)
+
+	//Test Soft Deleted Replacement
+	user.BeforeSoftDelete()
+	fullDocument, _ = bson.Marshal(user)
+	raw, _ = bson.Marshal(bson.M{
+		"_id":           bson.M{"_data": "token"},
+		"operationType": "replace",
+		"documentKey":   bson.M{"_id": user.ID},
+		"fullDocument":  bson.Raw(fullDocument),
+	})
+	event, err = newChangeEvent(raw, &User{})
+	assert.Nil(t, err)
+	assert.Equal(t, OperationSoftDeleted, event.OperationType)
+	assert.True(t, event.FullDocument.(*User).IsDeleted)
+
+	//Test Soft Deleted Update
+	raw, _ = bson.Marshal(bson.M{
+		"_id":               bson.M{"_data": "token"},
+		"operationType":     "update",
+		"documentKey":       bson.M{"_id": primitive.NewObjectID()},
+		"updateDescription": bson.M{"updatedFields": bson.M{"is_deleted": true}, "removedFields": bson.A{}},
+	})
+	event, err = newChangeEvent(raw, &User{})
+	assert.Nil(t, err)
+	assert.Equal(t, OperationSoftDeleted, event.OperationType)
+	assert.Nil(t, event.FullDocument)
+}
+
+func TestMemoryResumeTokenStore(t *testing.T) {
+	store := NewMemoryResumeTokenStore()
+
+	token, err := store.LoadResumeToken(nil, UserCollection)
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	raw, _ := bson.Marshal(bson.M{"_data": "token"})
+	assert.Nil(t, store.SaveResumeToken(nil, UserCollection, raw))
+
+	token, err = store.LoadResumeToken(nil, UserCollection)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(raw), token)
+}
+
+func TestClient_Watch(t *testing.T) {
+	//Test A Handler Is Required
+	assert.Error(t, TestClient.Watch(nil, UserCollection, nil, nil, nil))
+
+	//Test Document Type Must Be A Pointer
+	handler := func(ctx context.Context, event *ChangeEvent) error { return nil }
+	assert.Error(t, TestClient.Watch(nil, UserCollection, nil, handler, &WatchOptions{Document: User{}}))
+}
@@ -0,0 +1,46 @@
+package document
+
+type (
+	// Attribution records who created, last updated and soft deleted a document. Embed it inline next to Base:
+	// document.Attribution `bson:",inline"`
+	// database.Client fills it from the actor set on the context with database.WithActor.
+	Attribution struct {
+		CreatedBy interface{} `bson:"created_by,omitempty" json:"-"`
+		UpdatedBy interface{} `bson:"updated_by,omitempty" json:"-"`
+		DeletedBy interface{} `bson:"deleted_by,omitempty" json:"-"`
+	}
+
+	// Attributable is implemented by documents that embed Attribution.
+	Attributable interface {
+		SetCreatedBy(actor interface{})
+		SetUpdatedBy(actor interface{})
+		SetDeletedBy(actor interface{})
+	}
+)
+
+// GetCreatedBy returns the actor that created the document.
+func (a *Attribution) GetCreatedBy() interface{} {
+	return a.CreatedBy
+}
+
+// GetUpdatedBy returns the actor that last updated the document.
+func (a *Attribution) GetUpdatedBy() interface{} {
+	return a.UpdatedBy
+}
+
+// GetDeletedBy returns the actor that soft deleted the document or nil if it is not deleted.
+func (a *Attribution) GetDeletedBy() interface{} {
+	return a.DeletedBy
+}
+
+func (a *Attribution) SetCreatedBy(actor interface{}) {
+	a.CreatedBy = actor
+}
+
+func (a *Attribution) SetUpdatedBy(actor interface{}) {
+	a.UpdatedBy = actor
+}
+
+func (a *Attribution) SetDeletedBy(actor interface{}) {
+	a.DeletedBy = actor
+}
@@ -0,0 +1,26 @@
+package document
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type attributedDoc struct {
+	Base        `bson:",inline"`
+	Attribution `bson:",inline"`
+}
+
+func TestAttribution(t *testing.T) {
+	var doc interface{} = &attributedDoc{}
+	a, ok := doc.(Attributable)
+	if assert.True(t, ok) {
+		a.SetCreatedBy("creator")
+		a.SetUpdatedBy("updater")
+		a.SetDeletedBy("deleter")
+	}
+
+	d := doc.(*attributedDoc)
+	assert.Equal(t, "creator", d.GetCreatedBy())
+	assert.Equal(t, "updater", d.GetUpdatedBy())
+	assert.Equal(t, "deleter", d.GetDeletedBy())
+}
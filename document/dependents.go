@@ -0,0 +1,34 @@
+package document
+
+// DeletePolicy controls what happens to dependent documents when the document they reference is deleted. The zero
+// value is not a policy, every Dependent must declare one.
+type DeletePolicy int
+
+const (
+	// Cascade soft deletes live dependents along with the document and restores them with it. On hard delete the
+	// dependents are hard deleted as well.
+	Cascade DeletePolicy = iota + 1
+	// Restrict refuses to soft delete the document while live dependents reference it. Hard deletes are also refused
+	// while soft deleted dependents reference it, as restoring them would leave them pointing at nothing.
+	Restrict
+	// Nullify sets the dependents' reference to null.
+	Nullify
+)
+
+type (
+	// Dependent declares a collection holding documents that reference this document by its ID.
+	Dependent struct {
+		Collection string
+		// ForeignKey is the bson key of the field in Collection holding this document's ID - eg: "owner_id"
+		ForeignKey string
+		// Policy is required. Deletes of documents declaring a Dependent without one fail.
+		Policy DeletePolicy
+	}
+
+	// HasDependents is implemented by documents that other collections reference.
+	// SoftDeleteDocument, HardDeleteDocument and RestoreDocument apply the declared policies. Policies apply one level
+	// deep and dependents' hooks are not fired.
+	HasDependents interface {
+		Dependents() []Dependent
+	}
+)
@@ -28,15 +28,22 @@ type (
 		GetFormattedDeletedAt() *formattedTimestamp
 	}
 
+	// Restorable is implemented by documents that can be restored after a soft delete. Base implements it.
+	Restorable interface {
+		BeforeRestore()
+		GetDeletedAt() time.Time
+	}
+
 	//Base is the base document all documents must inherit. This ensure shared document properties can be set.
 	Base struct {
-		ID         primitive.ObjectID            `bson:"_id,omitempty" json:"_id"`
-		CreatedAt  time.Time                     `bson:"created_at" json:"-"`
-		UpdatedAt  time.Time                     `bson:"updated_at" json:"-"`
-		DeletedAt  time.Time                     `bson:"deleted_at,omitempty" json:"-"`
-		IsDeleted  bool                          `bson:"is_deleted" json:"-"`
-		isNew      bool                          `json:"-" bson:"-"`
-		Timestamps map[string]formattedTimestamp `bson:"-" json:"timestamps"`
+		ID            primitive.ObjectID            `bson:"_id,omitempty" json:"_id"`
+		CreatedAt     time.Time                     `bson:"created_at" json:"-"`
+		UpdatedAt     time.Time                     `bson:"updated_at" json:"-"`
+		DeletedAt     time.Time                     `bson:"deleted_at,omitempty" json:"-"`
+		IsDeleted     bool                          `bson:"is_deleted" json:"-"`
+		SchemaVersion int                           `bson:"schema_version,omitempty" json:"-"`
+		isNew         bool                          `json:"-" bson:"-"`
+		Timestamps    map[string]formattedTimestamp `bson:"-" json:"timestamps"`
 	}
 
 	formattedTimestamp struct {
@@ -80,6 +87,11 @@ func (d *Base) GetUpdatedAt() time.Time {
 	return d.UpdatedAt
 }
 
+// GetDeletedAt returns the time a document was soft deleted or the zero time if it is not deleted.
+func (d *Base) GetDeletedAt() time.Time {
+	return d.DeletedAt
+}
+
 // IsNew returns a document's initialization state.
 func (d *Base) IsNew() bool {
 	return d.isNew
@@ -92,6 +104,16 @@ func (d *Base) SetIsNew(status bool) {
 	d.isNew = status
 }
 
+// GetSchemaVersion returns the schema version the document was stored with. See Upgrader
+func (d *Base) GetSchemaVersion() int {
+	return d.SchemaVersion
+}
+
+// SetSchemaVersion sets the schema version the document will be stored with.
+func (d *Base) SetSchemaVersion(version int) {
+	d.SchemaVersion = version
+}
+
 func (d *Base) BeforeUpdate() {
 	d.UpdatedAt = time.Now().UTC()
 }
@@ -101,6 +123,12 @@ func (d *Base) BeforeSoftDelete() {
 	d.DeletedAt = time.Now().UTC()
 }
 
+// BeforeRestore clears the soft delete state of a document.
+func (d *Base) BeforeRestore() {
+	d.IsDeleted = false
+	d.DeletedAt = time.Time{}
+}
+
 // FormatDateShort returns a formatted time object in the format MMM DD, YYYY
 func (d *Base) FormatDateShort(dt time.Time) string {
 	return dt.Format("Jan 02, 2006")
@@ -163,3 +163,14 @@ func TestBase_GetAllTimeStamps(t *testing.T) {
 	assert.NotNil(t, tms["updatedAt"])
 	assert.NotNil(t, tms["deletedAt"])
 }
+
+func TestBase_BeforeRestore(t *testing.T) {
+	b := testDoc{}
+	assert.Implements(t, (*Restorable)(nil), &b)
+	b.BeforeSoftDelete()
+	assert.False(t, b.GetDeletedAt().IsZero())
+
+	b.BeforeRestore()
+	assert.False(t, b.IsDeleted)
+	assert.True(t, b.GetDeletedAt().IsZero())
+}
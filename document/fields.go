@@ -0,0 +1,86 @@
+package document
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Field describes a struct field as it is stored in MongoDB.
+type Field struct {
+	// Name is the bson key of the field - eg: "first_name"
+	Name string
+	// Index is the index sequence used with reflect.Value.FieldByIndex to reach the field from the document struct.
+	Index       []int
+	OmitEmpty   bool
+	StructField reflect.StructField
+}
+
+// Fields returns the bson mapped fields of a document struct in declaration order.
+// Inlined structs (eg: document.Base) are flattened into the result while nested structs are returned as a single
+// field. Unexported fields and fields tagged with bson:"-" are skipped.
+// doc can be a struct, a pointer to a struct or a reflect.Type of either.
+func Fields(doc interface{}) []Field {
+	t, ok := doc.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(doc)
+	}
+	return fields(t, nil)
+}
+
+func fields(t reflect.Type, index []int) []Field {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var result []Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		name, opts := parseBSONTag(sf)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		if opts["inline"] {
+			result = append(result, fields(sf.Type, fieldIndex)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		result = append(result, Field{
+			Name:        name,
+			Index:       fieldIndex,
+			OmitEmpty:   opts["omitempty"],
+			StructField: sf,
+		})
+	}
+	return result
+}
+
+func parseBSONTag(sf reflect.StructField) (string, map[string]bool) {
+	tag, ok := sf.Tag.Lookup("bson")
+	if !ok && !strings.Contains(string(sf.Tag), ":") {
+		tag = string(sf.Tag)
+	}
+
+	parts := strings.Split(tag, ",")
+	opts := map[string]bool{}
+	for _, o := range parts[1:] {
+		opts[o] = true
+	}
+
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name, opts
+}
@@ -0,0 +1,39 @@
+package document
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+type fieldsTestDoc struct {
+	Base     `bson:",inline"`
+	Name     string `bson:"name,omitempty"`
+	Untagged string
+	Skipped  string `bson:"-"`
+	hidden   string
+	Address  struct {
+		City string `bson:"city"`
+	} `bson:"address"`
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields(&fieldsTestDoc{})
+
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"_id", "created_at", "updated_at", "deleted_at", "is_deleted", "schema_version", "name", "untagged", "address"}, names)
+
+	//Test Inlined Fields Can Be Reached By Index
+	doc := fieldsTestDoc{}
+	doc.Setup()
+	assert.Equal(t, doc.ID, reflect.ValueOf(doc).FieldByIndex(fields[0].Index).Interface())
+
+	assert.True(t, fields[6].OmitEmpty)
+	assert.False(t, fields[7].OmitEmpty)
+
+	//Test Non Struct Values
+	assert.Nil(t, Fields("asari"))
+}
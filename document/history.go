@@ -0,0 +1,8 @@
+package document
+
+// HistoryKeeper is implemented by documents that keep their previous versions.
+// When KeepHistory returns true, every update made with SaveDocument stores the version it replaces in the
+// "<collection>_history" collection. See database.Client.ListRevisions
+type HistoryKeeper interface {
+	KeepHistory() bool
+}
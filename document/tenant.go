@@ -0,0 +1,29 @@
+package document
+
+// TenantField is the bson key documents store their tenant under.
+const TenantField = "tenant_id"
+
+type (
+	// Tenant scopes a document to a tenant. Embed it inline next to Base:
+	// document.Tenant `bson:",inline"`
+	// When tenancy is enabled on database.Client, SaveDocument stamps the tenant of the context onto new documents.
+	Tenant struct {
+		TenantID string `bson:"tenant_id,omitempty" json:"-"`
+	}
+
+	// TenantScoped is implemented by documents that embed Tenant.
+	TenantScoped interface {
+		GetTenantID() string
+		SetTenantID(tenant string)
+	}
+)
+
+// GetTenantID returns the tenant the document belongs to.
+func (t *Tenant) GetTenantID() string {
+	return t.TenantID
+}
+
+// SetTenantID sets the tenant the document belongs to.
+func (t *Tenant) SetTenantID(tenant string) {
+	t.TenantID = tenant
+}
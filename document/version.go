@@ -0,0 +1,63 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SchemaVersionField is the bson key the schema version of a document is stored under.
+const SchemaVersionField = "schema_version"
+
+type (
+	// UpgradeFunc upgrades a stored document by one schema version. It receives the raw document as read from the
+	// database and modifies it in place. Documents read with a projection only contain the projected fields, inclusion
+	// projections always include the schema version so documents already current are not upgraded again.
+	UpgradeFunc func(doc bson.M) error
+
+	// Upgrader is implemented by documents whose stored shape changes over time.
+	// Upgrades are applied lazily when a document is read and the new version is persisted on the next save.
+	Upgrader interface {
+		// SchemaUpgrades returns the upgrade functions in order. The function at index i upgrades a document from
+		// version i to version i+1 so the current version is len(SchemaUpgrades()).
+		// Documents saved before versioning was introduced are version 0.
+		SchemaUpgrades() []UpgradeFunc
+	}
+)
+
+// CurrentSchemaVersion returns the schema version new and saved documents of the Upgrader are stored with.
+func CurrentSchemaVersion(u Upgrader) int {
+	return len(u.SchemaUpgrades())
+}
+
+// Upgrade applies the upgrades of u to a raw stored document until it reaches the current schema version and returns
+// the upgraded document. raw is returned unchanged if it is already current.
+func Upgrade(raw bson.Raw, u Upgrader) (bson.Raw, error) {
+	upgrades := u.SchemaUpgrades()
+
+	version := 0
+	if v, ok := raw.Lookup(SchemaVersionField).AsInt64OK(); ok {
+		version = int(v)
+	}
+
+	if version == len(upgrades) {
+		return raw, nil
+	}
+	if version > len(upgrades) {
+		return nil, errors.New(fmt.Sprintf("asari: document schema version %d is newer than the supported version %d", version, len(upgrades)))
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	for ; version < len(upgrades); version++ {
+		if err := upgrades[version](doc); err != nil {
+			return nil, errors.New(fmt.Sprintf("asari: upgrading document from schema version %d failed: %v", version, err))
+		}
+	}
+	doc[SchemaVersionField] = version
+
+	return bson.Marshal(doc)
+}
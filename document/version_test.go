@@ -0,0 +1,85 @@
+package document
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+type versionedDoc struct {
+	Base     `bson:",inline"`
+	FullName string `bson:"full_name"`
+	Country  string `bson:"country"`
+}
+
+func (d *versionedDoc) SchemaUpgrades() []UpgradeFunc {
+	return []UpgradeFunc{
+		func(doc bson.M) error {
+			doc["full_name"] = doc["first_name"].(string) + " " + doc["last_name"].(string)
+			delete(doc, "first_name")
+			delete(doc, "last_name")
+			return nil
+		},
+		func(doc bson.M) error {
+			doc["country"] = "NG"
+			return nil
+		},
+	}
+}
+
+type failingUpgradeDoc struct {
+	Base `bson:",inline"`
+}
+
+func (d *failingUpgradeDoc) SchemaUpgrades() []UpgradeFunc {
+	return []UpgradeFunc{func(doc bson.M) error { return errors.New("upgrade failed") }}
+}
+
+func TestCurrentSchemaVersion(t *testing.T) {
+	assert.Equal(t, 2, CurrentSchemaVersion(&versionedDoc{}))
+}
+
+func TestUpgrade(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{"first_name": "Joseph", "last_name": "Cobhams"})
+
+	upgraded, err := Upgrade(raw, &versionedDoc{})
+	assert.Nil(t, err)
+
+	var d versionedDoc
+	assert.Nil(t, bson.Unmarshal(upgraded, &d))
+	assert.Equal(t, "Joseph Cobhams", d.FullName)
+	assert.Equal(t, "NG", d.Country)
+	assert.Equal(t, 2, d.GetSchemaVersion())
+
+	//Test Partially Upgraded Documents Only Run Remaining Upgrades
+	raw, _ = bson.Marshal(bson.M{"full_name": "Asari Cobhams", SchemaVersionField: 1})
+	upgraded, err = Upgrade(raw, &versionedDoc{})
+	assert.Nil(t, err)
+	assert.Nil(t, bson.Unmarshal(upgraded, &d))
+	assert.Equal(t, "Asari Cobhams", d.FullName)
+	assert.Equal(t, 2, d.SchemaVersion)
+
+	//Test Current Documents Are Returned Unchanged
+	raw, _ = bson.Marshal(bson.M{"full_name": "Ivy Cobhams", SchemaVersionField: 2})
+	upgraded, err = Upgrade(raw, &versionedDoc{})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(raw), upgraded)
+
+	//Test Newer Versions And Failing Upgrades
+	raw, _ = bson.Marshal(bson.M{SchemaVersionField: 3})
+	_, err = Upgrade(raw, &versionedDoc{})
+	assert.Error(t, err)
+
+	raw, _ = bson.Marshal(bson.M{})
+	_, err = Upgrade(raw, &failingUpgradeDoc{})
+	assert.Error(t, err)
+}
+
+func TestBase_SetSchemaVersion(t *testing.T) {
+	b := testDoc{}
+	assert.Equal(t, 0, b.GetSchemaVersion())
+
+	b.SetSchemaVersion(2)
+	assert.Equal(t, 2, b.GetSchemaVersion())
+}
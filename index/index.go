@@ -0,0 +1,258 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Ascending   = 1
+	Descending  = -1
+	Text        = "text"
+	Geo2DSphere = "2dsphere"
+	Hashed      = "hashed"
+
+	textIndexKey = "$text"
+)
+
+type (
+	// Index is a single index declaration. Keys are kept in the order they are declared.
+	Index struct {
+		Name               string
+		Keys               bson.D
+		Unique             bool
+		Sparse             bool
+		ExpireAfterSeconds *int32
+		PartialFilter      bson.D
+	}
+
+	// Indexer can be implemented by documents to declare indexes that cannot be expressed with struct tags.
+	Indexer interface {
+		// Indexes returns the indexes the document's collection should have.
+		Indexes() []Index
+	}
+)
+
+// Declared returns all the indexes declared by doc, first from index struct tags and then from the Indexes() method if
+// doc implements Indexer.
+//
+// Tag values are a comma separated list of:
+// asc (default), desc, text, 2dsphere, hashed - the key type
+// unique, sparse - index options
+// live - only index documents that are not soft deleted. Combined with unique, values only have to be unique among
+// live documents so a soft deleted document does not block a new one with the same value.
+// ttl=<duration> - expire documents after the duration (eg: ttl=24h or ttl=3600 for seconds)
+// name=<name> - the index name. Fields sharing a name form a compound index in declaration order.
+//
+// Example:
+// Email string `bson:"email" index:"unique"`
+// OwnerID primitive.ObjectID `bson:"owner_id" index:"name=owner_created"`
+// CreatedAt time.Time `bson:"created_at" index:"desc,name=owner_created"`
+func Declared(doc interface{}) ([]Index, error) {
+	var declared []Index
+	byName := map[string]int{}
+
+	if err := fromTags(reflect.TypeOf(doc), "", &declared, byName, map[reflect.Type]bool{}); err != nil {
+		return nil, err
+	}
+
+	if indexer, ok := doc.(Indexer); ok {
+		for _, idx := range indexer.Indexes() {
+			if len(idx.Keys) < 1 {
+				return nil, errors.New("asari: index declared with no keys")
+			}
+			if idx.Name == "" {
+				idx.Name = DefaultName(idx.Keys)
+			}
+			if _, exists := byName[idx.Name]; exists {
+				return nil, errors.New(fmt.Sprintf("asari: index %s declared more than once", idx.Name))
+			}
+			byName[idx.Name] = len(declared)
+			declared = append(declared, idx)
+		}
+	}
+	return declared, nil
+}
+
+func fromTags(t reflect.Type, prefix string, declared *[]Index, byName map[string]int, visiting map[reflect.Type]bool) error {
+	if t != nil {
+		if st := structType(t); st != nil {
+			if visiting[st] {
+				//Recursive types are only indexed down to their first level
+				return nil
+			}
+			visiting[st] = true
+			defer delete(visiting, st)
+		}
+	}
+
+	for _, f := range document.Fields(t) {
+		path := prefix + f.Name
+
+		if nested := structType(f.StructField.Type); nested != nil {
+			if err := fromTags(nested, path+".", declared, byName, visiting); err != nil {
+				return err
+			}
+		}
+
+		tag, ok := f.StructField.Tag.Lookup("index")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		idx, err := parseTag(path, tag)
+		if err != nil {
+			return err
+		}
+
+		if idx.Name == "" && idx.Keys[0].Value == Text {
+			//A collection can only have one text index so unnamed text fields are combined
+			if pos, exists := byName[textIndexKey]; exists {
+				merged := &(*declared)[pos]
+				merged.Keys = append(merged.Keys, idx.Keys...)
+				merged.Name = DefaultName(merged.Keys)
+				continue
+			}
+			byName[textIndexKey] = len(*declared)
+		}
+
+		if idx.Name == "" {
+			idx.Name = DefaultName(idx.Keys)
+		}
+
+		if pos, exists := byName[idx.Name]; exists {
+			merged := &(*declared)[pos]
+			merged.Keys = append(merged.Keys, idx.Keys...)
+			merged.Unique = merged.Unique || idx.Unique
+			merged.Sparse = merged.Sparse || idx.Sparse
+			if idx.ExpireAfterSeconds != nil {
+				merged.ExpireAfterSeconds = idx.ExpireAfterSeconds
+			}
+			if idx.PartialFilter != nil {
+				merged.PartialFilter = idx.PartialFilter
+			}
+			if merged.Sparse && merged.PartialFilter != nil {
+				return errors.New(fmt.Sprintf("asari: index %s cannot be both sparse and live", merged.Name))
+			}
+			continue
+		}
+
+		byName[idx.Name] = len(*declared)
+		*declared = append(*declared, idx)
+	}
+	return nil
+}
+
+func parseTag(path, tag string) (Index, error) {
+	idx := Index{}
+	var keyType interface{} = Ascending
+
+	for _, opt := range strings.Split(tag, ",") {
+		opt = strings.TrimSpace(opt)
+		value := ""
+		if i := strings.Index(opt, "="); i > -1 {
+			opt, value = opt[:i], opt[i+1:]
+		}
+
+		switch opt {
+		case "", "asc":
+			keyType = Ascending
+		case "desc":
+			keyType = Descending
+		case Text, Geo2DSphere, Hashed:
+			keyType = opt
+		case "unique":
+			idx.Unique = true
+		case "sparse":
+			idx.Sparse = true
+		case "live":
+			idx.PartialFilter = LiveFilter()
+		case "name":
+			idx.Name = value
+		case "ttl":
+			seconds, err := parseTTL(value)
+			if err != nil {
+				return idx, errors.New(fmt.Sprintf("asari: invalid ttl on %s index: %v", path, err))
+			}
+			idx.ExpireAfterSeconds = &seconds
+		default:
+			return idx, errors.New(fmt.Sprintf("asari: unknown index option %q on %s", opt, path))
+		}
+	}
+
+	if idx.Sparse && idx.PartialFilter != nil {
+		return idx, errors.New(fmt.Sprintf("asari: index on %s cannot be both sparse and live", path))
+	}
+
+	idx.Keys = bson.D{bson.E{Key: path, Value: keyType}}
+	return idx, nil
+}
+
+func parseTTL(value string) (int32, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return int32(seconds), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return int32(d / time.Second), nil
+}
+
+// LiveFilter returns the partial filter expression that restricts an index to documents that are not soft deleted.
+func LiveFilter() bson.D {
+	return bson.D{bson.E{Key: "is_deleted", Value: false}}
+}
+
+// UniqueLive declares a unique index that ignores soft deleted documents.
+func UniqueLive(keys bson.D) Index {
+	return Index{Keys: keys, Unique: true, PartialFilter: LiveFilter()}
+}
+
+// DefaultName returns the name MongoDB gives an index with the provided keys - eg: "owner_id_1_created_at_-1"
+func DefaultName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Model converts the declaration into a mongo.IndexModel ready to be passed to CreateMany.
+func (i Index) Model() mongo.IndexModel {
+	opts := options.Index().SetName(i.Name)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if i.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*i.ExpireAfterSeconds)
+	}
+	if i.PartialFilter != nil {
+		opts.SetPartialFilterExpression(i.PartialFilter)
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	if t.PkgPath() == "go.mongodb.org/mongo-driver/bson/primitive" {
+		return nil
+	}
+	return t
+}
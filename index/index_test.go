@@ -0,0 +1,123 @@
+package index
+
+import (
+	"github.com/jcobhams/asari/document"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+type indexedDoc struct {
+	document.Base `bson:",inline"`
+	Email         string             `bson:"email" index:"unique,sparse"`
+	OwnerID       primitive.ObjectID `bson:"owner_id" index:"name=owner_created"`
+	Created       time.Time          `bson:"created" index:"desc,name=owner_created"`
+	Title         string             `bson:"title" index:"text"`
+	Body          string             `bson:"body" index:"text"`
+	ExpiresAt     time.Time          `bson:"expires_at" index:"ttl=1h"`
+	Address       struct {
+		Location bson.M `bson:"location" index:"2dsphere"`
+	} `bson:"address"`
+}
+
+func (d *indexedDoc) Indexes() []Index {
+	return []Index{
+		{Keys: bson.D{bson.E{Key: "level", Value: Ascending}}, PartialFilter: bson.D{bson.E{Key: "is_deleted", Value: false}}},
+	}
+}
+
+type liveDoc struct {
+	document.Base `bson:",inline"`
+	Email         string `bson:"email" index:"unique,live"`
+	Org           string `bson:"org" index:"name=org_slug"`
+	Slug          string `bson:"slug" index:"unique,live,name=org_slug"`
+}
+
+type badTagDoc struct {
+	document.Base `bson:",inline"`
+	Email         string `bson:"email" index:"uniq"`
+}
+
+func TestDeclared(t *testing.T) {
+	declared, err := Declared(&indexedDoc{})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(declared))
+
+	assert.Equal(t, "email_1", declared[0].Name)
+	assert.True(t, declared[0].Unique)
+	assert.True(t, declared[0].Sparse)
+
+	assert.Equal(t, "owner_created", declared[1].Name)
+	assert.Equal(t, bson.D{bson.E{Key: "owner_id", Value: Ascending}, bson.E{Key: "created", Value: Descending}}, declared[1].Keys)
+
+	assert.Equal(t, "title_text_body_text", declared[2].Name)
+	assert.Equal(t, 2, len(declared[2].Keys))
+
+	assert.Equal(t, int32(3600), *declared[3].ExpireAfterSeconds)
+
+	assert.Equal(t, "address.location_2dsphere", declared[4].Name)
+
+	assert.Equal(t, "level_1", declared[5].Name)
+	assert.Equal(t, "is_deleted", declared[5].PartialFilter[0].Key)
+
+	//Test Invalid Tag Options
+	_, err = Declared(&badTagDoc{})
+	assert.Error(t, err)
+}
+
+type category struct {
+	document.Base `bson:",inline"`
+	Slug          string     `bson:"slug" index:"unique"`
+	Parent        *category  `bson:"parent"`
+	Children      []category `bson:"children"`
+}
+
+func TestDeclared_Recursive(t *testing.T) {
+	declared, err := Declared(&category{})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(declared)) {
+		assert.Equal(t, "slug_1", declared[0].Name)
+	}
+}
+
+func TestDeclared_Live(t *testing.T) {
+	declared, err := Declared(&liveDoc{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(declared))
+
+	assert.True(t, declared[0].Unique)
+	assert.Equal(t, LiveFilter(), declared[0].PartialFilter)
+
+	assert.Equal(t, "org_slug", declared[1].Name)
+	assert.Equal(t, 2, len(declared[1].Keys))
+	assert.True(t, declared[1].Unique)
+	assert.Equal(t, LiveFilter(), declared[1].PartialFilter)
+
+	_, err = parseTag("email", "unique,sparse,live")
+	assert.Error(t, err)
+}
+
+func TestUniqueLive(t *testing.T) {
+	idx := UniqueLive(bson.D{bson.E{Key: "email", Value: Ascending}})
+	assert.True(t, idx.Unique)
+	assert.Equal(t, LiveFilter(), idx.PartialFilter)
+}
+
+func TestDefaultName(t *testing.T) {
+	assert.Equal(t, "owner_id_1_created_at_-1", DefaultName(bson.D{
+		bson.E{Key: "owner_id", Value: Ascending},
+		bson.E{Key: "created_at", Value: Descending},
+	}))
+}
+
+func TestIndex_Model(t *testing.T) {
+	ttl := int32(60)
+	model := Index{Name: "email_1", Keys: bson.D{bson.E{Key: "email", Value: Ascending}}, Unique: true, ExpireAfterSeconds: &ttl}.Model()
+
+	assert.Equal(t, "email_1", *model.Options.Name)
+	assert.True(t, *model.Options.Unique)
+	assert.Nil(t, model.Options.Sparse)
+	assert.Equal(t, int32(60), *model.Options.ExpireAfterSeconds)
+}
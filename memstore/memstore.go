@@ -0,0 +1,838 @@
+// Package memstore is an in-memory implementation of database.Store for unit tests that run without MongoDB.
+//
+// Documents are stored as BSON per collection. Filters support the comparison, logical, element and array query
+// operators, and UpdateMany supports the common field and array update operators. Soft delete filtering, schema
+// upgrades, validation, actor stamping and document hooks behave like database.Client; hooks receive a nil
+// *mongo.Database. Relation population, delete policies, tenancy, auditing and revisions are not applied, and
+// aggregations only support the $match, $sort, $skip, $limit, $project and $count stages.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/jcobhams/asari/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Client stores documents in memory. The zero value is not usable, use New.
+	Client struct {
+		mu          sync.RWMutex
+		collections map[string][]bson.Raw
+		attributed  map[string]bool
+	}
+
+	schemaVersioned interface {
+		SetSchemaVersion(version int)
+	}
+)
+
+var (
+	_ database.Store         = (*Client)(nil)
+	_ database.BatchInserter = (*Client)(nil)
+)
+
+// New returns an empty Client.
+func New() *Client {
+	return &Client{collections: map[string][]bson.Raw{}}
+}
+
+// SetAttributedCollections lists the collections whose documents embed document.Attribution. See
+// database.Client.SetAttributedCollections
+func (c *Client) SetAttributedCollections(collections ...string) {
+	attributed := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		attributed[collection] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attributed = attributed
+}
+
+// Reset removes every document from every collection.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.collections = map[string][]bson.Raw{}
+}
+
+// FindOne searches for a single document that matches the provided filters. See database.Client.FindOne
+// The Projection, Sort and Skip of findOneOptions are applied.
+func (c *Client) FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+	if err := validateProjection(projection); err != nil {
+		return err
+	}
+
+	opts := options.MergeFindOneOptions(findOneOptions...)
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	var skip int64
+	if opts.Skip != nil {
+		skip = *opts.Skip
+	}
+	return c.findOne(ctx, collection, filters, target, opts.Projection, opts.Sort, skip)
+}
+
+// FindOneByID finds a document that matches the provided ID in the collection. See database.Client.FindOneByID
+func (c *Client) FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) error {
+	if err := validateProjection(projection); err != nil {
+		return err
+	}
+	filters := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: id}).GetFilters()
+	return c.findOne(ctx, collection, filters, target, projection, nil, 0)
+}
+
+// FindOneByField finds a document that matches the provided field and value pair. See database.Client.FindOneByField
+func (c *Client) FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) error {
+	if err := validateProjection(projection); err != nil {
+		return err
+	}
+	filters := queryfilter.New().AddFilter(bson.E{Key: field, Value: value}).GetFilters()
+	return c.findOne(ctx, collection, filters, target, projection, nil, 0)
+}
+
+func (c *Client) findOne(ctx context.Context, collection string, filters []bson.E, target, projection, sort interface{}, skip int64) error {
+	if err := validateDocumentKind(target); err != nil {
+		return err
+	}
+
+	filters = applyIsDeletedFilter(filters)
+	if err := validateFilters(filters); err != nil {
+		return err
+	}
+
+	if preFindOne, ok := target.(document.PreFindOne); ok {
+		if err := preFindOne.PreFindOne(nil); err != nil {
+			return &database.HookError{Hook: "PreFindOne", Err: err}
+		}
+	}
+
+	docs, err := c.find(collection, filters, sort, skip, 1, projection)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return database.ErrNotFound
+	}
+	if err := database.Decode(docs[0], target); err != nil {
+		return err
+	}
+
+	if postFindOne, ok := target.(document.PostFindOne); ok {
+		if err := postFindOne.PostFindOne(nil); err != nil {
+			return &database.HookError{Hook: "PostFindOne", Err: err}
+		}
+	}
+	return nil
+}
+
+// FindPaginated searches for documents that match the provided filters a page at a time. See database.Client.FindPaginated
+func (c *Client) FindPaginated(ctx context.Context, collection string, pageOptions database.PageOpts, filters []bson.E, projection interface{}, sort bson.D) (*database.PaginatedResult, error) {
+	if sort == nil {
+		sort = bson.D{bson.E{Key: "_id", Value: -1}}
+	}
+
+	filters = applyIsDeletedFilter(filters)
+	if err := validateFilters(filters); err != nil {
+		return nil, err
+	}
+	if err := validateProjection(projection); err != nil {
+		return nil, err
+	}
+
+	paginator := database.NewPaginator(pageOptions)
+	paginator.SetOffset()
+
+	total, err := c.find(collection, filters, nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	paginator.TotalRows = int64(len(total))
+
+	cur, err := c.cursor(collection, filters, sort, paginator.Offset, paginator.PerPage, projection)
+	if err != nil {
+		return nil, err
+	}
+
+	paginator.SetTotalPages()
+	paginator.SetPrevPage()
+	paginator.SetNextPage()
+	return &database.PaginatedResult{Cursor: cur, Paginator: *paginator}, nil
+}
+
+// FindLast returns the most recent document in the collection that matches the provided filters.
+func (c *Client) FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) error {
+	if err := validateDocumentKind(target); err != nil {
+		return err
+	}
+	if err := validateProjection(projection); err != nil {
+		return err
+	}
+
+	filters = applyIsDeletedFilter(filters)
+	if err := validateFilters(filters); err != nil {
+		return err
+	}
+
+	docs, err := c.find(collection, filters, bson.D{bson.E{Key: "_id", Value: -1}}, 0, 1, projection)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return database.ErrNotFound
+	}
+	return database.Decode(docs[0], target)
+}
+
+// FindLastN returns the N (limit) most recent documents in the collection that matches the provided filters.
+func (c *Client) FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (*mongo.Cursor, error) {
+	if err := validateProjection(projection); err != nil {
+		return nil, err
+	}
+
+	filters = applyIsDeletedFilter(filters)
+	if err := validateFilters(filters); err != nil {
+		return nil, err
+	}
+	return c.cursor(collection, filters, bson.D{bson.E{Key: "_id", Value: -1}}, 0, int64(limit), projection)
+}
+
+// FindAll returns a cursor over all the documents that match the filters.
+func (c *Client) FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (*mongo.Cursor, error) {
+	if sort == nil {
+		sort = bson.D{bson.E{Key: "_id", Value: -1}}
+	}
+	if err := validateProjection(projection); err != nil {
+		return nil, err
+	}
+
+	filters = applyIsDeletedFilter(filters)
+	if err := validateFilters(filters); err != nil {
+		return nil, err
+	}
+	return c.cursor(collection, filters, sort, 0, 0, projection)
+}
+
+// DecodeAll decodes every document left in cur into results, which must be a pointer to a slice, and closes the cursor.
+// Relations are not populated.
+func (c *Client) DecodeAll(ctx context.Context, cur *mongo.Cursor, results interface{}) error {
+	defer cur.Close(context.Background())
+
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return database.ErrNotSlice
+	}
+
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	for cur.Next(ctx) {
+		elemValueType := elemType
+		if elemType.Kind() == reflect.Ptr {
+			elemValueType = elemType.Elem()
+		}
+		elem := reflect.New(elemValueType)
+		if err := database.Decode(cur.Current, elem.Interface()); err != nil {
+			return err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	rv.Elem().Set(slice)
+	return nil
+}
+
+// SaveDocument creates a new document or replaces an existing one and fires the same hooks as database.Client.
+func (c *Client) SaveDocument(ctx context.Context, collection string, doc interface{}) (interface{}, error) {
+	if err := validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	d := doc.(document.Document)
+	if !d.CanSave() {
+		return nil, database.ErrNotSetup
+	}
+
+	if upgrader, ok := doc.(document.Upgrader); ok {
+		if versioned, ok := doc.(schemaVersioned); ok {
+			versioned.SetSchemaVersion(document.CurrentSchemaVersion(upgrader))
+		}
+	}
+
+	if d.IsNew() {
+		return c.create(ctx, "SaveDocument", collection, doc)
+	}
+
+	if attributable, ok := doc.(document.Attributable); ok && database.ActorFromContext(ctx) != nil {
+		attributable.SetUpdatedBy(database.ActorFromContext(ctx))
+	}
+
+	if preUpdater, ok := doc.(document.PreUpdater); ok {
+		if err := preUpdater.PreUpdate(nil); err != nil {
+			return nil, &database.HookError{Hook: "PreUpdate", Err: err}
+		}
+	}
+
+	if err := validator.Validate(ctx, nil, doc); err != nil {
+		return nil, err
+	}
+
+	filters := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: d.GetID()}).GetFilters()
+	if _, err := c.replace("SaveDocument", collection, filters, doc); err != nil {
+		return doc, err
+	}
+
+	if postUpdater, ok := doc.(document.PostUpdater); ok {
+		if err := postUpdater.PostUpdate(nil); err != nil {
+			return nil, &database.HookError{Hook: "PostUpdate", Err: err}
+		}
+	}
+	return doc, nil
+}
+
+// InsertDocuments inserts new docs in collection like database.Client, every document on its own. Errors are returned
+// in a database.DocumentErrors.
+func (c *Client) InsertDocuments(ctx context.Context, collection string, docs []interface{}) error {
+	failed := database.DocumentErrors{}
+	for i, doc := range docs {
+		if err := validateDocumentKind(doc); err != nil {
+			failed[i] = err
+			continue
+		}
+
+		d := doc.(document.Document)
+		if !d.CanSave() {
+			failed[i] = database.ErrNotSetup
+			continue
+		}
+		if !d.IsNew() {
+			failed[i] = database.ErrNotNew
+			continue
+		}
+
+		if upgrader, ok := doc.(document.Upgrader); ok {
+			if versioned, ok := doc.(schemaVersioned); ok {
+				versioned.SetSchemaVersion(document.CurrentSchemaVersion(upgrader))
+			}
+		}
+		if _, err := c.create(ctx, "InsertDocuments", collection, doc); err != nil {
+			failed[i] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// create inserts the new doc between its PreCreate and PostCreate hooks.
+func (c *Client) create(ctx context.Context, operation, collection string, doc interface{}) (interface{}, error) {
+	if attributable, ok := doc.(document.Attributable); ok && database.ActorFromContext(ctx) != nil {
+		attributable.SetCreatedBy(database.ActorFromContext(ctx))
+		attributable.SetUpdatedBy(database.ActorFromContext(ctx))
+	}
+
+	if preCreator, ok := doc.(document.PreCreator); ok {
+		if err := preCreator.PreCreate(nil); err != nil {
+			return nil, &database.HookError{Hook: "PreCreate", Err: err}
+		}
+	}
+
+	if err := validator.Validate(ctx, nil, doc); err != nil {
+		return nil, err
+	}
+
+	if err := c.insert(operation, collection, doc); err != nil {
+		return doc, err
+	}
+	doc.(document.Document).SetIsNew(false)
+
+	if postCreator, ok := doc.(document.PostCreator); ok {
+		if err := postCreator.PostCreate(nil); err != nil {
+			return nil, &database.HookError{Hook: "PostCreate", Err: err}
+		}
+	}
+	return doc, nil
+}
+
+// UpdateMany applies the operators configured in the UpdateManyBuilder to the documents that match the filters.
+// The Upsert option inserts a document built from the equality filters when none match.
+func (c *Client) UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if !updateBuilder.HasValues() {
+		return nil, database.ErrEmptyUpdate
+	}
+	if err := validateFilters(filters); err != nil {
+		return nil, err
+	}
+
+	update := updateBuilder.Get()
+	c.mu.RLock()
+	attributed := c.attributed[collection]
+	c.mu.RUnlock()
+	if actor := database.ActorFromContext(ctx); actor != nil && attributed && !setsField(update, "updated_by") {
+		update = append(append(bson.D{}, update...), bson.E{Key: operator.Set, Value: []bson.E{{Key: "updated_by", Value: actor}}})
+	}
+	updateDoc, err := normalize(update)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := normalize(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := &mongo.UpdateResult{}
+	docs := c.collections[collection]
+	for i, raw := range docs {
+		doc, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := match(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		result.MatchedCount++
+		updated, err := applyUpdate(doc, updateDoc, false)
+		if err != nil {
+			return nil, writeError("UpdateMany", collection, err)
+		}
+		updatedRaw, err := bson.Marshal(updated)
+		if err != nil {
+			return nil, err
+		}
+		if string(updatedRaw) != string(raw) {
+			docs[i] = updatedRaw
+			result.ModifiedCount++
+		}
+	}
+
+	if result.MatchedCount == 0 && updateOptions != nil && updateOptions.Upsert != nil && *updateOptions.Upsert {
+		seed := bson.D{}
+		for _, f := range filter {
+			if _, isOperator := operatorExpression(f.Value); !isOperator && f.Key[0] != '$' {
+				seed = append(seed, f)
+			}
+		}
+		doc, err := applyUpdate(seed, updateDoc, true)
+		if err != nil {
+			return nil, writeError("UpdateMany", collection, err)
+		}
+		if _, ok := get(doc, []string{"_id"}); !ok {
+			doc = append(bson.D{bson.E{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, raw)
+		result.UpsertedCount = 1
+		result.UpsertedID, _ = get(doc, []string{"_id"})
+	}
+
+	c.collections[collection] = docs
+	return result, nil
+}
+
+// CountDocuments returns a count of all the documents that match the provided filters.
+func (c *Client) CountDocuments(ctx context.Context, collection string, filters interface{}) (int, error) {
+	docs, err := c.find(collection, filters, nil, 0, 0, nil)
+	return len(docs), err
+}
+
+// SoftDeleteDocument marks a document as deleted. See database.Client.SoftDeleteDocument
+func (c *Client) SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	if err := validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	d := doc.(document.Document)
+	d.BeforeSoftDelete()
+	if attributable, ok := doc.(document.Attributable); ok && database.ActorFromContext(ctx) != nil {
+		attributable.SetDeletedBy(database.ActorFromContext(ctx))
+	}
+
+	if preSoftDeleter, ok := doc.(document.PreSoftDeleter); ok {
+		if err := preSoftDeleter.PreSoftDelete(nil); err != nil {
+			return nil, &database.HookError{Hook: "PreSoftDelete", Err: err}
+		}
+	}
+
+	filters := queryfilter.New().AddFilter(bson.E{Key: "_id", Value: d.GetID()}).GetFilters()
+	result, err := c.replace("SoftDeleteDocument", collection, filters, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if postSoftDeleter, ok := doc.(document.PostSoftDeleter); ok {
+		if err := postSoftDeleter.PostSoftDelete(nil); err != nil {
+			return nil, &database.HookError{Hook: "PostSoftDelete", Err: err}
+		}
+	}
+	return result, nil
+}
+
+// HardDeleteDocument removes a document. See database.Client.HardDeleteDocument
+func (c *Client) HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.DeleteResult, error) {
+	if err := validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	if preHardDeleter, ok := doc.(document.PreHardDeleter); ok {
+		if err := preHardDeleter.PreHardDelete(nil); err != nil {
+			return nil, &database.HookError{Hook: "PreHardDelete", Err: err}
+		}
+	}
+
+	filter, err := normalize(queryfilter.New().AddFilter(bson.E{Key: "_id", Value: doc.(document.Document).GetID()}).GetFilters())
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	result := &mongo.DeleteResult{}
+	docs := c.collections[collection]
+	for i, raw := range docs {
+		stored, err := decode(raw)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		matched, err := match(stored, filter)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		if matched {
+			c.collections[collection] = append(append([]bson.Raw{}, docs[:i]...), docs[i+1:]...)
+			result.DeletedCount = 1
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if postHardDeleter, ok := doc.(document.PostHardDeleter); ok {
+		if err := postHardDeleter.PostHardDelete(nil); err != nil {
+			return nil, &database.HookError{Hook: "PostHardDelete", Err: err}
+		}
+	}
+	return result, nil
+}
+
+// RestoreDocument reverses SoftDeleteDocument.
+func (c *Client) RestoreDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	if err := validateDocumentKind(doc); err != nil {
+		return nil, err
+	}
+
+	d := doc.(document.Document)
+	restorable, ok := d.(document.Restorable)
+	if !ok {
+		return nil, database.ErrNotRestorable
+	}
+	restorable.BeforeRestore()
+	if attributable, ok := doc.(document.Attributable); ok {
+		attributable.SetDeletedBy(nil)
+	}
+
+	filters := queryfilter.NewWithDeleted().AddFilter(bson.E{Key: "_id", Value: d.GetID()}).GetFilters()
+	return c.replace("RestoreDocument", collection, filters, doc)
+}
+
+// Aggregate runs a pipeline made of $match, $sort, $skip, $limit, $project and $count stages.
+func (c *Client) Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error) {
+	c.mu.RLock()
+	stored := append([]bson.Raw{}, c.collections[collection]...)
+	c.mu.RUnlock()
+
+	docs := make([]bson.D, 0, len(stored))
+	for _, raw := range stored {
+		doc, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, errors.New("asari: aggregation stages must have a single key")
+		}
+		var err error
+		if docs, err = applyStage(docs, stage[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		results[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(results, nil, nil)
+}
+
+func applyStage(docs []bson.D, stage bson.E) ([]bson.D, error) {
+	spec, err := normalize(bson.D{stage})
+	if err != nil {
+		return nil, err
+	}
+	value := spec[0].Value
+
+	switch stage.Key {
+	case "$match":
+		filter, _ := value.(primitive.D)
+		matched := []bson.D{}
+		for _, doc := range docs {
+			ok, err := match(doc, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, doc)
+			}
+		}
+		return matched, nil
+	case "$sort":
+		order, _ := value.(primitive.D)
+		sortDocuments(docs, order)
+		return docs, nil
+	case "$skip", "$limit":
+		n, ok := number(value)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("asari: %s requires a number", stage.Key))
+		}
+		return window(docs, stage.Key, int(n)), nil
+	case "$project":
+		projection, _ := value.(primitive.D)
+		projected := make([]bson.D, 0, len(docs))
+		for _, doc := range docs {
+			p, err := project(doc, projection)
+			if err != nil {
+				return nil, err
+			}
+			projected = append(projected, p)
+		}
+		return projected, nil
+	case "$count":
+		field, ok := value.(string)
+		if !ok {
+			return nil, errors.New("asari: $count requires a field name")
+		}
+		return []bson.D{{bson.E{Key: field, Value: int32(len(docs))}}}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("asari: memstore does not support the %s aggregation stage", stage.Key))
+}
+
+func window(docs []bson.D, stage string, n int) []bson.D {
+	if n < 0 {
+		n = 0
+	}
+	if stage == "$skip" {
+		if n > len(docs) {
+			return []bson.D{}
+		}
+		return docs[n:]
+	}
+	if n > 0 && n < len(docs) {
+		return docs[:n]
+	}
+	return docs
+}
+
+// find returns the documents of collection that match filters, sorted, windowed by skip and limit (0 for no limit)
+// and projected.
+func (c *Client) find(collection string, filters, sort interface{}, skip, limit int64, projection interface{}) ([]bson.Raw, error) {
+	filter, err := normalize(filters)
+	if err != nil {
+		return nil, err
+	}
+	order, err := normalize(sort)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := normalize(projection)
+	if err != nil {
+		return nil, err
+	}
+	fields = versionedFields(fields)
+
+	c.mu.RLock()
+	stored := append([]bson.Raw{}, c.collections[collection]...)
+	c.mu.RUnlock()
+
+	var docs []bson.D
+	for _, raw := range stored {
+		doc, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := match(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			docs = append(docs, doc)
+		}
+	}
+
+	sortDocuments(docs, order)
+	docs = window(window(docs, "$skip", int(skip)), "$limit", int(limit))
+
+	results := make([]bson.Raw, 0, len(docs))
+	for _, doc := range docs {
+		projected, err := project(doc, fields)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := bson.Marshal(projected)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, raw)
+	}
+	return results, nil
+}
+
+func (c *Client) cursor(collection string, filters, sort interface{}, skip, limit int64, projection interface{}) (*mongo.Cursor, error) {
+	docs, err := c.find(collection, filters, sort, skip, limit, projection)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		results[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(results, nil, nil)
+}
+
+func (c *Client) insert(operation, collection string, doc interface{}) error {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	raw := bson.Raw(b)
+	id := raw.Lookup("_id")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, stored := range c.collections[collection] {
+		if stored.Lookup("_id").Equal(id) {
+			return &database.WriteError{
+				Operation:  operation,
+				Collection: collection,
+				Err: &database.DuplicateKeyError{
+					Index:  "_id_",
+					Fields: []string{"_id"},
+					Err:    errors.New(fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_", collection)),
+				},
+			}
+		}
+	}
+	c.collections[collection] = append(c.collections[collection], raw)
+	return nil
+}
+
+// replace replaces the first document matching filters with doc and returns the replaced document like
+// FindOneAndReplace.
+func (c *Client) replace(operation, collection string, filters []bson.E, doc interface{}) (*mongo.SingleResult, error) {
+	if err := validateFilters(filters); err != nil {
+		return nil, err
+	}
+	filter, err := normalize(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.(document.Document).BeforeUpdate()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, stored := range c.collections[collection] {
+		current, err := decode(stored)
+		if err != nil {
+			return nil, err
+		}
+		if matched, err := match(current, filter); err != nil {
+			return nil, err
+		} else if matched {
+			c.collections[collection][i] = raw
+			return mongo.NewSingleResultFromDocument(stored, nil, nil), nil
+		}
+	}
+	return nil, writeError(operation, collection, mongo.ErrNoDocuments)
+}
+
+func decode(raw bson.Raw) (bson.D, error) {
+	var doc bson.D
+	return doc, bson.Unmarshal(raw, &doc)
+}
+
+func writeError(operation, collection string, err error) error {
+	return &database.WriteError{Operation: operation, Collection: collection, Err: err}
+}
+
+func applyIsDeletedFilter(filters []bson.E) []bson.E {
+	for _, v := range filters {
+		if v.Key == "is_deleted" {
+			return filters
+		}
+	}
+	return append(filters, bson.E{Key: "is_deleted", Value: false})
+}
+
+func validateDocumentKind(obj interface{}) error {
+	if obj == nil || reflect.TypeOf(obj).Kind() != reflect.Ptr {
+		return database.ErrNotPointer
+	}
+	return nil
+}
+
+func validateProjection(projection interface{}) error {
+	if projection != nil {
+		if _, ok := projection.(bson.M); !ok {
+			return database.ErrInvalidProjection
+		}
+	}
+	return nil
+}
+
+func validateFilters(filters []bson.E) error {
+	for _, f := range filters {
+		if f.Key == "" {
+			return database.ErrEmptyFilterKey
+		}
+	}
+	return nil
+}
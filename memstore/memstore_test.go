@@ -0,0 +1,264 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+)
+
+const UserCollection string = "users"
+
+type User struct {
+	document.Base        `bson:",inline"`
+	document.Attribution `bson:",inline"`
+	FirstName            string `bson:"first_name" asari:"required"`
+	Level                int    `bson:"level"`
+	hooks                []string
+}
+
+func (u *User) PreCreate(dbConnection *mongo.Database) error {
+	u.hooks = append(u.hooks, "PreCreate")
+	return nil
+}
+
+func (u *User) PostUpdate(dbConnection *mongo.Database) error {
+	u.hooks = append(u.hooks, "PostUpdate")
+	return nil
+}
+
+func (u *User) PreSoftDelete(dbConnection *mongo.Database) error {
+	if u.Level > 10 {
+		return errors.New("admins cannot be deleted")
+	}
+	return nil
+}
+
+func newUser(store database.Store, name string, level int) *User {
+	user := &User{FirstName: name, Level: level}
+	user.Setup()
+	store.SaveDocument(nil, UserCollection, user)
+	return user
+}
+
+func TestClient_SaveDocument(t *testing.T) {
+	store := New()
+	ctx := database.WithActor(context.Background(), "joseph")
+
+	user := &User{FirstName: "Joseph"}
+	user.Setup()
+	_, err := store.SaveDocument(ctx, UserCollection, user)
+	assert.Nil(t, err)
+	assert.False(t, user.IsNew())
+	assert.Equal(t, "joseph", user.CreatedBy)
+
+	user.Level = 2
+	_, err = store.SaveDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PreCreate", "PostUpdate"}, user.hooks)
+
+	found := &User{}
+	assert.Nil(t, store.FindOneByID(nil, UserCollection, user.ID, nil, found))
+	assert.Equal(t, 2, found.Level)
+	assert.Equal(t, "joseph", found.CreatedBy)
+
+	//Test Duplicate IDs And Validation Are Rejected
+	duplicate := &User{FirstName: "Joseph"}
+	duplicate.Setup()
+	duplicate.ID = user.ID
+	_, err = store.SaveDocument(nil, UserCollection, duplicate)
+	assert.True(t, errors.Is(err, database.ErrDuplicateKey))
+
+	invalid := &User{}
+	invalid.Setup()
+	_, err = store.SaveDocument(nil, UserCollection, invalid)
+	var validationError *database.ValidationError
+	assert.True(t, errors.As(err, &validationError))
+
+	_, err = store.SaveDocument(nil, UserCollection, &User{})
+	assert.Equal(t, database.ErrNotSetup, err)
+}
+
+func TestClient_InsertDocuments(t *testing.T) {
+	store := New()
+	saved := newUser(store, "Joseph", 1)
+
+	ada := &User{FirstName: "Ada"}
+	ada.Setup()
+	invalid := &User{}
+	invalid.Setup()
+	grace := &User{FirstName: "Grace"}
+	grace.Setup()
+
+	err := store.InsertDocuments(nil, UserCollection, []interface{}{ada, invalid, saved, &User{}, grace})
+	var failed database.DocumentErrors
+	if assert.True(t, errors.As(err, &failed)) && assert.Len(t, failed, 3) {
+		assert.IsType(t, &database.ValidationError{}, failed[1])
+		assert.Equal(t, database.ErrNotNew, failed[2])
+		assert.Equal(t, database.ErrNotSetup, failed[3])
+	}
+	assert.False(t, grace.IsNew())
+	assert.Equal(t, []string{"PreCreate"}, ada.hooks)
+
+	count, _ := store.CountDocuments(nil, UserCollection, bson.D{})
+	assert.Equal(t, 3, count)
+	assert.Nil(t, store.InsertDocuments(nil, UserCollection, nil))
+}
+
+func TestClient_Find(t *testing.T) {
+	store := New()
+	joseph := newUser(store, "Joseph", 1)
+	newUser(store, "Jane", 2)
+	newUser(store, "John", 3)
+
+	found := &User{}
+	assert.Nil(t, store.FindOneByField(nil, UserCollection, "first_name", "Jane", nil, found))
+	assert.Equal(t, 2, found.Level)
+
+	assert.Equal(t, database.ErrNotFound, store.FindOneByField(nil, UserCollection, "first_name", "Jim", nil, found))
+	assert.Equal(t, database.ErrInvalidProjection, store.FindOneByID(nil, UserCollection, joseph.ID, map[string]int{"level": 1}, found))
+
+	projected := &User{}
+	assert.Nil(t, store.FindOneByID(nil, UserCollection, joseph.ID, bson.M{"first_name": 1}, projected))
+	assert.Equal(t, "Joseph", projected.FirstName)
+	assert.Equal(t, 0, projected.Level)
+	assert.Equal(t, joseph.ID, projected.ID)
+
+	last := &User{}
+	assert.Nil(t, store.FindLast(nil, UserCollection, nil, nil, last))
+	assert.Equal(t, "John", last.FirstName)
+
+	cur, err := store.FindAll(nil, UserCollection, []bson.E{{Key: "level", Value: bson.D{{Key: operator.Gte, Value: 2}}}}, nil, bson.D{{Key: "level", Value: 1}})
+	assert.Nil(t, err)
+	var users []User
+	assert.Nil(t, store.DecodeAll(nil, cur, &users))
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "Jane", users[0].FirstName)
+		assert.Equal(t, "John", users[1].FirstName)
+	}
+
+	var user User
+	cur, _ = store.FindAll(nil, UserCollection, nil, nil, nil)
+	assert.Equal(t, database.ErrNotSlice, store.DecodeAll(nil, cur, &user))
+
+	result, err := store.FindPaginated(nil, UserCollection, database.PageOpts{Page: 2, PerPage: 2}, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), result.TotalRows)
+	assert.Equal(t, int64(2), result.TotalPages)
+	var page []*User
+	assert.Nil(t, store.DecodeAll(nil, result.Cursor, &page))
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, "Joseph", page[0].FirstName)
+	}
+
+	count, err := store.CountDocuments(nil, UserCollection, bson.M{"level": bson.M{operator.Lt: 3}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestClient_Delete(t *testing.T) {
+	store := New()
+	user := newUser(store, "Joseph", 1)
+	admin := newUser(store, "Jane", 11)
+
+	_, err := store.SoftDeleteDocument(nil, UserCollection, admin)
+	assert.True(t, errors.As(err, new(*database.HookError)))
+
+	result, err := store.SoftDeleteDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+	replaced := &User{}
+	assert.Nil(t, result.Decode(replaced))
+	assert.False(t, replaced.IsDeleted)
+
+	//Test Soft Deleted Documents Are Hidden
+	assert.Equal(t, database.ErrNotFound, store.FindOneByID(nil, UserCollection, user.ID, nil, &User{}))
+	count, _ := store.CountDocuments(nil, UserCollection, bson.M{"is_deleted": true})
+	assert.Equal(t, 1, count)
+
+	_, err = store.SoftDeleteDocument(nil, UserCollection, user)
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+
+	_, err = store.RestoreDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+	assert.Nil(t, store.FindOneByID(nil, UserCollection, user.ID, nil, &User{}))
+
+	deleted, err := store.HardDeleteDocument(nil, UserCollection, user)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted.DeletedCount)
+	count, _ = store.CountDocuments(nil, UserCollection, nil)
+	assert.Equal(t, 1, count)
+}
+
+func TestClient_UpdateMany(t *testing.T) {
+	store := New()
+	newUser(store, "Joseph", 1)
+	newUser(store, "Jane", 2)
+
+	_, err := store.UpdateMany(nil, UserCollection, nil, builder.NewUpdateManyBuilder(), nil)
+	assert.Equal(t, database.ErrEmptyUpdate, err)
+
+	_, err = store.UpdateMany(nil, UserCollection, []bson.E{{Key: "", Value: 1}}, builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "level", Value: 5}), options.Update().SetUpsert(true))
+	assert.Equal(t, database.ErrEmptyFilterKey, err)
+
+	//Test Only Attributed Collections Get updated_by
+	ctx := database.WithActor(nil, "batch")
+	store.UpdateMany(ctx, UserCollection, nil, builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "last_name", Value: "Doe"}), nil)
+	jane := &User{}
+	store.FindOneByField(nil, UserCollection, "first_name", "Jane", nil, jane)
+	assert.Nil(t, jane.UpdatedBy)
+
+	store.SetAttributedCollections(UserCollection)
+	ub := builder.NewUpdateManyBuilder().Add(operator.Mul, bson.E{Key: "level", Value: 10})
+	result, err := store.UpdateMany(ctx, UserCollection, []bson.E{{Key: "level", Value: bson.D{{Key: operator.Gt, Value: 1}}}}, ub, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.MatchedCount)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	jane = &User{}
+	store.FindOneByField(nil, UserCollection, "first_name", "Jane", nil, jane)
+	assert.Equal(t, 20, jane.Level)
+	assert.Equal(t, "batch", jane.UpdatedBy)
+
+	//Test An updated_by Set By The Caller Is Kept
+	ub = builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "updated_by", Value: "importer"})
+	store.UpdateMany(ctx, UserCollection, []bson.E{{Key: "first_name", Value: "Jane"}}, ub, nil)
+	store.FindOneByField(nil, UserCollection, "first_name", "Jane", nil, jane)
+	assert.Equal(t, "importer", jane.UpdatedBy)
+
+	ub = builder.NewUpdateManyBuilder().Add(operator.Set, bson.E{Key: "level", Value: 5})
+	result, err = store.UpdateMany(nil, UserCollection, []bson.E{{Key: "first_name", Value: "John"}}, ub, options.Update().SetUpsert(true))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.UpsertedCount)
+
+	count, _ := store.CountDocuments(nil, UserCollection, bson.M{"first_name": "John", "level": 5})
+	assert.Equal(t, 1, count)
+}
+
+func TestClient_Aggregate(t *testing.T) {
+	store := New()
+	newUser(store, "Joseph", 1)
+	newUser(store, "Jane", 2)
+	newUser(store, "John", 3)
+
+	cur, err := store.Aggregate(nil, UserCollection, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "level", Value: bson.D{{Key: "$gte", Value: 2}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "level", Value: -1}}}},
+		{{Key: "$limit", Value: 1}},
+		{{Key: "$project", Value: bson.D{{Key: "first_name", Value: 1}, {Key: "_id", Value: 0}}}},
+	}, nil)
+	assert.Nil(t, err)
+
+	var results []bson.M
+	assert.Nil(t, cur.All(nil, &results))
+	assert.Equal(t, []bson.M{{"first_name": "John"}}, results)
+
+	_, err = store.Aggregate(nil, UserCollection, mongo.Pipeline{{{Key: "$lookup", Value: bson.D{}}}}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,583 @@
+package memstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// normalize converts a filter, update, projection or sort into a bson.D holding the same types documents decode to,
+// so they can be compared with reflect.DeepEqual - eg: []bson.E becomes primitive.D and []T becomes primitive.A.
+func normalize(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	if e, ok := v.([]bson.E); ok {
+		v = bson.D(e)
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	return d, bson.Unmarshal(raw, &d)
+}
+
+// lookup returns the values at the dotted path of v. Arrays of documents are traversed like MongoDB does so a path
+// can match several values.
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+
+	switch t := v.(type) {
+	case primitive.D:
+		for _, e := range t {
+			if e.Key == path[0] {
+				return lookup(e.Value, path[1:])
+			}
+		}
+	case primitive.A:
+		var found []interface{}
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i >= 0 && i < len(t) {
+				found = append(found, lookup(t[i], path[1:])...)
+			}
+			return found
+		}
+		for _, elem := range t {
+			if _, ok := elem.(primitive.D); ok {
+				found = append(found, lookup(elem, path)...)
+			}
+		}
+		return found
+	}
+	return nil
+}
+
+func split(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// match reports whether doc matches filter.
+func match(doc bson.D, filter bson.D) (bool, error) {
+	for _, f := range filter {
+		ok, err := matchElement(doc, f)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchElement(doc bson.D, f bson.E) (bool, error) {
+	switch f.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := f.Value.(primitive.A)
+		if !ok {
+			return false, errors.New(fmt.Sprintf("asari: %s requires an array", f.Key))
+		}
+		for _, clause := range clauses {
+			sub, ok := clause.(primitive.D)
+			if !ok {
+				return false, errors.New(fmt.Sprintf("asari: %s requires an array of documents", f.Key))
+			}
+			matched, err := match(doc, sub)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case f.Key == "$and" && !matched:
+				return false, nil
+			case f.Key == "$or" && matched:
+				return true, nil
+			case f.Key == "$nor" && matched:
+				return false, nil
+			}
+		}
+		return f.Key != "$or", nil
+	}
+	if strings.HasPrefix(f.Key, "$") {
+		return false, errors.New(fmt.Sprintf("asari: memstore does not support the %s query operator", f.Key))
+	}
+
+	return matchCondition(lookup(doc, split(f.Key)), f.Value)
+}
+
+// matchCondition reports whether the values found at a path satisfy condition, which is either an operator
+// expression - eg: {$gt: 1} - or a value to compare with.
+func matchCondition(found []interface{}, condition interface{}) (bool, error) {
+	if expr, ok := operatorExpression(condition); ok {
+		for _, op := range expr {
+			matched, err := matchOperator(found, op, expr)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	if re, ok := condition.(primitive.Regex); ok {
+		return matchRegex(found, re.Pattern, re.Options)
+	}
+	return matchEqual(found, condition), nil
+}
+
+func operatorExpression(v interface{}) (primitive.D, bool) {
+	d, ok := v.(primitive.D)
+	if !ok || len(d) == 0 || !strings.HasPrefix(d[0].Key, "$") {
+		return nil, false
+	}
+	return d, true
+}
+
+func matchOperator(found []interface{}, op bson.E, expr primitive.D) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return matchEqual(found, op.Value), nil
+	case "$ne":
+		return !matchEqual(found, op.Value), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return matchCompare(found, op.Key, op.Value), nil
+	case "$in", "$nin":
+		values, ok := op.Value.(primitive.A)
+		if !ok {
+			return false, errors.New(fmt.Sprintf("asari: %s requires an array", op.Key))
+		}
+		in := false
+		for _, v := range values {
+			if matchEqual(found, v) {
+				in = true
+				break
+			}
+		}
+		return in == (op.Key == "$in"), nil
+	case "$exists":
+		return (len(found) > 0) == truthy(op.Value), nil
+	case "$regex":
+		options := ""
+		for _, e := range expr {
+			if e.Key == "$options" {
+				options, _ = e.Value.(string)
+			}
+		}
+		switch pattern := op.Value.(type) {
+		case string:
+			return matchRegex(found, pattern, options)
+		case primitive.Regex:
+			return matchRegex(found, pattern.Pattern, pattern.Options+options)
+		}
+		return false, errors.New("asari: $regex requires a string or regular expression")
+	case "$options":
+		return true, nil
+	case "$not":
+		matched, err := matchCondition(found, op.Value)
+		return !matched, err
+	case "$size":
+		size, ok := number(op.Value)
+		if !ok {
+			return false, errors.New("asari: $size requires a number")
+		}
+		for _, v := range found {
+			if a, ok := v.(primitive.A); ok && float64(len(a)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		values, ok := op.Value.(primitive.A)
+		if !ok {
+			return false, errors.New("asari: $all requires an array")
+		}
+		for _, v := range values {
+			if !matchEqual(found, v) {
+				return false, nil
+			}
+		}
+		return len(values) > 0, nil
+	case "$elemMatch":
+		condition, ok := op.Value.(primitive.D)
+		if !ok {
+			return false, errors.New("asari: $elemMatch requires a document")
+		}
+		for _, v := range found {
+			a, ok := v.(primitive.A)
+			if !ok {
+				continue
+			}
+			for _, elem := range a {
+				matched, err := matchElem(elem, condition)
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, errors.New(fmt.Sprintf("asari: memstore does not support the %s query operator", op.Key))
+}
+
+// matchElem matches an array element against an $elemMatch or $pull condition.
+func matchElem(elem interface{}, condition interface{}) (bool, error) {
+	if _, ok := operatorExpression(condition); ok {
+		return matchCondition([]interface{}{elem}, condition)
+	}
+	if d, ok := condition.(primitive.D); ok {
+		if doc, ok := elem.(primitive.D); ok {
+			return match(doc, d)
+		}
+		return false, nil
+	}
+	return matchCondition([]interface{}{elem}, condition)
+}
+
+// matchEqual reports whether any found value or element of a found array equals value. A nil value also matches
+// missing fields.
+func matchEqual(found []interface{}, value interface{}) bool {
+	if value == nil && len(found) == 0 {
+		return true
+	}
+	for _, v := range found {
+		if equal(v, value) {
+			return true
+		}
+		if a, ok := v.(primitive.A); ok {
+			for _, elem := range a {
+				if equal(elem, value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchCompare(found []interface{}, op string, value interface{}) bool {
+	candidates := make([]interface{}, 0, len(found))
+	for _, v := range found {
+		if a, ok := v.(primitive.A); ok {
+			candidates = append(candidates, a...)
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+
+	for _, v := range candidates {
+		if typeRank(v) != typeRank(value) {
+			continue
+		}
+		c := compare(v, value)
+		switch {
+		case op == "$gt" && c > 0, op == "$gte" && c >= 0, op == "$lt" && c < 0, op == "$lte" && c <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(found []interface{}, pattern, options string) (bool, error) {
+	flags := ""
+	for _, o := range options {
+		//Go regular expressions have no equivalent of the x option
+		if strings.ContainsRune("ims", o) {
+			flags += string(o)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	for _, v := range found {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+		if a, ok := v.(primitive.A); ok {
+			for _, elem := range a {
+				if s, ok := elem.(string); ok && re.MatchString(s) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func truthy(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	n, ok := number(v)
+	return ok && n != 0
+}
+
+// typeRank orders values of different types like MongoDB's comparison order.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, float64, int:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case primitive.D:
+		return 4
+	case primitive.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+func compare(a, b interface{}) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		return compareFloat(float64(x), float64(b.(primitive.DateTime)))
+	case primitive.Timestamp:
+		y := b.(primitive.Timestamp)
+		if x.T != y.T {
+			return compareFloat(float64(x.T), float64(y.T))
+		}
+		return compareFloat(float64(x.I), float64(y.I))
+	}
+
+	if x, ok := number(a); ok {
+		y, _ := number(b)
+		return compareFloat(x, y)
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y || (math.IsNaN(x) && !math.IsNaN(y)):
+		return -1
+	case x > y || (!math.IsNaN(x) && math.IsNaN(y)):
+		return 1
+	}
+	return 0
+}
+
+// sortDocuments orders docs by the keys of order, 1 ascending and -1 descending.
+func sortDocuments(docs []bson.D, order bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range order {
+			direction := 1
+			if n, ok := number(key.Value); ok && n < 0 {
+				direction = -1
+			}
+			c := compare(first(lookup(docs[i], split(key.Key))), first(lookup(docs[j], split(key.Key))))
+			if c != 0 {
+				return c*direction < 0
+			}
+		}
+		return false
+	})
+}
+
+func first(found []interface{}) interface{} {
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// versionedFields adds the schema version to an inclusion projection like database.Client.
+func versionedFields(projection bson.D) bson.D {
+	inclusion := false
+	for _, p := range projection {
+		if p.Key == document.SchemaVersionField {
+			return projection
+		}
+		if _, ok := operatorExpression(p.Value); p.Key != "_id" && !ok && truthy(p.Value) {
+			inclusion = true
+		}
+	}
+	if !inclusion {
+		return projection
+	}
+	return append(append(bson.D{}, projection...), bson.E{Key: document.SchemaVersionField, Value: int32(1)})
+}
+
+// project applies an inclusion or exclusion projection - eg: bson.M{"email": 1}. _id is included unless excluded.
+func project(doc bson.D, projection bson.D) (bson.D, error) {
+	if len(projection) == 0 {
+		return doc, nil
+	}
+
+	include := map[string]interface{}{}
+	exclude := map[string]interface{}{}
+	keepID := true
+	for _, p := range projection {
+		if p.Key == "_id" {
+			keepID = truthy(p.Value)
+			continue
+		}
+		if _, ok := operatorExpression(p.Value); ok {
+			return nil, errors.New(fmt.Sprintf("asari: memstore does not support projection operators on %s", p.Key))
+		}
+		if truthy(p.Value) {
+			addPath(include, split(p.Key))
+		} else {
+			addPath(exclude, split(p.Key))
+		}
+	}
+	if len(include) > 0 && len(exclude) > 0 {
+		return nil, errors.New("asari: projection cannot mix inclusion and exclusion")
+	}
+
+	var projected bson.D
+	if len(include) > 0 {
+		projected = includeFields(doc, include)
+	} else {
+		projected = excludeFields(doc, exclude)
+	}
+
+	if !keepID {
+		return excludeFields(projected, map[string]interface{}{"_id": nil}), nil
+	}
+	if len(include) > 0 {
+		if id := lookup(doc, []string{"_id"}); len(id) > 0 {
+			projected = append(bson.D{bson.E{Key: "_id", Value: id[0]}}, excludeFields(projected, map[string]interface{}{"_id": nil})...)
+		}
+	}
+	return projected, nil
+}
+
+// addPath adds a dotted path to a tree of projected fields. Leaves are nil.
+func addPath(tree map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		tree[path[0]] = nil
+		return
+	}
+	sub, ok := tree[path[0]].(map[string]interface{})
+	if !ok {
+		if _, leaf := tree[path[0]]; leaf {
+			return
+		}
+		sub = map[string]interface{}{}
+		tree[path[0]] = sub
+	}
+	addPath(sub, path[1:])
+}
+
+func includeFields(doc bson.D, tree map[string]interface{}) bson.D {
+	projected := bson.D{}
+	for _, e := range doc {
+		node, ok := tree[e.Key]
+		if !ok {
+			continue
+		}
+		sub, nested := node.(map[string]interface{})
+		if !nested {
+			projected = append(projected, e)
+			continue
+		}
+		if value, ok := projectNested(e.Value, sub, includeFields); ok {
+			projected = append(projected, bson.E{Key: e.Key, Value: value})
+		}
+	}
+	return projected
+}
+
+func excludeFields(doc bson.D, tree map[string]interface{}) bson.D {
+	projected := bson.D{}
+	for _, e := range doc {
+		node, ok := tree[e.Key]
+		if !ok {
+			projected = append(projected, e)
+			continue
+		}
+		sub, nested := node.(map[string]interface{})
+		if !nested {
+			continue
+		}
+		if value, ok := projectNested(e.Value, sub, excludeFields); ok {
+			projected = append(projected, bson.E{Key: e.Key, Value: value})
+		} else {
+			projected = append(projected, e)
+		}
+	}
+	return projected
+}
+
+func projectNested(v interface{}, tree map[string]interface{}, fields func(bson.D, map[string]interface{}) bson.D) (interface{}, bool) {
+	switch t := v.(type) {
+	case primitive.D:
+		return fields(t, tree), true
+	case primitive.A:
+		projected := primitive.A{}
+		for _, elem := range t {
+			if d, ok := elem.(primitive.D); ok {
+				projected = append(projected, fields(d, tree))
+			}
+		}
+		return projected, true
+	}
+	return nil, false
+}
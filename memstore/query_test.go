@@ -0,0 +1,151 @@
+package memstore
+
+import (
+	"github.com/jcobhams/asari/document"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func testDoc(t *testing.T) bson.D {
+	doc, err := normalize(bson.D{
+		bson.E{Key: "name", Value: "Joseph"},
+		bson.E{Key: "level", Value: 3},
+		bson.E{Key: "score", Value: 4.5},
+		bson.E{Key: "tags", Value: []string{"admin", "staff"}},
+		bson.E{Key: "address", Value: bson.D{bson.E{Key: "city", Value: "Lagos"}}},
+		bson.E{Key: "pets", Value: bson.A{bson.D{bson.E{Key: "name", Value: "Rex"}, bson.E{Key: "age", Value: 2}}, bson.D{bson.E{Key: "name", Value: "Tom"}, bson.E{Key: "age", Value: 7}}}},
+	})
+	assert.Nil(t, err)
+	return doc
+}
+
+func TestMatch(t *testing.T) {
+	doc := testDoc(t)
+
+	tests := []struct {
+		filter  bson.D
+		matches bool
+	}{
+		{bson.D{bson.E{Key: "name", Value: "Joseph"}}, true},
+		{bson.D{bson.E{Key: "level", Value: int64(3)}}, true},
+		{bson.D{bson.E{Key: "level", Value: 3.0}}, true},
+		{bson.D{bson.E{Key: "name", Value: "Jo"}}, false},
+		{bson.D{bson.E{Key: "address.city", Value: "Lagos"}}, true},
+		{bson.D{bson.E{Key: "tags", Value: "admin"}}, true},
+		{bson.D{bson.E{Key: "pets.name", Value: "Tom"}}, true},
+		{bson.D{bson.E{Key: "pets.1.name", Value: "Tom"}}, true},
+		{bson.D{bson.E{Key: "missing", Value: nil}}, true},
+		{bson.D{bson.E{Key: "level", Value: bson.D{bson.E{Key: "$gt", Value: 2}, bson.E{Key: "$lte", Value: 3}}}}, true},
+		{bson.D{bson.E{Key: "level", Value: bson.D{bson.E{Key: "$lt", Value: 3}}}}, false},
+		{bson.D{bson.E{Key: "level", Value: bson.D{bson.E{Key: "$gt", Value: "2"}}}}, false},
+		{bson.D{bson.E{Key: "level", Value: bson.D{bson.E{Key: "$ne", Value: 3}}}}, false},
+		{bson.D{bson.E{Key: "name", Value: bson.D{bson.E{Key: "$in", Value: []string{"Joseph", "Jane"}}}}}, true},
+		{bson.D{bson.E{Key: "name", Value: bson.D{bson.E{Key: "$nin", Value: []string{"Joseph"}}}}}, false},
+		{bson.D{bson.E{Key: "missing", Value: bson.D{bson.E{Key: "$exists", Value: false}}}}, true},
+		{bson.D{bson.E{Key: "name", Value: bson.D{bson.E{Key: "$regex", Value: "^jo"}, bson.E{Key: "$options", Value: "i"}}}}, true},
+		{bson.D{bson.E{Key: "name", Value: primitive.Regex{Pattern: "seph$"}}}, true},
+		{bson.D{bson.E{Key: "level", Value: bson.D{bson.E{Key: "$not", Value: bson.D{bson.E{Key: "$gt", Value: 5}}}}}}, true},
+		{bson.D{bson.E{Key: "tags", Value: bson.D{bson.E{Key: "$size", Value: 2}}}}, true},
+		{bson.D{bson.E{Key: "tags", Value: bson.D{bson.E{Key: "$all", Value: []string{"staff", "admin"}}}}}, true},
+		{bson.D{bson.E{Key: "pets", Value: bson.D{bson.E{Key: "$elemMatch", Value: bson.D{bson.E{Key: "name", Value: "Rex"}, bson.E{Key: "age", Value: bson.D{bson.E{Key: "$gt", Value: 5}}}}}}}}, false},
+		{bson.D{bson.E{Key: "$or", Value: bson.A{bson.D{bson.E{Key: "name", Value: "Jane"}}, bson.D{bson.E{Key: "level", Value: 3}}}}}, true},
+		{bson.D{bson.E{Key: "$and", Value: bson.A{bson.D{bson.E{Key: "name", Value: "Joseph"}}, bson.D{bson.E{Key: "level", Value: 4}}}}}, false},
+		{bson.D{bson.E{Key: "$nor", Value: bson.A{bson.D{bson.E{Key: "name", Value: "Jane"}}}}}, true},
+	}
+
+	for _, test := range tests {
+		filter, err := normalize(test.filter)
+		assert.Nil(t, err)
+		matched, err := match(doc, filter)
+		assert.Nil(t, err, "%v", test.filter)
+		assert.Equal(t, test.matches, matched, "%v", test.filter)
+	}
+
+	_, err := match(doc, bson.D{bson.E{Key: "$where", Value: "true"}})
+	assert.NotNil(t, err)
+}
+
+func TestSortDocuments(t *testing.T) {
+	docs := []bson.D{
+		{bson.E{Key: "name", Value: "b"}, bson.E{Key: "level", Value: int32(1)}},
+		{bson.E{Key: "name", Value: "a"}, bson.E{Key: "level", Value: int32(2)}},
+		{bson.E{Key: "name", Value: "c"}, bson.E{Key: "level", Value: int32(2)}},
+	}
+
+	sortDocuments(docs, bson.D{bson.E{Key: "level", Value: int32(-1)}, bson.E{Key: "name", Value: int32(1)}})
+	assert.Equal(t, "a", docs[0][0].Value)
+	assert.Equal(t, "c", docs[1][0].Value)
+	assert.Equal(t, "b", docs[2][0].Value)
+}
+
+func TestProject(t *testing.T) {
+	doc := append(bson.D{bson.E{Key: "_id", Value: "1"}}, testDoc(t)...)
+
+	projected, err := project(doc, bson.D{bson.E{Key: "name", Value: int32(1)}, bson.E{Key: "address.city", Value: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		bson.E{Key: "_id", Value: "1"},
+		bson.E{Key: "name", Value: "Joseph"},
+		bson.E{Key: "address", Value: bson.D{bson.E{Key: "city", Value: "Lagos"}}},
+	}, projected)
+
+	projected, err = project(doc, bson.D{bson.E{Key: "_id", Value: int32(0)}, bson.E{Key: "pets", Value: int32(0)}, bson.E{Key: "tags", Value: int32(0)}})
+	assert.Nil(t, err)
+	assert.Len(t, projected, 4)
+	assert.Equal(t, "name", projected[0].Key)
+
+	_, err = project(doc, bson.D{bson.E{Key: "name", Value: int32(1)}, bson.E{Key: "level", Value: int32(0)}})
+	assert.NotNil(t, err)
+}
+
+func TestVersionedFields(t *testing.T) {
+	inclusion := bson.D{bson.E{Key: "name", Value: int32(1)}}
+	assert.Equal(t, append(inclusion, bson.E{Key: document.SchemaVersionField, Value: int32(1)}), versionedFields(inclusion))
+	assert.Len(t, inclusion, 1)
+
+	exclusion := bson.D{bson.E{Key: "_id", Value: int32(1)}, bson.E{Key: "name", Value: int32(0)}}
+	assert.Equal(t, exclusion, versionedFields(exclusion))
+	assert.Nil(t, versionedFields(nil))
+}
+
+func TestApplyUpdate(t *testing.T) {
+	update, err := normalize(bson.D{
+		bson.E{Key: "$set", Value: bson.D{bson.E{Key: "address.zip", Value: "100001"}}},
+		bson.E{Key: "$inc", Value: bson.D{bson.E{Key: "level", Value: 2}, bson.E{Key: "visits", Value: 1}}},
+		bson.E{Key: "$mul", Value: bson.D{bson.E{Key: "score", Value: 2}}},
+		bson.E{Key: "$unset", Value: bson.D{bson.E{Key: "name", Value: ""}}},
+		bson.E{Key: "$push", Value: bson.D{bson.E{Key: "tags", Value: bson.D{bson.E{Key: "$each", Value: []string{"owner", "admin"}}}}}},
+		bson.E{Key: "$pull", Value: bson.D{bson.E{Key: "pets", Value: bson.D{bson.E{Key: "age", Value: bson.D{bson.E{Key: "$gt", Value: 5}}}}}}},
+	})
+	assert.Nil(t, err)
+
+	updated, err := applyUpdate(testDoc(t), update, false)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	value := func(path string) interface{} {
+		v, _ := get(updated, split(path))
+		return v
+	}
+	assert.Equal(t, "100001", value("address.zip"))
+	assert.Equal(t, "Lagos", value("address.city"))
+	assert.Equal(t, int32(5), value("level"))
+	assert.Equal(t, int32(1), value("visits"))
+	assert.Equal(t, 9.0, value("score"))
+	assert.Nil(t, value("name"))
+	assert.Equal(t, primitive.A{"admin", "staff", "owner", "admin"}, value("tags"))
+	assert.Len(t, value("pets"), 1)
+
+	addToSet, _ := normalize(bson.D{bson.E{Key: "$addToSet", Value: bson.D{bson.E{Key: "tags", Value: "staff"}}}})
+	updated, err = applyUpdate(testDoc(t), addToSet, false)
+	assert.Nil(t, err)
+	tags, _ := get(updated, []string{"tags"})
+	assert.Len(t, tags, 2)
+
+	replacement, _ := normalize(bson.D{bson.E{Key: "name", Value: "Jane"}})
+	_, err = applyUpdate(testDoc(t), replacement, false)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,284 @@
+package memstore
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setsField reports whether the $set operator of update sets key.
+func setsField(update bson.D, key string) bool {
+	for _, op := range update {
+		if op.Key != "$set" {
+			continue
+		}
+		fields, err := normalize(op.Value)
+		if err != nil {
+			return false
+		}
+		for _, f := range fields {
+			if f.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyUpdate applies the update operators of update to doc and returns the updated document.
+// insert is true when the update creates a document for an upsert, which applies $setOnInsert.
+func applyUpdate(doc bson.D, update bson.D, insert bool) (bson.D, error) {
+	if len(update) == 0 {
+		return nil, errors.New("asari: update document is empty")
+	}
+
+	var root interface{} = doc
+	for _, op := range update {
+		if !strings.HasPrefix(op.Key, "$") {
+			return nil, errors.New("asari: update document must only contain update operators")
+		}
+		fields, ok := op.Value.(primitive.D)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("asari: %s requires a document", op.Key))
+		}
+
+		for _, f := range fields {
+			if f.Key == "_id" && op.Key != "$setOnInsert" {
+				return nil, errors.New("asari: _id cannot be updated")
+			}
+
+			var err error
+			root, err = applyOperator(root, op.Key, f, insert)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root.(primitive.D), nil
+}
+
+func applyOperator(root interface{}, operator string, f bson.E, insert bool) (interface{}, error) {
+	path := split(f.Key)
+	current, exists := get(root, path)
+
+	switch operator {
+	case "$set":
+		return set(root, path, f.Value)
+	case "$setOnInsert":
+		if !insert {
+			return root, nil
+		}
+		return set(root, path, f.Value)
+	case "$unset":
+		return unset(root, path), nil
+	case "$inc", "$mul":
+		by, ok := number(f.Value)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("asari: %s requires a number for %s", operator, f.Key))
+		}
+		if !exists {
+			current = int32(0)
+		}
+		value, ok := number(current)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("asari: %s cannot be applied to the non numeric %s", operator, f.Key))
+		}
+		if operator == "$inc" {
+			value += by
+		} else {
+			value *= by
+		}
+		return set(root, path, numberLike(value, current, f.Value))
+	case "$min", "$max":
+		if exists {
+			c := compare(f.Value, current)
+			if (operator == "$min" && c >= 0) || (operator == "$max" && c <= 0) {
+				return root, nil
+			}
+		}
+		return set(root, path, f.Value)
+	case "$currentDate":
+		return set(root, path, primitive.NewDateTimeFromTime(time.Now()))
+	case "$rename":
+		to, ok := f.Value.(string)
+		if !ok {
+			return nil, errors.New("asari: $rename requires a field name")
+		}
+		if !exists {
+			return root, nil
+		}
+		return set(unset(root, path), split(to), current)
+	case "$push", "$addToSet":
+		array, err := arrayAt(current, exists, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		values := primitive.A{f.Value}
+		if each, ok := operatorExpression(f.Value); ok && each[0].Key == "$each" {
+			if values, ok = each[0].Value.(primitive.A); !ok {
+				return nil, errors.New("asari: $each requires an array")
+			}
+		}
+		for _, v := range values {
+			if operator == "$addToSet" && matchEqual([]interface{}{array}, v) {
+				continue
+			}
+			array = append(array, v)
+		}
+		return set(root, path, array)
+	case "$pull":
+		array, err := arrayAt(current, exists, f.Key)
+		if err != nil || !exists {
+			return root, err
+		}
+		kept := primitive.A{}
+		for _, elem := range array {
+			matched, err := matchElem(elem, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				kept = append(kept, elem)
+			}
+		}
+		return set(root, path, kept)
+	case "$pop":
+		array, err := arrayAt(current, exists, f.Key)
+		if err != nil || len(array) == 0 {
+			return root, err
+		}
+		if n, _ := number(f.Value); n < 0 {
+			return set(root, path, array[1:])
+		}
+		return set(root, path, array[:len(array)-1])
+	}
+	return nil, errors.New(fmt.Sprintf("asari: memstore does not support the %s update operator", operator))
+}
+
+func arrayAt(current interface{}, exists bool, field string) (primitive.A, error) {
+	if !exists {
+		return primitive.A{}, nil
+	}
+	array, ok := current.(primitive.A)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("asari: %s is not an array", field))
+	}
+	return append(primitive.A{}, array...), nil
+}
+
+// numberLike returns value as the widest numeric type of the current value and the operand.
+func numberLike(value float64, current, operand interface{}) interface{} {
+	_, currentFloat := current.(float64)
+	_, operandFloat := operand.(float64)
+	_, currentLong := current.(int64)
+	_, operandLong := operand.(int64)
+
+	switch {
+	case currentFloat || operandFloat:
+		return value
+	case currentLong || operandLong || value > 2147483647 || value < -2147483648:
+		return int64(value)
+	}
+	return int32(value)
+}
+
+// get returns the value at path without traversing arrays of documents.
+func get(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+	switch t := v.(type) {
+	case primitive.D:
+		for _, e := range t {
+			if e.Key == path[0] {
+				return get(e.Value, path[1:])
+			}
+		}
+	case primitive.A:
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(t) {
+			return get(t[i], path[1:])
+		}
+	}
+	return nil, false
+}
+
+// set returns v with the value at path replaced, creating missing embedded documents.
+func set(v interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch t := v.(type) {
+	case primitive.D:
+		updated := append(primitive.D{}, t...)
+		for i, e := range updated {
+			if e.Key == path[0] {
+				child, err := set(e.Value, path[1:], value)
+				if err != nil {
+					return nil, err
+				}
+				updated[i].Value = child
+				return updated, nil
+			}
+		}
+		child, err := set(primitive.D{}, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return append(updated, bson.E{Key: path[0], Value: child}), nil
+	case primitive.A:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 {
+			return nil, errors.New(fmt.Sprintf("asari: cannot set %s on an array", path[0]))
+		}
+		updated := append(primitive.A{}, t...)
+		for len(updated) <= i {
+			updated = append(updated, nil)
+		}
+		child, err := set(updated[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		updated[i] = child
+		return updated, nil
+	case nil:
+		return set(primitive.D{}, path, value)
+	}
+	return nil, errors.New(fmt.Sprintf("asari: cannot set %s on a %T", path[0], v))
+}
+
+// unset returns v without the value at path.
+func unset(v interface{}, path []string) interface{} {
+	switch t := v.(type) {
+	case primitive.D:
+		updated := primitive.D{}
+		for _, e := range t {
+			if e.Key != path[0] {
+				updated = append(updated, e)
+				continue
+			}
+			if len(path) > 1 {
+				updated = append(updated, bson.E{Key: e.Key, Value: unset(e.Value, path[1:])})
+			}
+		}
+		return updated
+	case primitive.A:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(t) {
+			return t
+		}
+		updated := append(primitive.A{}, t...)
+		if len(path) > 1 {
+			updated[i] = unset(t[i], path[1:])
+		} else {
+			//Like MongoDB, unsetting an array element leaves null in its place
+			updated[i] = nil
+		}
+		return updated
+	}
+	return v
+}
@@ -0,0 +1,349 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"github.com/jcobhams/asari/queryfilter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"time"
+)
+
+var (
+	DefaultCollection      = "migrations"
+	DefaultLockTimeout     = 10 * time.Minute
+	ErrLocked              = errors.New("asari: migrations are locked by another runner")
+	ErrLockLost            = errors.New("asari: the migration lock expired and was taken over by another runner")
+	ErrIrreversible        = errors.New("asari: migration has no down step")
+	ErrDuplicateMigration  = errors.New("asari: migration registered more than once")
+	ErrMigrationIDRequired = errors.New("asari: migration ID required")
+	ErrMigrationUpRequired = errors.New("asari: migration up step required")
+	lockID                 = "lock"
+)
+
+type (
+	// Step is a single direction of a migration. It receives the client the migrator was created with.
+	Step func(ctx context.Context, client *database.Client) error
+
+	Migration struct {
+		// ID uniquely identifies the migration and is what gets recorded once it is applied - eg: "20200101_add_email_index"
+		ID          string
+		Description string
+		Up          Step
+		// Down is optional. Migrations without it cannot be rolled back.
+		Down Step
+	}
+
+	// Status reports whether a registered migration has been applied.
+	Status struct {
+		ID          string
+		Description string
+		Applied     bool
+		AppliedAt   time.Time
+	}
+
+	RunOptions struct {
+		// DryRun reports the migrations that would run without running or recording them.
+		DryRun bool
+	}
+
+	// Migrator applies registered migrations in registration order and records them in a collection.
+	// Records are read and written with database.WithoutTenant so clients with tenancy enabled can be migrated. Steps
+	// run with the context given to Up and Down.
+	// Up and Down hold a lock renewed every third of LockTimeout while they run. A runner whose lock was taken over
+	// anyway - eg: its renewals failed - stops with ErrLockLost before its next migration runs or is recorded.
+	Migrator struct {
+		client      *database.Client
+		collection  string
+		migrations  []Migration
+		owner       string
+		LockTimeout time.Duration
+	}
+
+	record struct {
+		document.Base `bson:",inline"`
+		MigrationID   string    `bson:"migration_id"`
+		Description   string    `bson:"description"`
+		AppliedAt     time.Time `bson:"applied_at"`
+	}
+
+	lock struct {
+		ID        string    `bson:"_id"`
+		Owner     string    `bson:"owner"`
+		LockedAt  time.Time `bson:"locked_at"`
+		ExpiresAt time.Time `bson:"expires_at"`
+	}
+)
+
+// New returns a Migrator that records applied migrations in collection. If collection is empty, DefaultCollection is
+// used. The lock is kept in a companion "<collection>_lock" collection.
+func New(client *database.Client, collection string) *Migrator {
+	if collection == "" {
+		collection = DefaultCollection
+	}
+	host, _ := os.Hostname()
+	return &Migrator{
+		client:      client,
+		collection:  collection,
+		owner:       fmt.Sprintf("%s:%d:%s", host, os.Getpid(), primitive.NewObjectID().Hex()),
+		LockTimeout: DefaultLockTimeout,
+	}
+}
+
+// Register adds migrations to the end of the run order.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, migration := range migrations {
+		if migration.ID == "" {
+			return ErrMigrationIDRequired
+		}
+		if migration.Up == nil {
+			return ErrMigrationUpRequired
+		}
+		for _, existing := range m.migrations {
+			if existing.ID == migration.ID {
+				return fmt.Errorf("%w: %s", ErrDuplicateMigration, migration.ID)
+			}
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	return nil
+}
+
+// Status returns every registered migration in run order with its applied state.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{ID: migration.ID, Description: migration.Description}
+		if r, ok := applied[migration.ID]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = r.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations in order and returns the IDs of the migrations that ran.
+// It stops at the first failing migration; migrations applied before it stay recorded.
+func (m *Migrator) Up(ctx context.Context, runOptions *RunOptions) ([]string, error) {
+	if runOptions == nil {
+		runOptions = &RunOptions{}
+	}
+
+	if !runOptions.DryRun {
+		if err := m.lock(ctx); err != nil {
+			return nil, err
+		}
+		defer m.unlock(context.Background())
+		defer m.keepLock(ctx)()
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []string
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.ID]; ok {
+			continue
+		}
+		if runOptions.DryRun {
+			ran = append(ran, migration.ID)
+			continue
+		}
+
+		if err := m.renew(ctx); err != nil {
+			return ran, err
+		}
+		if err := migration.Up(ctx, m.client); err != nil {
+			return ran, fmt.Errorf("asari: migration %s failed: %w", migration.ID, err)
+		}
+		if err := m.renew(ctx); err != nil {
+			return ran, err
+		}
+
+		r := &record{MigrationID: migration.ID, Description: migration.Description, AppliedAt: time.Now().UTC()}
+		r.Setup()
+		if _, err := m.client.SaveDocument(database.WithoutTenant(ctx), m.collection, r); err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration.ID)
+	}
+	return ran, nil
+}
+
+// Down rolls back the last steps applied migrations in reverse order and returns the IDs of the migrations rolled back.
+// Rolling back a migration without a Down step returns ErrIrreversible.
+func (m *Migrator) Down(ctx context.Context, steps int, runOptions *RunOptions) ([]string, error) {
+	if runOptions == nil {
+		runOptions = &RunOptions{}
+	}
+
+	if !runOptions.DryRun {
+		if err := m.lock(ctx); err != nil {
+			return nil, err
+		}
+		defer m.unlock(context.Background())
+		defer m.keepLock(ctx)()
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rolledBack []string
+	for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		migration := m.migrations[i]
+		r, ok := applied[migration.ID]
+		if !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return rolledBack, fmt.Errorf("%w: %s", ErrIrreversible, migration.ID)
+		}
+		if runOptions.DryRun {
+			rolledBack = append(rolledBack, migration.ID)
+			continue
+		}
+
+		if err := m.renew(ctx); err != nil {
+			return rolledBack, err
+		}
+		if err := migration.Down(ctx, m.client); err != nil {
+			return rolledBack, fmt.Errorf("asari: rolling back migration %s failed: %w", migration.ID, err)
+		}
+		if err := m.renew(ctx); err != nil {
+			return rolledBack, err
+		}
+		if _, err := m.client.HardDeleteDocument(database.WithoutTenant(ctx), m.collection, r); err != nil {
+			return rolledBack, err
+		}
+		rolledBack = append(rolledBack, migration.ID)
+	}
+	return rolledBack, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[string]*record, error) {
+	cur, err := m.client.FindAll(database.WithoutTenant(ctx), m.collection, queryfilter.New().GetFilters(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	applied := map[string]*record{}
+	for cur.Next(ctx) {
+		r := &record{}
+		if err := cur.Decode(r); err != nil {
+			return nil, err
+		}
+		applied[r.MigrationID] = r
+	}
+	return applied, cur.Err()
+}
+
+// lockCollection returns the lock collection, in the database records are saved in.
+func (m *Migrator) lockCollection(ctx context.Context) (*mongo.Collection, error) {
+	db, err := m.client.Database(database.WithoutTenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return db.Collection(m.collection + "_lock"), nil
+}
+
+func (m *Migrator) lock(ctx context.Context) error {
+	collection, err := m.lockCollection(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	l := lock{ID: lockID, Owner: m.owner, LockedAt: now, ExpiresAt: now.Add(m.LockTimeout)}
+
+	_, err = collection.InsertOne(ctx, l)
+	if err == nil {
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	//Take over locks left behind by runners that did not release them in time
+	filter := bson.D{
+		bson.E{Key: "_id", Value: lockID},
+		bson.E{Key: "expires_at", Value: bson.D{bson.E{Key: operator.Lt, Value: now}}},
+	}
+	result := collection.FindOneAndReplace(ctx, filter, l)
+	if result.Err() == mongo.ErrNoDocuments {
+		return ErrLocked
+	}
+	return result.Err()
+}
+
+// renew extends the lock held by the Migrator or returns ErrLockLost if another runner holds it.
+func (m *Migrator) renew(ctx context.Context) error {
+	collection, err := m.lockCollection(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{bson.E{Key: "_id", Value: lockID}, bson.E{Key: "owner", Value: m.owner}}
+	update := bson.D{bson.E{Key: operator.Set, Value: bson.D{bson.E{Key: "expires_at", Value: time.Now().UTC().Add(m.LockTimeout)}}}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// keepLock renews the lock every third of LockTimeout until the returned function is called.
+func (m *Migrator) keepLock(ctx context.Context) func() {
+	interval := m.LockTimeout / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.renew(ctx)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (m *Migrator) unlock(ctx context.Context) error {
+	collection, err := m.lockCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: lockID}, bson.E{Key: "owner", Value: m.owner}})
+	return err
+}
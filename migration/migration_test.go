@@ -0,0 +1,145 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/database"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"testing"
+	"time"
+)
+
+var TestClient *database.Client
+
+const TestCollection string = "test_migrations"
+
+func TestMain(m *testing.M) {
+	mongoDSN, ok := os.LookupEnv("MONGO_DSN")
+	if !ok {
+		panic("MONGO_DSN Environment Variable Required")
+	}
+
+	databaseName, ok := os.LookupEnv("DATABASE_NAME")
+	if !ok {
+		panic("DATABASE_NAME Environment Variable Required")
+	}
+
+	TestClient = database.Init(mongoDSN, databaseName)
+
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestMigrator_Register(t *testing.T) {
+	m := New(TestClient, TestCollection)
+	noop := func(ctx context.Context, client *database.Client) error { return nil }
+
+	assert.Nil(t, m.Register(Migration{ID: "one", Up: noop}, Migration{ID: "two", Up: noop}))
+	assert.Equal(t, ErrMigrationIDRequired, m.Register(Migration{Up: noop}))
+	assert.Equal(t, ErrMigrationUpRequired, m.Register(Migration{ID: "three"}))
+	assert.True(t, errors.Is(m.Register(Migration{ID: "one", Up: noop}), ErrDuplicateMigration))
+	assert.Equal(t, 2, len(m.migrations))
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	var calls []string
+	step := func(name string) Step {
+		return func(ctx context.Context, client *database.Client) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	m := New(TestClient, TestCollection)
+	m.Register(
+		Migration{ID: "one", Up: step("up one"), Down: step("down one")},
+		Migration{ID: "two", Up: step("up two"), Down: step("down two")},
+	)
+
+	//Test Dry Run
+	ran, err := m.Up(nil, &RunOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two"}, ran)
+	assert.Empty(t, calls)
+
+	ran, err = m.Up(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two"}, ran)
+	assert.Equal(t, []string{"up one", "up two"}, calls)
+
+	statuses, err := m.Status(nil)
+	assert.Nil(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.True(t, statuses[1].Applied)
+	assert.False(t, statuses[1].AppliedAt.IsZero())
+
+	//Test Applied Migrations Are Skipped
+	ran, err = m.Up(nil, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, ran)
+
+	rolledBack, err := m.Down(nil, 1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"two"}, rolledBack)
+	assert.Equal(t, "down two", calls[len(calls)-1])
+
+	statuses, _ = m.Status(nil)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+
+	//Test Irreversible Migrations
+	m.Register(Migration{ID: "three", Up: step("up three")})
+	m.Up(nil, nil)
+	_, err = m.Down(nil, 1, nil)
+	assert.True(t, errors.Is(err, ErrIrreversible))
+
+	tearDown()
+}
+
+func TestMigrator_Tenancy(t *testing.T) {
+	client := &database.Client{Connection: TestClient.Connection}
+	client.EnableTenancy(nil)
+	m := New(client, TestCollection)
+	m.Register(Migration{ID: "1", Up: func(ctx context.Context, client *database.Client) error { return nil }, Down: func(ctx context.Context, client *database.Client) error { return nil }})
+
+	ran, err := m.Up(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, ran)
+
+	rolledBack, err := m.Down(nil, 1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, rolledBack)
+
+	tearDown()
+}
+
+func TestMigrator_Lock(t *testing.T) {
+	first := New(TestClient, TestCollection)
+	second := New(TestClient, TestCollection)
+
+	assert.Nil(t, first.lock(nil))
+	assert.Equal(t, ErrLocked, second.lock(nil))
+
+	_, err := second.Up(nil, nil)
+	assert.Equal(t, ErrLocked, err)
+
+	//Test Expired Locks Are Taken Over
+	assert.Nil(t, first.renew(nil))
+	collection, _ := first.lockCollection(nil)
+	collection.UpdateOne(nil, bson.M{"_id": lockID}, bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}})
+	assert.Nil(t, second.lock(nil))
+	assert.Equal(t, ErrLockLost, first.renew(nil))
+
+	assert.Nil(t, second.unlock(nil))
+	assert.Nil(t, first.lock(nil))
+	assert.Nil(t, first.unlock(nil))
+
+	tearDown()
+}
+
+func tearDown() {
+	TestClient.Connection.Collection(TestCollection).DeleteMany(nil, bson.M{})
+	TestClient.Connection.Collection(TestCollection + "_lock").DeleteMany(nil, bson.M{})
+}
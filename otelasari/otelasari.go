@@ -0,0 +1,141 @@
+// Package otelasari instruments asari with OpenTelemetry.
+//
+// It lives in its own module so asari itself does not depend on OpenTelemetry. Its go.mod requires a published asari
+// version, the go.work file next to it builds the adapter against the local asari tree during development.
+//
+//	client.SetTracer(otelasari.NewTracer(nil))
+//	metrics, err := otelasari.NewMetrics(nil)
+//	if err != nil { ... }
+//	client.SetMetrics(metrics)
+package otelasari
+
+import (
+	"context"
+	"github.com/jcobhams/asari/database"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer and meter created by NewTracer and NewMetrics.
+const InstrumentationName = "github.com/jcobhams/asari/otelasari"
+
+type (
+	tracer struct {
+		tracer trace.Tracer
+	}
+
+	span struct {
+		span trace.Span
+	}
+
+	metrics struct {
+		duration  metric.Float64Histogram
+		hooks     metric.Float64Histogram
+		documents metric.Int64Histogram
+		retries   metric.Int64Counter
+	}
+)
+
+// NewTracer returns a database.Tracer starting a client span for every asari call. The span is named after the
+// method and collection - eg: "FindOne users". If provider is nil, the global TracerProvider is used.
+func NewTracer(provider trace.TracerProvider) database.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &tracer{tracer: provider.Tracer(InstrumentationName)}
+}
+
+func (t *tracer) Start(ctx context.Context, op database.Operation) (context.Context, database.Span) {
+	ctx, s := t.tracer.Start(ctx, op.Name+" "+op.Collection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes(op)...),
+	)
+	return ctx, &span{span: s}
+}
+
+func (s *span) End(result database.OperationResult) {
+	if result.Documents >= 0 {
+		s.span.SetAttributes(attribute.Int64("asari.documents", result.Documents))
+	}
+	s.span.SetAttributes(attribute.Float64("asari.hook_duration", result.HookDuration.Seconds()))
+	if result.Retries > 0 {
+		s.span.SetAttributes(attribute.Int("asari.retries", result.Retries))
+	}
+
+	if result.Err != nil {
+		s.span.SetAttributes(attribute.String("error.type", result.ErrorClass))
+		s.span.RecordError(result.Err)
+		s.span.SetStatus(codes.Error, result.Err.Error())
+	}
+	s.span.End()
+}
+
+// NewMetrics returns a database.Metrics recording every asari call on these instruments:
+//
+//	asari.operation.duration       call duration in seconds
+//	asari.operation.hook_duration  time spent in document hooks in seconds
+//	asari.operation.documents      documents found, written or counted - calls returning a cursor are not recorded
+//	asari.operation.retries        retries of calls failing with transient errors
+//
+// Measurements carry the operation attributes of the spans and error.type when the call failed.
+// If provider is nil, the global MeterProvider is used.
+func NewMetrics(provider metric.MeterProvider) (database.Metrics, error) {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(InstrumentationName)
+
+	duration, err := meter.Float64Histogram("asari.operation.duration",
+		metric.WithDescription("Duration of asari calls"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := meter.Float64Histogram("asari.operation.hook_duration",
+		metric.WithDescription("Time asari calls spent in document hooks"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	documents, err := meter.Int64Histogram("asari.operation.documents",
+		metric.WithDescription("Documents found, written or counted by asari calls"), metric.WithUnit("{document}"))
+	if err != nil {
+		return nil, err
+	}
+	retries, err := meter.Int64Counter("asari.operation.retries",
+		metric.WithDescription("Retries of asari calls failing with transient errors"), metric.WithUnit("{retry}"))
+	if err != nil {
+		return nil, err
+	}
+	return &metrics{duration: duration, hooks: hooks, documents: documents, retries: retries}, nil
+}
+
+func (m *metrics) Record(ctx context.Context, op database.Operation, result database.OperationResult) {
+	attrs := attributes(op)
+	if result.Err != nil {
+		attrs = append(attrs, attribute.String("error.type", result.ErrorClass))
+	}
+	opt := metric.WithAttributes(attrs...)
+
+	m.duration.Record(ctx, result.Duration.Seconds(), opt)
+	m.hooks.Record(ctx, result.HookDuration.Seconds(), opt)
+	if result.Documents >= 0 {
+		m.documents.Record(ctx, result.Documents, opt)
+	}
+	if result.Retries > 0 {
+		m.retries.Add(ctx, int64(result.Retries), opt)
+	}
+}
+
+func attributes(op database.Operation) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.operation", op.Name),
+		attribute.String("db.mongodb.collection", op.Collection),
+	}
+	if op.Database != "" {
+		attrs = append(attrs, attribute.String("db.name", op.Database))
+	}
+	return attrs
+}
@@ -0,0 +1,125 @@
+package otelasari
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/database"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+var op = database.Operation{Name: "FindOne", Collection: "users", Database: "main"}
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider)
+
+	ctx, s := tracer.Start(context.Background(), op)
+	assert.True(t, trace.SpanFromContext(ctx).SpanContext().IsValid())
+	s.End(database.OperationResult{Duration: time.Millisecond, Documents: 1, Retries: 2})
+
+	_, s = tracer.Start(context.Background(), op)
+	s.End(database.OperationResult{Documents: -1, Err: database.ErrNotFound, ErrorClass: "not_found"})
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	assert.Equal(t, "FindOne users", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.mongodb.collection", "users"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.name", "main"))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("asari.retries", 2))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int64("asari.documents", 1))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Contains(t, spans[1].Attributes(), attribute.String("error.type", "not_found"))
+	assert.Len(t, spans[1].Events(), 1)
+	for _, attr := range spans[1].Attributes() {
+		assert.NotEqual(t, attribute.Key("asari.documents"), attr.Key)
+	}
+}
+
+func TestClient(t *testing.T) {
+	mClient, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	client := &database.Client{Connection: mClient.Database("main")}
+	client.SetTracer(NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	err = client.FindOne(context.Background(), "users", nil, bson.D{}, &struct{}{})
+	assert.Equal(t, database.ErrInvalidProjection, err)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "FindOne users", spans[0].Name())
+		assert.Contains(t, spans[0].Attributes(), attribute.String("error.type", "invalid_argument"))
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metrics, err := NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	metrics.Record(context.Background(), op, database.OperationResult{Duration: time.Millisecond, Documents: 1, Retries: 1})
+	metrics.Record(context.Background(), op, database.OperationResult{
+		Duration:     time.Millisecond,
+		HookDuration: time.Microsecond,
+		Documents:    -1,
+		Err:          errors.New("boom"),
+		ErrorClass:   "other",
+	})
+
+	var collected metricdata.ResourceMetrics
+	if !assert.Nil(t, reader.Collect(context.Background(), &collected)) {
+		return
+	}
+
+	instruments := map[string]metricdata.Aggregation{}
+	for _, scope := range collected.ScopeMetrics {
+		assert.Equal(t, InstrumentationName, scope.Scope.Name)
+		for _, m := range scope.Metrics {
+			instruments[m.Name] = m.Data
+		}
+	}
+
+	duration := instruments["asari.operation.duration"].(metricdata.Histogram[float64])
+	assert.Len(t, duration.DataPoints, 2)
+	for _, point := range duration.DataPoints {
+		assert.Equal(t, uint64(1), point.Count)
+		if errorType, ok := point.Attributes.Value("error.type"); ok {
+			assert.Equal(t, "other", errorType.AsString())
+		}
+	}
+
+	documents := instruments["asari.operation.documents"].(metricdata.Histogram[int64])
+	if assert.Len(t, documents.DataPoints, 1) {
+		assert.Equal(t, int64(1), documents.DataPoints[0].Sum)
+	}
+	assert.Contains(t, instruments, "asari.operation.hook_duration")
+
+	retries := instruments["asari.operation.retries"].(metricdata.Sum[int64])
+	if assert.Len(t, retries.DataPoints, 1) {
+		assert.Equal(t, int64(1), retries.DataPoints[0].Value)
+	}
+}
@@ -0,0 +1,171 @@
+// Package replay records the operations made through a database.Store to an Extended JSON file and replays them in
+// tests without a database.
+//
+// A Recorder wraps a store and writes one Call per line. A Replayer reads the calls back and serves their recorded
+// results in order, returning a *DivergenceError when the calls made differ from the recorded ones.
+package replay
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultIgnoredFields are the document fields that are not compared when replaying SaveDocument, SoftDeleteDocument,
+// HardDeleteDocument and RestoreDocument. They are set by document.Base.Setup and differ on every run.
+var DefaultIgnoredFields = []string{"_id", "created_at", "updated_at", "deleted_at"}
+
+type (
+	// Call is a recorded operation. Args holds the arguments the operation was called with and Result what it returned.
+	Call struct {
+		Method     string         `bson:"method"`
+		Collection string         `bson:"collection,omitempty"`
+		Args       bson.D         `bson:"args,omitempty"`
+		Result     bson.D         `bson:"result,omitempty"`
+		Error      *RecordedError `bson:"error,omitempty"`
+	}
+
+	// RecordedError is an error returned by a recorded operation. Kind names the asari error it matched so replayed
+	// errors still match it with errors.Is.
+	RecordedError struct {
+		Kind       string                     `bson:"kind,omitempty"`
+		Message    string                     `bson:"message"`
+		Hook       string                     `bson:"hook,omitempty"`
+		Validation *validator.ValidationError `bson:"validation,omitempty"`
+	}
+
+	replayedError struct {
+		message string
+		kind    error
+	}
+)
+
+// kinds lists every exported database sentinel so replayed errors match the same errors.Is checks as recorded ones.
+var kinds = []struct {
+	name string
+	err  error
+}{
+	{"not_found", database.ErrNotFound},
+	{"duplicate_key", database.ErrDuplicateKey},
+	{"not_setup", database.ErrNotSetup},
+	{"not_pointer", database.ErrNotPointer},
+	{"invalid_projection", database.ErrInvalidProjection},
+	{"empty_filter_key", database.ErrEmptyFilterKey},
+	{"empty_update", database.ErrEmptyUpdate},
+	{"no_handler", database.ErrNoHandler},
+	{"not_restorable", database.ErrNotRestorable},
+	{"not_document", database.ErrNotDocument},
+	{"not_new", database.ErrNotNew},
+	{"no_delete_policy", database.ErrNoDeletePolicy},
+	{"restricted", database.ErrRestricted},
+	{"no_tenant", database.ErrNoTenant},
+	{"cross_tenant", database.ErrCrossTenant},
+	{"not_tenant_scoped", database.ErrNotTenantScoped},
+	{"unscoped_filters", database.ErrUnscopedFilters},
+	{"unscoped_stage", database.ErrUnscopedStage},
+	{"populate_target", database.ErrPopulateTarget},
+	{"not_slice", database.ErrNotSlice},
+	{"unknown_relation", database.ErrUnknownRelation},
+	{"invalid_relation", database.ErrInvalidRelation},
+	{"collection_scan", database.ErrCollectionScan},
+	{"not_explainable", database.ErrNotExplainable},
+}
+
+func (e *replayedError) Error() string {
+	return e.message
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.kind
+}
+
+func recordError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+
+	recorded := &RecordedError{Message: err.Error()}
+	var hookError *database.HookError
+	var validationError *validator.ValidationError
+	switch {
+	case errors.As(err, &validationError):
+		recorded.Kind = "validation"
+		recorded.Validation = validationError
+	case errors.As(err, &hookError):
+		recorded.Kind = "hook"
+		recorded.Hook = hookError.Hook
+		if hookError.Err != nil {
+			recorded.Message = hookError.Err.Error()
+		}
+	default:
+		for _, k := range kinds {
+			if errors.Is(err, k.err) {
+				recorded.Kind = k.name
+				break
+			}
+		}
+	}
+	return recorded
+}
+
+// Err returns the error the recorded operation returned. Validation and hook errors are rebuilt as their asari types
+// and other asari errors match their sentinel with errors.Is.
+func (e *RecordedError) Err() error {
+	if e == nil {
+		return nil
+	}
+
+	switch e.Kind {
+	case "validation":
+		if e.Validation != nil {
+			return e.Validation
+		}
+	case "hook":
+		return &database.HookError{Hook: e.Hook, Err: errors.New(e.Message)}
+	}
+	for _, k := range kinds {
+		if k.name == e.Kind {
+			return &replayedError{message: e.Message, kind: k.err}
+		}
+	}
+	return errors.New(e.Message)
+}
+
+// marshal returns v as a raw document or nil if v is nil.
+func marshal(v interface{}) (bson.Raw, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return bson.Marshal(v)
+}
+
+// drain reads the documents left in cur and closes it.
+func drain(ctx context.Context, cur *mongo.Cursor) ([]bson.Raw, error) {
+	defer cur.Close(ctx)
+
+	var docs []bson.Raw
+	for cur.Next(ctx) {
+		docs = append(docs, append(bson.Raw{}, cur.Current...))
+	}
+	return docs, cur.Err()
+}
+
+func newCursor(docs []bson.Raw) (*mongo.Cursor, error) {
+	results := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		results[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(results, nil, nil)
+}
+
+func lookup(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
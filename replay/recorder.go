@@ -0,0 +1,330 @@
+package replay
+
+import (
+	"context"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"sync"
+)
+
+// Recorder is a database.Store that passes every operation to another store and writes it as a Call to an Extended
+// JSON stream, one call per line.
+// Cursors returned by the store are read to record their documents and replaced by cursors over the same documents.
+type Recorder struct {
+	store database.Store
+	mu    sync.Mutex
+	w     io.Writer
+	err   error
+}
+
+var _ database.Store = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder passing operations to store and writing them to w.
+func NewRecorder(store database.Store, w io.Writer) *Recorder {
+	return &Recorder{store: store, w: w}
+}
+
+// Err returns the first error met while recording a call.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(call Call, err error) {
+	call.Error = recordError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	line, marshalErr := bson.MarshalExtJSON(call, true, false)
+	if marshalErr != nil {
+		r.err = marshalErr
+		return
+	}
+	if _, writeErr := r.w.Write(append(line, '\n')); writeErr != nil {
+		r.err = writeErr
+	}
+}
+
+// recordDocument records a call whose result is the decoded target or saved document.
+func (r *Recorder) recordDocument(call Call, doc interface{}, err error) {
+	if err == nil {
+		raw, marshalErr := marshal(doc)
+		if marshalErr != nil {
+			r.record(call, marshalErr)
+			return
+		}
+		call.Result = bson.D{bson.E{Key: "document", Value: raw}}
+	}
+	r.record(call, err)
+}
+
+// recordCursor records the documents of cur and returns a cursor over them.
+func (r *Recorder) recordCursor(ctx context.Context, call Call, cur *mongo.Cursor, err error) (*mongo.Cursor, error) {
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+
+	docs, err := drain(ctx, cur)
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+	call.Result = bson.D{bson.E{Key: "documents", Value: docs}}
+	r.record(call, nil)
+	return newCursor(docs)
+}
+
+func (r *Recorder) FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+	call := findOneCall(collection, filters, projection, findOneOptions)
+	err := r.store.FindOne(ctx, collection, filters, projection, target, findOneOptions...)
+	r.recordDocument(call, target, err)
+	return err
+}
+
+func (r *Recorder) FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) error {
+	call := findOneByIDCall(collection, id, projection)
+	err := r.store.FindOneByID(ctx, collection, id, projection, target)
+	r.recordDocument(call, target, err)
+	return err
+}
+
+func (r *Recorder) FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) error {
+	call := findOneByFieldCall(collection, field, value, projection)
+	err := r.store.FindOneByField(ctx, collection, field, value, projection, target)
+	r.recordDocument(call, target, err)
+	return err
+}
+
+func (r *Recorder) FindPaginated(ctx context.Context, collection string, pageOptions database.PageOpts, filters []bson.E, projection interface{}, sort bson.D) (*database.PaginatedResult, error) {
+	call := findPaginatedCall(collection, pageOptions, filters, projection, sort)
+	result, err := r.store.FindPaginated(ctx, collection, pageOptions, filters, projection, sort)
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+
+	docs, err := drain(ctx, result.Cursor)
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+	call.Result = bson.D{
+		bson.E{Key: "paginator", Value: result.Paginator},
+		bson.E{Key: "documents", Value: docs},
+	}
+	r.record(call, nil)
+
+	result.Cursor, err = newCursor(docs)
+	return result, err
+}
+
+func (r *Recorder) FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) error {
+	call := findLastCall(collection, filters, projection)
+	err := r.store.FindLast(ctx, collection, filters, projection, target)
+	r.recordDocument(call, target, err)
+	return err
+}
+
+func (r *Recorder) FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (*mongo.Cursor, error) {
+	cur, err := r.store.FindLastN(ctx, collection, limit, filters, projection)
+	return r.recordCursor(ctx, findLastNCall(collection, limit, filters, projection), cur, err)
+}
+
+func (r *Recorder) FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (*mongo.Cursor, error) {
+	cur, err := r.store.FindAll(ctx, collection, filters, projection, sort)
+	return r.recordCursor(ctx, findAllCall(collection, filters, projection, sort), cur, err)
+}
+
+// DecodeAll is not recorded, it reads a cursor without making a call.
+func (r *Recorder) DecodeAll(ctx context.Context, cur *mongo.Cursor, results interface{}) error {
+	return r.store.DecodeAll(ctx, cur, results)
+}
+
+func (r *Recorder) SaveDocument(ctx context.Context, collection string, doc interface{}) (interface{}, error) {
+	call := documentCall("SaveDocument", collection, doc)
+	result, err := r.store.SaveDocument(ctx, collection, doc)
+	r.recordDocument(call, doc, err)
+	return result, err
+}
+
+func (r *Recorder) UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	call := updateManyCall(collection, filters, updateBuilder, updateOptions)
+	result, err := r.store.UpdateMany(ctx, collection, filters, updateBuilder, updateOptions)
+	if err == nil {
+		call.Result = bson.D{
+			bson.E{Key: "matched", Value: result.MatchedCount},
+			bson.E{Key: "modified", Value: result.ModifiedCount},
+			bson.E{Key: "upserted", Value: result.UpsertedCount},
+			bson.E{Key: "upserted_id", Value: result.UpsertedID},
+		}
+	}
+	r.record(call, err)
+	return result, err
+}
+
+func (r *Recorder) CountDocuments(ctx context.Context, collection string, filters interface{}) (int, error) {
+	call := countCall(collection, filters)
+	count, err := r.store.CountDocuments(ctx, collection, filters)
+	if err == nil {
+		call.Result = bson.D{bson.E{Key: "count", Value: count}}
+	}
+	r.record(call, err)
+	return count, err
+}
+
+func (r *Recorder) SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	call := documentCall("SoftDeleteDocument", collection, doc)
+	result, err := r.store.SoftDeleteDocument(ctx, collection, doc)
+	return r.recordReplace(call, doc, result, err)
+}
+
+func (r *Recorder) HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.DeleteResult, error) {
+	call := documentCall("HardDeleteDocument", collection, doc)
+	result, err := r.store.HardDeleteDocument(ctx, collection, doc)
+	if err == nil {
+		call.Result = bson.D{bson.E{Key: "deleted", Value: result.DeletedCount}}
+	}
+	r.record(call, err)
+	return result, err
+}
+
+func (r *Recorder) RestoreDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	call := documentCall("RestoreDocument", collection, doc)
+	result, err := r.store.RestoreDocument(ctx, collection, doc)
+	return r.recordReplace(call, doc, result, err)
+}
+
+// recordReplace records an operation returning the document it replaced and returns a result over the same document.
+func (r *Recorder) recordReplace(call Call, doc interface{}, result *mongo.SingleResult, err error) (*mongo.SingleResult, error) {
+	if err != nil {
+		r.record(call, err)
+		return result, err
+	}
+
+	var replaced bson.Raw
+	if result != nil {
+		if replaced, err = result.DecodeBytes(); err != nil {
+			r.record(call, err)
+			return nil, err
+		}
+	}
+	current, err := marshal(doc)
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+
+	call.Result = bson.D{bson.E{Key: "document", Value: current}, bson.E{Key: "replaced", Value: replaced}}
+	r.record(call, nil)
+	if replaced == nil {
+		return result, nil
+	}
+	return mongo.NewSingleResultFromDocument(replaced, nil, nil), nil
+}
+
+func (r *Recorder) Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error) {
+	cur, err := r.store.Aggregate(ctx, collection, pipeline, aggregateOptions)
+	return r.recordCursor(ctx, aggregateCall(collection, pipeline), cur, err)
+}
+
+func findOneCall(collection string, filters []bson.E, projection interface{}, findOneOptions []*options.FindOneOptions) Call {
+	opts := options.MergeFindOneOptions(findOneOptions...)
+	return Call{Method: "FindOne", Collection: collection, Args: bson.D{
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: opts.Sort},
+		bson.E{Key: "skip", Value: opts.Skip},
+	}}
+}
+
+func findOneByIDCall(collection string, id primitive.ObjectID, projection interface{}) Call {
+	return Call{Method: "FindOneByID", Collection: collection, Args: bson.D{
+		bson.E{Key: "id", Value: id},
+		bson.E{Key: "projection", Value: projection},
+	}}
+}
+
+func findOneByFieldCall(collection, field string, value, projection interface{}) Call {
+	return Call{Method: "FindOneByField", Collection: collection, Args: bson.D{
+		bson.E{Key: "field", Value: field},
+		bson.E{Key: "value", Value: value},
+		bson.E{Key: "projection", Value: projection},
+	}}
+}
+
+func findPaginatedCall(collection string, pageOptions database.PageOpts, filters []bson.E, projection interface{}, sort bson.D) Call {
+	return Call{Method: "FindPaginated", Collection: collection, Args: bson.D{
+		bson.E{Key: "page", Value: pageOptions.Page},
+		bson.E{Key: "per_page", Value: pageOptions.PerPage},
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: sort},
+	}}
+}
+
+func findLastCall(collection string, filters []bson.E, projection interface{}) Call {
+	return Call{Method: "FindLast", Collection: collection, Args: bson.D{
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+	}}
+}
+
+func findLastNCall(collection string, limit int, filters []bson.E, projection interface{}) Call {
+	return Call{Method: "FindLastN", Collection: collection, Args: bson.D{
+		bson.E{Key: "limit", Value: limit},
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+	}}
+}
+
+func findAllCall(collection string, filters []bson.E, projection interface{}, sort bson.D) Call {
+	return Call{Method: "FindAll", Collection: collection, Args: bson.D{
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "projection", Value: projection},
+		bson.E{Key: "sort", Value: sort},
+	}}
+}
+
+func documentCall(method, collection string, doc interface{}) Call {
+	call := Call{Method: method, Collection: collection}
+	raw, err := marshal(doc)
+	if err == nil {
+		call.Args = bson.D{bson.E{Key: "document", Value: raw}}
+	}
+	return call
+}
+
+func updateManyCall(collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) Call {
+	upsert := updateOptions != nil && updateOptions.Upsert != nil && *updateOptions.Upsert
+	var update bson.D
+	if updateBuilder != nil {
+		update = updateBuilder.Get()
+	}
+	return Call{Method: "UpdateMany", Collection: collection, Args: bson.D{
+		bson.E{Key: "filters", Value: bson.D(filters)},
+		bson.E{Key: "update", Value: update},
+		bson.E{Key: "upsert", Value: upsert},
+	}}
+}
+
+func countCall(collection string, filters interface{}) Call {
+	if e, ok := filters.([]bson.E); ok {
+		filters = bson.D(e)
+	}
+	return Call{Method: "CountDocuments", Collection: collection, Args: bson.D{bson.E{Key: "filters", Value: filters}}}
+}
+
+func aggregateCall(collection string, pipeline mongo.Pipeline) Call {
+	return Call{Method: "Aggregate", Collection: collection, Args: bson.D{bson.E{Key: "pipeline", Value: pipeline}}}
+}
@@ -0,0 +1,172 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/memstore"
+	"github.com/jcobhams/asari/operator"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+const UserCollection string = "users"
+
+type User struct {
+	document.Base `bson:",inline"`
+	FirstName     string `bson:"first_name" asari:"required"`
+	Level         int    `bson:"level"`
+}
+
+// session runs the same calls against any store and returns what they produced.
+func session(store database.Store) ([]string, error) {
+	ctx := context.Background()
+	var names []string
+
+	user := &User{FirstName: "Joseph", Level: 1}
+	user.Setup()
+	if _, err := store.SaveDocument(ctx, UserCollection, user); err != nil {
+		return nil, err
+	}
+	admin := &User{FirstName: "Ada", Level: 20}
+	admin.Setup()
+	if _, err := store.SaveDocument(ctx, UserCollection, admin); err != nil {
+		return nil, err
+	}
+
+	found := &User{}
+	if err := store.FindOneByField(ctx, UserCollection, "first_name", "Ada", nil, found); err != nil {
+		return nil, err
+	}
+	names = append(names, found.FirstName)
+
+	update := builder.NewUpdateManyBuilder()
+	update.Add(operator.Set, bson.E{Key: "level", Value: 5})
+	if _, err := store.UpdateMany(ctx, UserCollection, []bson.E{{Key: "level", Value: bson.M{"$lt": 10}}}, update, nil); err != nil {
+		return nil, err
+	}
+
+	cur, err := store.FindAll(ctx, UserCollection, nil, nil, bson.D{{Key: "first_name", Value: 1}})
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := store.DecodeAll(ctx, cur, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names = append(names, u.FirstName)
+	}
+
+	if _, err := store.SoftDeleteDocument(ctx, UserCollection, user); err != nil {
+		return nil, err
+	}
+	count, err := store.CountDocuments(ctx, UserCollection, []bson.E{{Key: "is_deleted", Value: false}})
+	if err != nil {
+		return nil, err
+	}
+	if count != 1 {
+		return nil, errors.New("soft deleted user was counted")
+	}
+
+	err = store.FindOneByField(ctx, UserCollection, "first_name", "Grace", nil, &User{})
+	return names, err
+}
+
+func record(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	recorder := NewRecorder(memstore.New(), &buf)
+
+	names, err := session(recorder)
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+	assert.Equal(t, []string{"Ada", "Ada", "Joseph"}, names)
+	assert.Nil(t, recorder.Err())
+	return &buf
+}
+
+func TestRecorder(t *testing.T) {
+	buf := record(t)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 8)
+
+	var call Call
+	assert.Nil(t, bson.UnmarshalExtJSON(lines[3], true, &call))
+	assert.Equal(t, "UpdateMany", call.Method)
+	assert.Equal(t, UserCollection, call.Collection)
+	matched, _ := lookup(call.Result, "matched")
+	assert.EqualValues(t, 1, matched)
+
+	assert.Nil(t, bson.UnmarshalExtJSON(lines[7], true, &call))
+	assert.Equal(t, "not_found", call.Error.Kind)
+}
+
+func TestReplayer(t *testing.T) {
+	replayer, err := NewReplayer(record(t), nil)
+	assert.Nil(t, err)
+
+	names, err := session(replayer)
+	assert.True(t, errors.Is(err, database.ErrNotFound))
+	assert.Equal(t, []string{"Ada", "Ada", "Joseph"}, names)
+	assert.Nil(t, replayer.Done())
+
+	t.Run("Divergence", func(t *testing.T) {
+		replayer, err := NewReplayer(record(t), nil)
+		assert.Nil(t, err)
+
+		user := &User{FirstName: "Joseph", Level: 2}
+		user.Setup()
+		_, err = replayer.SaveDocument(nil, UserCollection, user)
+
+		var divergence *DivergenceError
+		assert.True(t, errors.As(err, &divergence))
+		assert.Equal(t, 0, divergence.Index)
+		assert.Equal(t, "SaveDocument", divergence.Expected.Method)
+		assert.Equal(t, divergence, replayer.Done())
+	})
+
+	t.Run("Unconsumed", func(t *testing.T) {
+		replayer, err := NewReplayer(record(t), nil)
+		assert.Nil(t, err)
+
+		user := &User{FirstName: "Joseph", Level: 1}
+		user.Setup()
+		_, err = replayer.SaveDocument(nil, UserCollection, user)
+		assert.Nil(t, err)
+		assert.False(t, user.IsNew())
+		assert.NotNil(t, replayer.Done())
+	})
+
+	t.Run("NotRecorded", func(t *testing.T) {
+		replayer, err := NewReplayer(bytes.NewReader(nil), nil)
+		assert.Nil(t, err)
+
+		_, err = replayer.FindAll(nil, UserCollection, nil, nil, nil)
+		var divergence *DivergenceError
+		assert.True(t, errors.As(err, &divergence))
+		assert.Nil(t, divergence.Expected)
+	})
+}
+
+func TestRecordedError(t *testing.T) {
+	hookError := recordError(&database.HookError{Hook: "PreCreate", Err: errors.New("denied")})
+	var replayed *database.HookError
+	assert.True(t, errors.As(hookError.Err(), &replayed))
+	assert.Equal(t, "PreCreate", replayed.Hook)
+	assert.Equal(t, "denied", replayed.Err.Error())
+
+	duplicate := recordError(&database.WriteError{Operation: "insert", Collection: UserCollection, Err: database.ErrDuplicateKey})
+	assert.Equal(t, "duplicate_key", duplicate.Kind)
+	assert.True(t, errors.Is(duplicate.Err(), database.ErrDuplicateKey))
+
+	for _, k := range kinds {
+		assert.True(t, errors.Is(recordError(k.err).Err(), k.err), k.name)
+	}
+
+	assert.Nil(t, recordError(nil).Err())
+	assert.Equal(t, "boom", recordError(errors.New("boom")).Err().Error())
+}
@@ -0,0 +1,370 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/builder"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"reflect"
+	"sync"
+)
+
+type (
+	// ReplayOptions configures how a Replayer compares the calls made with the recorded ones.
+	ReplayOptions struct {
+		// IgnoreFields are top level document fields left out when comparing the document passed to SaveDocument,
+		// SoftDeleteDocument, HardDeleteDocument and RestoreDocument. Defaults to DefaultIgnoredFields.
+		IgnoreFields []string
+	}
+
+	// Replayer is a database.Store that serves the results of recorded calls in the order they were recorded. It
+	// never connects to a database.
+	Replayer struct {
+		mu         sync.Mutex
+		calls      []Call
+		next       int
+		ignore     map[string]bool
+		divergence *DivergenceError
+	}
+
+	// DivergenceError is returned when a call differs from the recorded call at Index. Expected is nil when every
+	// recorded call was already made.
+	DivergenceError struct {
+		Index    int
+		Expected *Call
+		Actual   *Call
+	}
+)
+
+var _ database.Store = (*Replayer)(nil)
+
+func (e *DivergenceError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("asari: call %d %s was not recorded", e.Index, describe(e.Actual))
+	}
+	return fmt.Sprintf("asari: call %d diverged from the recording, expected %s got %s", e.Index, describe(e.Expected), describe(e.Actual))
+}
+
+func describe(call *Call) string {
+	args, _ := bson.MarshalExtJSON(Call{Args: call.Args}, true, false)
+	return fmt.Sprintf("%s(%s) %s", call.Method, call.Collection, args)
+}
+
+// NewReplayer reads the calls a Recorder wrote to r.
+func NewReplayer(r io.Reader, opts *ReplayOptions) (*Replayer, error) {
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	ignore := opts.IgnoreFields
+	if ignore == nil {
+		ignore = DefaultIgnoredFields
+	}
+
+	replayer := &Replayer{ignore: map[string]bool{}}
+	for _, field := range ignore {
+		replayer.ignore[field] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var call Call
+		if err := bson.UnmarshalExtJSON(line, true, &call); err != nil {
+			return nil, errors.New(fmt.Sprintf("asari: cannot read recorded call %d: %s", len(replayer.calls), err))
+		}
+		replayer.calls = append(replayer.calls, call)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return replayer, nil
+}
+
+// Done returns the first divergence or an error if some recorded calls were not made.
+func (r *Replayer) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.divergence != nil {
+		return r.divergence
+	}
+	if left := len(r.calls) - r.next; left > 0 {
+		return errors.New(fmt.Sprintf("asari: %d recorded calls were not made, next is %s", left, describe(&r.calls[r.next])))
+	}
+	return nil
+}
+
+// replay returns the recorded call matching actual and moves to the next one.
+// A call that does not match is reported with a *DivergenceError and does not consume the recorded call.
+func (r *Replayer) replay(actual Call) (*Call, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var divergence *DivergenceError
+	if r.next >= len(r.calls) {
+		divergence = &DivergenceError{Index: r.next, Actual: &actual}
+	} else if expected := &r.calls[r.next]; !r.matches(expected, &actual) {
+		divergence = &DivergenceError{Index: r.next, Expected: expected, Actual: &actual}
+	}
+	if divergence != nil {
+		if r.divergence == nil {
+			r.divergence = divergence
+		}
+		return nil, divergence
+	}
+
+	call := &r.calls[r.next]
+	r.next++
+	return call, call.Error.Err()
+}
+
+func (r *Replayer) matches(expected, actual *Call) bool {
+	if expected.Method != actual.Method || expected.Collection != actual.Collection {
+		return false
+	}
+
+	want, err := bson.MarshalExtJSON(Call{Args: r.strip(expected.Args)}, true, false)
+	if err != nil {
+		return false
+	}
+	got, err := bson.MarshalExtJSON(Call{Args: r.strip(actual.Args)}, true, false)
+	if err != nil {
+		return false
+	}
+	return string(want) == string(got)
+}
+
+// strip removes the ignored fields from the document argument.
+func (r *Replayer) strip(args bson.D) bson.D {
+	stripped := make(bson.D, len(args))
+	for i, arg := range args {
+		stripped[i] = arg
+		if arg.Key != "document" {
+			continue
+		}
+
+		var doc bson.D
+		if raw, err := marshal(arg.Value); err != nil || raw == nil || bson.Unmarshal(raw, &doc) != nil {
+			continue
+		}
+		kept := bson.D{}
+		for _, e := range doc {
+			if !r.ignore[e.Key] {
+				kept = append(kept, e)
+			}
+		}
+		stripped[i].Value = kept
+	}
+	return stripped
+}
+
+func (r *Replayer) FindOne(ctx context.Context, collection string, filters []bson.E, projection, target interface{}, findOneOptions ...*options.FindOneOptions) error {
+	return r.replayDocument(findOneCall(collection, filters, projection, findOneOptions), target)
+}
+
+func (r *Replayer) FindOneByID(ctx context.Context, collection string, id primitive.ObjectID, projection, target interface{}) error {
+	return r.replayDocument(findOneByIDCall(collection, id, projection), target)
+}
+
+func (r *Replayer) FindOneByField(ctx context.Context, collection, field string, value, projection, target interface{}) error {
+	return r.replayDocument(findOneByFieldCall(collection, field, value, projection), target)
+}
+
+func (r *Replayer) FindPaginated(ctx context.Context, collection string, pageOptions database.PageOpts, filters []bson.E, projection interface{}, sort bson.D) (*database.PaginatedResult, error) {
+	call, err := r.replay(findPaginatedCall(collection, pageOptions, filters, projection, sort))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &database.PaginatedResult{}
+	if err := decodeResult(call, "paginator", &result.Paginator); err != nil {
+		return nil, err
+	}
+	result.Cursor, err = cursorResult(call)
+	return result, err
+}
+
+func (r *Replayer) FindLast(ctx context.Context, collection string, filters []bson.E, projection, target interface{}) error {
+	return r.replayDocument(findLastCall(collection, filters, projection), target)
+}
+
+func (r *Replayer) FindLastN(ctx context.Context, collection string, limit int, filters []bson.E, projection interface{}) (*mongo.Cursor, error) {
+	return r.replayCursor(findLastNCall(collection, limit, filters, projection))
+}
+
+func (r *Replayer) FindAll(ctx context.Context, collection string, filters []bson.E, projection interface{}, sort bson.D) (*mongo.Cursor, error) {
+	return r.replayCursor(findAllCall(collection, filters, projection, sort))
+}
+
+func (r *Replayer) DecodeAll(ctx context.Context, cur *mongo.Cursor, results interface{}) error {
+	defer cur.Close(context.Background())
+
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return database.ErrNotSlice
+	}
+
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	for cur.Next(ctx) {
+		elemValueType := elemType
+		if elemType.Kind() == reflect.Ptr {
+			elemValueType = elemType.Elem()
+		}
+		elem := reflect.New(elemValueType)
+		if err := database.Decode(cur.Current, elem.Interface()); err != nil {
+			return err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	rv.Elem().Set(slice)
+	return nil
+}
+
+func (r *Replayer) SaveDocument(ctx context.Context, collection string, doc interface{}) (interface{}, error) {
+	if err := r.replayDocument(documentCall("SaveDocument", collection, doc), doc); err != nil {
+		return nil, err
+	}
+	if d, ok := doc.(document.Document); ok {
+		d.SetIsNew(false)
+	}
+	return doc, nil
+}
+
+func (r *Replayer) UpdateMany(ctx context.Context, collection string, filters []bson.E, updateBuilder *builder.UpdateManyBuilder, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	call, err := r.replay(updateManyCall(collection, filters, updateBuilder, updateOptions))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mongo.UpdateResult{
+		MatchedCount:  count(call, "matched"),
+		ModifiedCount: count(call, "modified"),
+		UpsertedCount: count(call, "upserted"),
+	}
+	result.UpsertedID, _ = lookup(call.Result, "upserted_id")
+	return result, nil
+}
+
+func (r *Replayer) CountDocuments(ctx context.Context, collection string, filters interface{}) (int, error) {
+	call, err := r.replay(countCall(collection, filters))
+	if err != nil {
+		return 0, err
+	}
+	return int(count(call, "count")), nil
+}
+
+func (r *Replayer) SoftDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	return r.replayReplace(documentCall("SoftDeleteDocument", collection, doc), doc)
+}
+
+func (r *Replayer) HardDeleteDocument(ctx context.Context, collection string, doc interface{}) (*mongo.DeleteResult, error) {
+	call, err := r.replay(documentCall("HardDeleteDocument", collection, doc))
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: count(call, "deleted")}, nil
+}
+
+func (r *Replayer) RestoreDocument(ctx context.Context, collection string, doc interface{}) (*mongo.SingleResult, error) {
+	return r.replayReplace(documentCall("RestoreDocument", collection, doc), doc)
+}
+
+func (r *Replayer) Aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, aggregateOptions *options.AggregateOptions) (*mongo.Cursor, error) {
+	return r.replayCursor(aggregateCall(collection, pipeline))
+}
+
+func (r *Replayer) replayDocument(actual Call, target interface{}) error {
+	call, err := r.replay(actual)
+	if err != nil {
+		return err
+	}
+	return decodeResult(call, "document", target)
+}
+
+func (r *Replayer) replayCursor(actual Call) (*mongo.Cursor, error) {
+	call, err := r.replay(actual)
+	if err != nil {
+		return nil, err
+	}
+	return cursorResult(call)
+}
+
+func (r *Replayer) replayReplace(actual Call, doc interface{}) (*mongo.SingleResult, error) {
+	call, err := r.replay(actual)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeResult(call, "document", doc); err != nil {
+		return nil, err
+	}
+
+	replaced, ok := lookup(call.Result, "replaced")
+	if !ok || replaced == nil {
+		return nil, nil
+	}
+	raw, err := marshal(replaced)
+	if err != nil {
+		return nil, err
+	}
+	return mongo.NewSingleResultFromDocument(raw, nil, nil), nil
+}
+
+// decodeResult decodes the recorded result key into target.
+func decodeResult(call *Call, key string, target interface{}) error {
+	value, ok := lookup(call.Result, key)
+	if !ok || value == nil {
+		return errors.New(fmt.Sprintf("asari: recorded %s call has no %s", call.Method, key))
+	}
+	raw, err := marshal(value)
+	if err != nil {
+		return err
+	}
+	return database.Decode(raw, target)
+}
+
+func cursorResult(call *Call) (*mongo.Cursor, error) {
+	value, _ := lookup(call.Result, "documents")
+	values, _ := value.(primitive.A)
+
+	docs := make([]bson.Raw, len(values))
+	for i, v := range values {
+		raw, err := marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = raw
+	}
+	return newCursor(docs)
+}
+
+func count(call *Call, key string) int64 {
+	value, _ := lookup(call.Result, key)
+	switch n := value.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	objectIDType   = reflect.TypeOf(primitive.ObjectID{})
+	decimalType    = reflect.TypeOf(primitive.Decimal128{})
+	dateTimeType   = reflect.TypeOf(primitive.DateTime(0))
+	timestampType  = reflect.TypeOf(primitive.Timestamp{})
+	binaryType     = reflect.TypeOf(primitive.Binary{})
+	regexType      = reflect.TypeOf(primitive.Regex{})
+	rawType        = reflect.TypeOf(bson.Raw{})
+	emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Generate builds a $jsonSchema document from a document struct using its bson tags.
+// Fields without omitempty are always written by the driver and are listed as required. Pointers, slices and maps
+// also accept null since that is how the driver writes their nil value. Fields holding interface{} are unconstrained.
+// doc can be a struct or a pointer to a struct - eg: &User{}
+func Generate(doc interface{}) (bson.M, error) {
+	t := reflect.TypeOf(doc)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("asari: schemas can only be generated from structs")
+	}
+	return object(t, map[reflect.Type]bool{})
+}
+
+func object(t reflect.Type, visiting map[reflect.Type]bool) (bson.M, error) {
+	s := bson.M{"bsonType": "object"}
+	if visiting[t] {
+		//Recursive types are left open past the first level
+		return s, nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	properties := bson.M{}
+	required := bson.A{}
+	for _, f := range document.Fields(t) {
+		property, err := property(f.StructField.Type, visiting)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("asari: field %s: %v", f.Name, err))
+		}
+		properties[f.Name] = property
+
+		if !f.OmitEmpty {
+			required = append(required, f.Name)
+		}
+	}
+
+	s["properties"] = properties
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s, nil
+}
+
+func property(t reflect.Type, visiting map[reflect.Type]bool) (bson.M, error) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+	}
+
+	var s bson.M
+	switch {
+	case t == emptyInterface:
+		return bson.M{}, nil
+	case t == timeType || t == dateTimeType:
+		s = bson.M{"bsonType": "date"}
+	case t == objectIDType:
+		s = bson.M{"bsonType": "objectId"}
+	case t == decimalType:
+		s = bson.M{"bsonType": "decimal"}
+	case t == timestampType:
+		s = bson.M{"bsonType": "timestamp"}
+	case t == binaryType:
+		s = bson.M{"bsonType": "binData"}
+	case t == regexType:
+		s = bson.M{"bsonType": "regex"}
+	case t == rawType:
+		s = bson.M{"bsonType": "object"}
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			s = bson.M{"bsonType": "string"}
+		case reflect.Bool:
+			s = bson.M{"bsonType": "bool"}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+			s = bson.M{"bsonType": "int"}
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+			//The driver writes these as int32 when the value fits
+			s = bson.M{"bsonType": bson.A{"int", "long"}}
+		case reflect.Float32, reflect.Float64:
+			s = bson.M{"bsonType": "double"}
+		case reflect.Struct:
+			obj, err := object(t, visiting)
+			if err != nil {
+				return nil, err
+			}
+			s = obj
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return nil, errors.New(fmt.Sprintf("map keys must be strings, got %s", t.Key()))
+			}
+			nullable = true
+			s = bson.M{"bsonType": "object"}
+			if t.Elem() != emptyInterface {
+				values, err := property(t.Elem(), visiting)
+				if err != nil {
+					return nil, err
+				}
+				s["additionalProperties"] = values
+			}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				nullable = nullable || t.Kind() == reflect.Slice
+				s = bson.M{"bsonType": "binData"}
+				break
+			}
+			if t.Kind() == reflect.Slice {
+				nullable = true
+			}
+			items, err := property(t.Elem(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			s = bson.M{"bsonType": "array", "items": items}
+		default:
+			return nil, errors.New(fmt.Sprintf("unsupported type %s", t))
+		}
+	}
+
+	if nullable {
+		s["bsonType"] = appendNull(s["bsonType"])
+	}
+	return s, nil
+}
+
+func appendNull(bsonType interface{}) bson.A {
+	if types, ok := bsonType.(bson.A); ok {
+		return append(append(bson.A{}, types...), "null")
+	}
+	return bson.A{bsonType, "null"}
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"github.com/jcobhams/asari/document"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+type node struct {
+	Name     string `bson:"name"`
+	Children []node `bson:"children"`
+}
+
+type profile struct {
+	document.Base `bson:",inline"`
+	FirstName     string               `bson:"first_name"`
+	Nickname      *string              `bson:"nickname,omitempty"`
+	Level         int                  `bson:"level"`
+	Score         float64              `bson:"score"`
+	Tags          []string             `bson:"tags"`
+	Meta          map[string]int       `bson:"meta"`
+	Extra         interface{}          `bson:"extra"`
+	Avatar        []byte               `bson:"avatar"`
+	Friends       []primitive.ObjectID `bson:"friends"`
+	Verified      *time.Time           `bson:"verified"`
+	Tree          node                 `bson:"tree"`
+	Address       struct {
+		City string `bson:"city"`
+	} `bson:"address"`
+}
+
+func TestGenerate(t *testing.T) {
+	s, err := Generate(&profile{})
+	assert.Nil(t, err)
+	assert.Equal(t, "object", s["bsonType"])
+
+	properties := s["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "objectId"}, properties["_id"])
+	assert.Equal(t, bson.M{"bsonType": "date"}, properties["created_at"])
+	assert.Equal(t, bson.M{"bsonType": "bool"}, properties["is_deleted"])
+	assert.Equal(t, bson.M{"bsonType": "string"}, properties["first_name"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"string", "null"}}, properties["nickname"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"int", "long"}}, properties["level"])
+	assert.Equal(t, bson.M{"bsonType": "double"}, properties["score"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "string"}}, properties["tags"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"object", "null"}, "additionalProperties": bson.M{"bsonType": bson.A{"int", "long"}}}, properties["meta"])
+	assert.Equal(t, bson.M{}, properties["extra"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"binData", "null"}}, properties["avatar"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "objectId"}}, properties["friends"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"date", "null"}}, properties["verified"])
+
+	address := properties["address"].(bson.M)
+	assert.Equal(t, "object", address["bsonType"])
+	assert.Equal(t, bson.A{"city"}, address["required"])
+
+	//Test Recursive Types Stop At The Second Level
+	tree := properties["tree"].(bson.M)
+	children := tree["properties"].(bson.M)["children"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "object"}, children["items"])
+
+	required := s["required"].(bson.A)
+	assert.Contains(t, required, "created_at")
+	assert.NotContains(t, required, "_id")
+	assert.NotContains(t, required, "deleted_at")
+	assert.NotContains(t, required, "nickname")
+
+	//Test Invalid Values
+	_, err = Generate("asari")
+	assert.Error(t, err)
+
+	_, err = Generate(&struct {
+		Lookup map[int]string `bson:"lookup"`
+	}{})
+	assert.Error(t, err)
+}
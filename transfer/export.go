@@ -0,0 +1,171 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"github.com/jcobhams/asari/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportJSONLines writes the documents of collection matching filters to w as Extended JSON, one document per line,
+// and returns the number of documents written. Filters and projection are those of Store.FindAll, soft deleted
+// documents are left out unless filters include is_deleted.
+func ExportJSONLines(ctx context.Context, store database.Store, w io.Writer, collection string, filters []bson.E, projection interface{}, exportOptions *ExportOptions) (int, error) {
+	if exportOptions == nil {
+		exportOptions = &ExportOptions{}
+	}
+
+	buffered := bufio.NewWriter(w)
+	n, err := export(ctx, store, collection, filters, projection, exportOptions, func(raw bson.Raw) error {
+		line, err := bson.MarshalExtJSON(raw, !exportOptions.Relaxed, false)
+		if err != nil {
+			return err
+		}
+		if _, err := buffered.Write(line); err != nil {
+			return err
+		}
+		return buffered.WriteByte('\n')
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, buffered.Flush()
+}
+
+// ExportCSV writes the documents of collection matching filters to w as CSV with a header row, and returns the number
+// of documents written. Filters and projection are those of ExportJSONLines.
+// Strings and numbers are written as is, ObjectIDs as hex, dates as RFC 3339 in UTC and missing or null fields as
+// empty cells. Embedded documents, arrays and other values are written as relaxed Extended JSON.
+func ExportCSV(ctx context.Context, store database.Store, w io.Writer, collection string, filters []bson.E, projection interface{}, exportOptions *ExportOptions) (int, error) {
+	if exportOptions == nil {
+		exportOptions = &ExportOptions{}
+	}
+
+	writer := csv.NewWriter(w)
+	columns := exportOptions.Columns
+	if len(columns) > 0 {
+		if err := writer.Write(headers(columns)); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := export(ctx, store, collection, filters, projection, exportOptions, func(raw bson.Raw) error {
+		if len(columns) == 0 {
+			var err error
+			if columns, err = topLevelColumns(raw); err != nil {
+				return err
+			}
+			if err := writer.Write(headers(columns)); err != nil {
+				return err
+			}
+		}
+
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			value, err := raw.LookupErr(strings.Split(column.Path, ".")...)
+			if err != nil {
+				continue
+			}
+			if row[i], err = formatCell(value); err != nil {
+				return err
+			}
+		}
+		return writer.Write(row)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	writer.Flush()
+	return n, writer.Error()
+}
+
+// export passes every document of collection matching filters to write and closes the cursor.
+func export(ctx context.Context, store database.Store, collection string, filters []bson.E, projection interface{}, exportOptions *ExportOptions, write func(raw bson.Raw) error) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sort := exportOptions.Sort
+	if sort == nil {
+		sort = bson.D{bson.E{Key: "_id", Value: 1}}
+	}
+
+	cur, err := store.FindAll(ctx, collection, filters, projection, sort)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(context.Background())
+
+	n := 0
+	for cur.Next(ctx) {
+		if err := write(cur.Current); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cur.Err()
+}
+
+func topLevelColumns(raw bson.Raw) ([]Column, error) {
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, ErrNoColumns
+	}
+
+	columns := make([]Column, len(elements))
+	for i, e := range elements {
+		columns[i] = Column{Header: e.Key(), Path: e.Key()}
+	}
+	return columns, nil
+}
+
+func headers(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Header
+	}
+	return names
+}
+
+func formatCell(value bson.RawValue) (string, error) {
+	switch value.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return "", nil
+	case bsontype.String:
+		return value.StringValue(), nil
+	case bsontype.ObjectID:
+		return value.ObjectID().Hex(), nil
+	case bsontype.DateTime:
+		return value.Time().UTC().Format(time.RFC3339Nano), nil
+	case bsontype.Boolean:
+		return strconv.FormatBool(value.Boolean()), nil
+	case bsontype.Int32:
+		return strconv.FormatInt(int64(value.Int32()), 10), nil
+	case bsontype.Int64:
+		return strconv.FormatInt(value.Int64(), 10), nil
+	case bsontype.Double:
+		return strconv.FormatFloat(value.Double(), 'g', -1, 64), nil
+	case bsontype.Decimal128:
+		return value.Decimal128().String(), nil
+	}
+	return valueExtJSON(value)
+}
+
+// valueExtJSON returns a value as relaxed Extended JSON. Values are marshalled in a wrapping document as only documents
+// can be marshalled on their own.
+func valueExtJSON(value bson.RawValue) (string, error) {
+	out, err := bson.MarshalExtJSON(bson.D{bson.E{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(out), `{"v":`), "}"), nil
+}
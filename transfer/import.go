@@ -0,0 +1,456 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotDocument is returned for every document when newDocument does not return a document.Document.
+	ErrNotDocument = errors.New("asari: imported documents must implement document.Document")
+
+	objectIDType   = reflect.TypeOf(primitive.ObjectID{})
+	decimal128Type = reflect.TypeOf(primitive.Decimal128{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+type (
+	importer struct {
+		ctx           context.Context
+		store         database.Store
+		collection    string
+		newDocument   func() interface{}
+		importOptions *ImportOptions
+		report        *ImportReport
+		// inserter inserts the batched new documents, nil when documents are saved one at a time.
+		inserter  database.BatchInserter
+		batchSize int
+		batch     []pendingDocument
+	}
+
+	// pendingDocument is a new document waiting in a batch and the line it was read on.
+	pendingDocument struct {
+		line int
+		doc  interface{}
+	}
+)
+
+// ImportJSONLines reads Extended JSON documents from r, one per line, and saves them in collection. Every document is
+// decoded with database.Decode into a new value returned by newDocument - eg: func() interface{} { return &User{} },
+// so schema upgrades apply. Blank lines are skipped.
+// Documents without an _id are set up as new documents. Documents with an _id must have their created_at and
+// updated_at timestamps to be saved.
+// The returned error stops the import - eg: r failing, ctx done or a failure with ImportOptions.StopOnError. The
+// report is returned with it.
+func ImportJSONLines(ctx context.Context, store database.Store, r io.Reader, collection string, newDocument func() interface{}, importOptions *ImportOptions) (*ImportReport, error) {
+	imp := newImporter(ctx, store, collection, newDocument, importOptions)
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var raw bson.Raw
+			err := bson.UnmarshalExtJSON(data, false, &raw)
+			if err := imp.add(line, raw, err); err != nil {
+				return imp.done(err)
+			}
+		}
+
+		if readErr == io.EOF {
+			return imp.done(nil)
+		}
+		if readErr != nil {
+			return imp.done(readErr)
+		}
+	}
+}
+
+// ImportCSV reads documents from the CSV rows of r and saves them in collection like ImportJSONLines. The first row
+// holds the headers, mapped to document fields with ImportOptions.Columns. Headers without a column are ignored.
+// Cells are parsed for the type of the field they fill in the documents returned by newDocument, as ExportCSV writes
+// them: ObjectIDs from hex, dates from RFC 3339 and embedded documents, arrays and maps from Extended JSON. Cells of
+// unknown fields are imported as strings, empty cells are left out. Numeric segments of paths index arrays - eg:
+// "tags.0", unless they name the keys of a map field.
+func ImportCSV(ctx context.Context, store database.Store, r io.Reader, collection string, newDocument func() interface{}, importOptions *ImportOptions) (*ImportReport, error) {
+	imp := newImporter(ctx, store, collection, newDocument, importOptions)
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return imp.report, nil
+	}
+	if err != nil {
+		return imp.report, err
+	}
+
+	paths := make([][]string, len(header))
+	found := false
+	for i, name := range header {
+		path := name
+		if imp.importOptions.Columns != nil {
+			path = ""
+			for _, column := range imp.importOptions.Columns {
+				if column.Header == name {
+					path = column.Path
+				}
+			}
+		}
+		if path != "" {
+			paths[i] = strings.Split(path, ".")
+			found = true
+		}
+	}
+	if !found {
+		return imp.report, ErrNoColumns
+	}
+
+	types := make([]reflect.Type, len(paths))
+	indexes := make([][]bool, len(paths))
+	documentType := reflect.TypeOf(newDocument())
+	for i, path := range paths {
+		if path != nil {
+			types[i] = fieldType(documentType, path)
+			indexes[i] = arrayIndexes(documentType, path)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return imp.done(nil)
+		}
+		if err != nil {
+			return imp.done(err)
+		}
+
+		raw, err := row(record, paths, indexes, types)
+		if err := imp.add(line, raw, err); err != nil {
+			return imp.done(err)
+		}
+	}
+}
+
+func newImporter(ctx context.Context, store database.Store, collection string, newDocument func() interface{}, importOptions *ImportOptions) *importer {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if importOptions == nil {
+		importOptions = &ImportOptions{}
+	}
+
+	imp := &importer{
+		ctx:           ctx,
+		store:         store,
+		collection:    collection,
+		newDocument:   newDocument,
+		importOptions: importOptions,
+		report:        &ImportReport{},
+		batchSize:     importOptions.BatchSize,
+	}
+	if imp.batchSize <= 0 {
+		imp.batchSize = DefaultImportBatchSize
+	}
+	if !importOptions.DryRun && !importOptions.StopOnError {
+		imp.inserter, _ = store.(database.BatchInserter)
+	}
+	return imp
+}
+
+// add imports the document read on line, or records err when it could not be read. New documents are batched when
+// the store is a database.BatchInserter, other documents are saved once the documents read before them are.
+func (imp *importer) add(line int, raw bson.Raw, err error) error {
+	imp.report.Read++
+	var doc interface{}
+	if err == nil {
+		doc, err = imp.decode(raw)
+	}
+
+	if err == nil && imp.inserter != nil && doc.(document.Document).IsNew() {
+		imp.batch = append(imp.batch, pendingDocument{line: line, doc: doc})
+		if len(imp.batch) >= imp.batchSize {
+			imp.flush()
+		}
+		return imp.ctx.Err()
+	}
+
+	imp.flush()
+	if err == nil {
+		err = imp.save(doc)
+	}
+	if err != nil {
+		if failure := imp.fail(line, err); imp.importOptions.StopOnError {
+			return failure
+		}
+	}
+	return imp.ctx.Err()
+}
+
+// fail records the failure of the document read on line.
+func (imp *importer) fail(line int, err error) *ImportError {
+	failure := &ImportError{Line: line, Err: err}
+	imp.report.Failures = append(imp.report.Failures, failure)
+	return failure
+}
+
+// flush inserts the batched documents.
+func (imp *importer) flush() {
+	if len(imp.batch) == 0 {
+		return
+	}
+	batch := imp.batch
+	imp.batch = nil
+
+	docs := make([]interface{}, len(batch))
+	for i, pending := range batch {
+		docs[i] = pending.doc
+	}
+
+	err := imp.inserter.InsertDocuments(imp.ctx, imp.collection, docs)
+	var failed database.DocumentErrors
+	if err != nil && !errors.As(err, &failed) {
+		for _, pending := range batch {
+			imp.fail(pending.line, err)
+		}
+		return
+	}
+
+	for i, pending := range batch {
+		if err, ok := failed[i]; ok {
+			imp.fail(pending.line, err)
+			continue
+		}
+		imp.report.Imported++
+	}
+}
+
+// done flushes the last batch and returns the report with err.
+func (imp *importer) done(err error) (*ImportReport, error) {
+	imp.flush()
+	return imp.report, err
+}
+
+// decode decodes raw into a new document, set up as new unless it replaces a stored document.
+func (imp *importer) decode(raw bson.Raw) (interface{}, error) {
+	doc := imp.newDocument()
+	d, ok := doc.(document.Document)
+	if !ok {
+		return nil, ErrNotDocument
+	}
+	if err := database.Decode(raw, doc); err != nil {
+		return nil, err
+	}
+
+	if d.GetID().IsZero() {
+		if err := d.Setup(); err != nil {
+			return nil, err
+		}
+	} else {
+		d.SetIsNew(!imp.importOptions.Replace)
+	}
+	return doc, nil
+}
+
+// save saves doc on its own, or checks it in a dry run.
+func (imp *importer) save(doc interface{}) error {
+	if imp.importOptions.DryRun {
+		if err := dryRun(imp.ctx, doc); err != nil {
+			return err
+		}
+	} else if _, err := imp.store.SaveDocument(imp.ctx, imp.collection, doc); err != nil {
+		return err
+	}
+
+	imp.report.Imported++
+	return nil
+}
+
+// dryRun checks doc as SaveDocument would without saving it: its PreCreate or PreUpdate hook runs before it is
+// validated.
+func dryRun(ctx context.Context, doc interface{}) error {
+	d := doc.(document.Document)
+	if !d.CanSave() {
+		return database.ErrNotSetup
+	}
+
+	if d.IsNew() {
+		if preCreator, ok := doc.(document.PreCreator); ok {
+			if err := preCreator.PreCreate(nil); err != nil {
+				return &database.HookError{Hook: "PreCreate", Err: err}
+			}
+		}
+	} else if preUpdater, ok := doc.(document.PreUpdater); ok {
+		if err := preUpdater.PreUpdate(nil); err != nil {
+			return &database.HookError{Hook: "PreUpdate", Err: err}
+		}
+	}
+
+	return validator.Validate(ctx, nil, doc)
+}
+
+// row returns the document of a CSV record, setting the parsed cells at their paths.
+func row(record []string, paths [][]string, indexes [][]bool, types []reflect.Type) (bson.Raw, error) {
+	var doc interface{} = bson.D{}
+	for i, cell := range record {
+		if i >= len(paths) || paths[i] == nil || cell == "" {
+			continue
+		}
+		value, err := parseCell(cell, types[i])
+		if err != nil {
+			return nil, fmt.Errorf("asari: cannot parse %s: %w", strings.Join(paths[i], "."), err)
+		}
+		doc = setPath(doc, paths[i], indexes[i], value)
+	}
+	return bson.Marshal(doc)
+}
+
+// setPath sets value at path in container, an embedded document or an array for the segments of path that index
+// arrays. Arrays are grown with null elements to hold the index.
+func setPath(container interface{}, path []string, indexes []bool, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	if indexes[0] {
+		if array, ok := container.(bson.A); ok || container == nil {
+			index, _ := strconv.Atoi(path[0])
+			for len(array) <= index {
+				array = append(array, nil)
+			}
+			array[index] = setPath(array[index], path[1:], indexes[1:], value)
+			return array
+		}
+	}
+
+	doc, _ := container.(bson.D)
+	for i := range doc {
+		if doc[i].Key == path[0] {
+			doc[i].Value = setPath(doc[i].Value, path[1:], indexes[1:], value)
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: path[0], Value: setPath(nil, path[1:], indexes[1:], value)})
+}
+
+// arrayIndexes reports which segments of path index arrays: numeric segments of array fields of t, or of fields t
+// does not have.
+func arrayIndexes(t reflect.Type, path []string) []bool {
+	indexes := make([]bool, len(path))
+	for i, segment := range path {
+		if index, err := strconv.Atoi(segment); err != nil || index < 0 {
+			continue
+		}
+		parent := fieldType(t, path[:i])
+		indexes[i] = parent == nil || parent.Kind() == reflect.Slice || parent.Kind() == reflect.Array
+	}
+	return indexes
+}
+
+// parseCell parses a cell for a field of type t, nil when the field is unknown.
+func parseCell(cell string, t reflect.Type) (interface{}, error) {
+	if t == nil {
+		return cell, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case objectIDType:
+		return primitive.ObjectIDFromHex(cell)
+	case decimal128Type:
+		return primitive.ParseDecimal128(cell)
+	case timeType:
+		return time.Parse(time.RFC3339Nano, cell)
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Interface:
+		return cell, nil
+	case reflect.Bool:
+		return strconv.ParseBool(cell)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseInt(cell, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(cell, 64)
+	}
+
+	var wrapper bson.D
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+cell+`}`), false, &wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper[0].Value, nil
+}
+
+// fieldType returns the type of the field of t at path, following bson struct tags, or nil if t has no such field.
+func fieldType(t reflect.Type, path []string) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || len(path) == 0 {
+		return t
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return fieldType(t.Elem(), path[1:])
+	case reflect.Slice, reflect.Array:
+		if _, err := strconv.Atoi(path[0]); err != nil {
+			return nil
+		}
+		return fieldType(t.Elem(), path[1:])
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			if ft := fieldType(field.Type, path); ft != nil {
+				return ft
+			}
+			continue
+		}
+		if name == path[0] {
+			return fieldType(field.Type, path[1:])
+		}
+	}
+	return nil
+}
+
+func bsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("bson")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			return "", true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], false
+	}
+	return strings.ToLower(field.Name), false
+}
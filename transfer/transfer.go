@@ -0,0 +1,87 @@
+// Package transfer exports the documents of a collection as Extended JSON Lines or CSV and imports them back.
+//
+// Exports stream the documents matching filters through a cursor, so large collections are never held in memory:
+//
+//	n, err := transfer.ExportJSONLines(ctx, client, w, "users", queryfilter.New().AddFilter(bson.E{Key: "level", Value: 2}).GetFilters(), nil, nil)
+//
+// Imports decode every line or row into a new document and save it with Store.SaveDocument, so document hooks,
+// validation, tenancy and auditing apply as they do for any other write. Stores implementing database.BatchInserter
+// insert new documents in batches instead, with the same hooks and validation:
+//
+//	report, err := transfer.ImportJSONLines(ctx, client, r, "users", func() interface{} { return &User{} }, &transfer.ImportOptions{DryRun: true})
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultImportBatchSize is the number of new documents inserted together when ImportOptions does not set BatchSize.
+const DefaultImportBatchSize = 100
+
+type (
+	// Column maps a CSV column to a field of the documents.
+	Column struct {
+		Header string
+		// Path is the dotted path of the field - eg: "address.city", "tags.0".
+		Path string
+	}
+
+	// ExportOptions configures an export.
+	ExportOptions struct {
+		// Sort orders the exported documents. Defaults to ascending _id.
+		Sort bson.D
+		// Relaxed writes JSON Lines as relaxed Extended JSON, easier to read but losing the distinction between number
+		// types. Defaults to canonical Extended JSON.
+		Relaxed bool
+		// Columns are the CSV columns. Defaults to the top level fields of the first document, headed by their names.
+		Columns []Column
+	}
+
+	// ImportOptions configures an import.
+	ImportOptions struct {
+		// DryRun decodes and validates every document without saving it. The PreCreate or PreUpdate hook of every
+		// document runs before it is validated, as it does when saved, with a nil database. Other hooks do not run and
+		// ref validation rules are skipped as they need the database.
+		DryRun bool
+		// Replace saves documents as updates of the stored documents with the same _id. By default, documents are
+		// inserted with their _id, or a new one when they have none.
+		Replace bool
+		// StopOnError stops the import at the first document that fails. By default, failures are added to the report
+		// and the import carries on.
+		StopOnError bool
+		// Columns map the CSV headers to document fields. Defaults to every header being the path of its field.
+		Columns []Column
+		// BatchSize is the number of new documents inserted together when the store is a database.BatchInserter.
+		// Defaults to DefaultImportBatchSize. Dry runs and imports with StopOnError save documents one at a time.
+		BatchSize int
+	}
+
+	// ImportReport summarises an import.
+	ImportReport struct {
+		// Read is the number of documents read.
+		Read int
+		// Imported is the number of documents saved, or that passed validation in a dry run.
+		Imported int
+		Failures []*ImportError
+	}
+
+	// ImportError is a document that failed to import. Line is the line of the document in the input, starting at 1.
+	// For CSV, it is the row of the document, the header row being 1.
+	ImportError struct {
+		Line int
+		Err  error
+	}
+)
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("asari: import failed on line %d: %v", e.Line, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNoColumns is returned by CSV exports and imports that cannot determine their columns.
+var ErrNoColumns = errors.New("asari: no CSV columns to export or import")
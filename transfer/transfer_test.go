@@ -0,0 +1,253 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/database"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/memstore"
+	"github.com/jcobhams/asari/queryfilter"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"testing"
+)
+
+type member struct {
+	document.Base `bson:",inline"`
+	Name          string   `bson:"name" asari:"required"`
+	Level         int      `bson:"level"`
+	Address       address  `bson:"address"`
+	Tags          []string `bson:"tags"`
+}
+
+type address struct {
+	City string `bson:"city"`
+}
+
+var created int
+
+func (m *member) PreCreate(dbConnection *mongo.Database) error {
+	created++
+	if m.Name == "Mallory" {
+		return errors.New("blocked")
+	}
+	return nil
+}
+
+// batchingStore records the size of the batches inserted in the store it wraps.
+type batchingStore struct {
+	*memstore.Client
+	batches []int
+}
+
+func (s *batchingStore) InsertDocuments(ctx context.Context, collection string, docs []interface{}) error {
+	s.batches = append(s.batches, len(docs))
+	return s.Client.InsertDocuments(ctx, collection, docs)
+}
+
+// unbatchedStore hides the BatchInserter of the store it wraps.
+type unbatchedStore struct {
+	database.Store
+}
+
+func newMember() interface{} {
+	return &member{}
+}
+
+func seed(t *testing.T, store database.Store) []*member {
+	var members []*member
+	for i, name := range []string{"Ada", "Grace", "Joseph"} {
+		m := &member{Name: name, Level: i + 1, Address: address{City: "Lagos"}, Tags: []string{"ops", name}}
+		m.Setup()
+		if _, err := store.SaveDocument(context.Background(), "members", m); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, m)
+	}
+	return members
+}
+
+func TestJSONLines(t *testing.T) {
+	source := memstore.New()
+	members := seed(t, source)
+
+	var out bytes.Buffer
+	filters := queryfilter.New().AddFilter(bson.E{Key: "level", Value: bson.M{"$gte": 2}}).GetFilters()
+	n, err := ExportJSONLines(context.Background(), source, &out, "members", filters, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"name":"Grace"`)
+		assert.Contains(t, lines[0], `"level":{"$numberInt":"2"}`)
+	}
+
+	//Test Dry Runs Run Pre Hooks And Save Nothing
+	created = 0
+	target := memstore.New()
+	report, err := ImportJSONLines(context.Background(), target, bytes.NewReader(out.Bytes()), "members", newMember, &ImportOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportReport{Read: 2, Imported: 2}, report)
+	assert.Equal(t, 2, created)
+	count, _ := target.CountDocuments(context.Background(), "members", bson.D{})
+	assert.Equal(t, 0, count)
+
+	report, err = ImportJSONLines(context.Background(), target, strings.NewReader(`{"name": "Mallory"}`), "members", newMember, &ImportOptions{DryRun: true})
+	assert.Nil(t, err)
+	if assert.Len(t, report.Failures, 1) {
+		assert.IsType(t, &database.HookError{}, report.Failures[0].Err)
+	}
+
+	created = 0
+	report, err = ImportJSONLines(context.Background(), target, bytes.NewReader(out.Bytes()), "members", newMember, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 2, created)
+
+	imported := &member{}
+	assert.Nil(t, target.FindOneByID(context.Background(), "members", members[2].ID, nil, imported))
+	assert.Equal(t, "Joseph", imported.Name)
+	assert.Equal(t, []string{"ops", "Joseph"}, imported.Tags)
+	assert.Equal(t, members[2].CreatedAt.Unix(), imported.CreatedAt.Unix())
+
+	//Test Failures Are Reported By Line
+	input := strings.Join([]string{
+		lines[0],
+		`{"name": "Mallory"}`,
+		``,
+		`{"name": ""}`,
+		`not json`,
+		`{"name": "Linus", "level": 9}`,
+	}, "\n")
+	report, err = ImportJSONLines(context.Background(), target, strings.NewReader(input), "members", newMember, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, report.Read)
+	assert.Equal(t, 1, report.Imported)
+	if assert.Len(t, report.Failures, 4) {
+		assert.Equal(t, 1, report.Failures[0].Line)
+		assert.True(t, errors.Is(report.Failures[0].Err, database.ErrDuplicateKey), report.Failures[0].Err)
+		assert.Equal(t, 2, report.Failures[1].Line)
+		assert.IsType(t, &database.HookError{}, report.Failures[1].Err)
+		assert.Equal(t, 4, report.Failures[2].Line)
+		assert.IsType(t, &database.ValidationError{}, report.Failures[2].Err)
+		assert.Equal(t, 5, report.Failures[3].Line)
+	}
+
+	report, err = ImportJSONLines(context.Background(), target, strings.NewReader(input), "members", newMember, &ImportOptions{StopOnError: true})
+	assert.Equal(t, report.Failures[0], err)
+	assert.Equal(t, 1, report.Read)
+
+	//Test Replace Updates Stored Documents
+	line := strings.Replace(lines[0], `"name":"Grace"`, `"name":"Grace Hopper"`, 1)
+	report, err = ImportJSONLines(context.Background(), target, strings.NewReader(line), "members", newMember, &ImportOptions{Replace: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Imported)
+	assert.Nil(t, target.FindOneByID(context.Background(), "members", members[1].ID, nil, imported))
+	assert.Equal(t, "Grace Hopper", imported.Name)
+}
+
+func TestBatches(t *testing.T) {
+	source := memstore.New()
+	seed(t, source)
+	var out bytes.Buffer
+	_, err := ExportJSONLines(context.Background(), source, &out, "members", nil, nil, nil)
+	assert.Nil(t, err)
+
+	//Test New Documents Are Inserted In Batches
+	created = 0
+	target := &batchingStore{Client: memstore.New()}
+	input := out.String() + `{"name": "Mallory"}` + "\n"
+	report, err := ImportJSONLines(context.Background(), target, strings.NewReader(input), "members", newMember, &ImportOptions{BatchSize: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 1}, target.batches)
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 4, created)
+	if assert.Len(t, report.Failures, 1) {
+		assert.Equal(t, 4, report.Failures[0].Line)
+		assert.IsType(t, &database.HookError{}, report.Failures[0].Err)
+	}
+
+	//Test Replacements Are Saved After The Batched Documents Read Before Them
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	input = `{"name": "Linus"}` + "\n" + strings.Replace(lines[0], `"name":"Ada"`, `"name":"Ada Lovelace"`, 1)
+	report, err = ImportJSONLines(context.Background(), target, strings.NewReader(input), "members", newMember, &ImportOptions{Replace: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, []int{3, 1, 1}, target.batches)
+
+	//Test Stores Without Batches Save Every Document
+	unbatched := unbatchedStore{Store: memstore.New()}
+	report, err = ImportJSONLines(context.Background(), unbatched, bytes.NewReader(out.Bytes()), "members", newMember, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Imported)
+	count, _ := unbatched.CountDocuments(context.Background(), "members", bson.D{})
+	assert.Equal(t, 3, count)
+}
+
+func TestCSV(t *testing.T) {
+	source := memstore.New()
+	members := seed(t, source)
+
+	columns := []Column{
+		{Header: "ID", Path: "_id"},
+		{Header: "Name", Path: "name"},
+		{Header: "Level", Path: "level"},
+		{Header: "City", Path: "address.city"},
+		{Header: "Tags", Path: "tags"},
+		{Header: "First Tag", Path: "tags.0"},
+		{Header: "Created", Path: "created_at"},
+		{Header: "Updated", Path: "updated_at"},
+	}
+	var out bytes.Buffer
+	n, err := ExportCSV(context.Background(), source, &out, "members", nil, nil, &ExportOptions{Columns: columns})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	rows := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, "ID,Name,Level,City,Tags,First Tag,Created,Updated", rows[0])
+		assert.True(t, strings.HasPrefix(rows[1], members[0].ID.Hex()+`,Ada,1,Lagos,"[""ops"",""Ada""]",ops,`))
+	}
+
+	target := memstore.New()
+	report, err := ImportCSV(context.Background(), target, bytes.NewReader(out.Bytes()), "members", newMember, &ImportOptions{Columns: columns})
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportReport{Read: 3, Imported: 3}, report)
+
+	imported := &member{}
+	assert.Nil(t, target.FindOneByID(context.Background(), "members", members[1].ID, nil, imported))
+	assert.Equal(t, "Grace", imported.Name)
+	assert.Equal(t, 2, imported.Level)
+	assert.Equal(t, "Lagos", imported.Address.City)
+	assert.Equal(t, []string{"ops", "Grace"}, imported.Tags)
+	assert.Equal(t, members[1].CreatedAt.Unix(), imported.CreatedAt.Unix())
+
+	//Test Default Columns Are The Top Level Fields
+	out.Reset()
+	_, err = ExportCSV(context.Background(), source, &out, "members", nil, bson.M{"name": 1, "level": 1}, nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "_id,name,level\n"))
+
+	//Test Headers Are Paths By Default And Unparseable Cells Fail
+	report, err = ImportCSV(context.Background(), target, strings.NewReader("name,level,nickname\nLinus,9,penguin\nKen,nine,\n"), "members", newMember, &ImportOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Imported)
+	if assert.Len(t, report.Failures, 1) {
+		assert.Equal(t, 3, report.Failures[0].Line)
+		assert.Contains(t, report.Failures[0].Error(), "cannot parse level")
+	}
+
+	//Test Numeric Segments Index Arrays
+	report, err = ImportCSV(context.Background(), target, strings.NewReader("name,tags.1,tags.0,address.city\nLinus,kernel,git,Helsinki\n"), "members", newMember, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Imported)
+	assert.Nil(t, target.FindOneByField(context.Background(), "members", "name", "Linus", nil, imported))
+	assert.Equal(t, []string{"git", "kernel"}, imported.Tags)
+	assert.Equal(t, "Helsinki", imported.Address.City)
+
+	_, err = ImportCSV(context.Background(), target, strings.NewReader("a,b\n1,2\n"), "members", newMember, &ImportOptions{Columns: columns})
+	assert.Equal(t, ErrNoColumns, err)
+}
@@ -0,0 +1,361 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jcobhams/asari/document"
+	"github.com/jcobhams/asari/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TagName is the struct tag validation rules are read from.
+const TagName = "asari"
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	rulesCache   sync.Map
+)
+
+type (
+	// FieldError describes a single failed rule. Path is the bson path of the field - eg: "address.city"
+	FieldError struct {
+		Path    string
+		Rule    string
+		Param   string
+		Message string
+	}
+
+	// ValidationError lists every field that failed validation.
+	ValidationError struct {
+		Errors []FieldError
+	}
+
+	rule struct {
+		name    string
+		param   string
+		number  float64
+		pattern *regexp.Regexp
+		options []string
+	}
+
+	fieldRules struct {
+		field    document.Field
+		rules    []rule
+		required bool
+	}
+
+	referenceFiltersKey struct{}
+)
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Path + ": " + fe.Message
+	}
+	return "asari: validation failed: " + strings.Join(messages, "; ")
+}
+
+// WithReferenceFilters returns a context that adds filters to the queries of ref rules - eg: the tenant field so
+// documents cannot reference the documents of another tenant.
+func WithReferenceFilters(ctx context.Context, filters ...bson.E) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, referenceFiltersKey{}, filters)
+}
+
+func referenceFilters(ctx context.Context) []bson.E {
+	if ctx == nil {
+		return nil
+	}
+	filters, _ := ctx.Value(referenceFiltersKey{}).([]bson.E)
+	return filters
+}
+
+// Validate checks doc against the rules declared in its asari struct tags and returns a *ValidationError listing every
+// failure or nil if the document is valid.
+//
+// Rules are comma separated:
+// required - the field cannot be its zero value
+// min=<n>, max=<n> - bounds for numbers or the length of strings, slices and maps
+// len=<n> - exact length of strings, slices and maps
+// oneof=<a b c> - the value must be one of the space separated options
+// email - the value must look like an email address
+// ref=<collection> - the ObjectID (or slice of ObjectIDs) must reference live documents in collection
+// regex=<pattern> - the string must match pattern. regex must be the last rule as the pattern can contain commas.
+//
+// Rules other than required are skipped for zero values. ref rules are skipped when db is nil and only count the
+// referenced documents matching the filters of WithReferenceFilters.
+func Validate(ctx context.Context, db *mongo.Database, doc interface{}) error {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors.New("asari: cannot validate a nil document")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return errors.New("asari: only struct documents can be validated")
+	}
+
+	result := &ValidationError{}
+	if err := validateStruct(ctx, db, v, "", result); err != nil {
+		return err
+	}
+
+	if len(result.Errors) > 0 {
+		return result
+	}
+	return nil
+}
+
+func validateStruct(ctx context.Context, db *mongo.Database, v reflect.Value, prefix string, result *ValidationError) error {
+	parsed, err := rulesFor(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, fr := range parsed {
+		path := prefix + fr.field.Name
+		fv := v.FieldByIndex(fr.field.Index)
+
+		if fv.IsZero() {
+			if fr.required {
+				result.Errors = append(result.Errors, FieldError{Path: path, Rule: "required", Message: "is required"})
+			}
+			continue
+		}
+
+		for _, r := range fr.rules {
+			fe, err := r.check(ctx, db, fv)
+			if err != nil {
+				return err
+			}
+			if fe != nil {
+				fe.Path = path
+				result.Errors = append(result.Errors, *fe)
+			}
+		}
+
+		if err := validateNested(ctx, db, fv, path, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNested(ctx context.Context, db *mongo.Database, v reflect.Value, path string, result *ValidationError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			return nil
+		}
+		return validateStruct(ctx, db, v, path+".", result)
+	case reflect.Slice, reflect.Array:
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(ctx, db, v.Index(i), path+"."+strconv.Itoa(i), result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rulesFor(t reflect.Type) ([]fieldRules, error) {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]fieldRules), nil
+	}
+
+	var parsed []fieldRules
+	for _, f := range document.Fields(t) {
+		fr := fieldRules{field: f}
+		if tag, ok := f.StructField.Tag.Lookup(TagName); ok && tag != "" && tag != "-" {
+			var err error
+			if fr.rules, fr.required, err = parseTag(tag); err != nil {
+				return nil, errors.New(fmt.Sprintf("asari: invalid validation tag on %s: %v", f.Name, err))
+			}
+		}
+		parsed = append(parsed, fr)
+	}
+
+	rulesCache.Store(t, parsed)
+	return parsed, nil
+}
+
+func parseTag(tag string) ([]rule, bool, error) {
+	var rules []rule
+	required := false
+
+	for tag != "" {
+		part := tag
+		if strings.HasPrefix(tag, "regex=") {
+			tag = ""
+		} else if i := strings.Index(tag, ","); i > -1 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+
+		r := rule{name: strings.TrimSpace(part)}
+		if i := strings.Index(part, "="); i > -1 {
+			r.name, r.param = strings.TrimSpace(part[:i]), part[i+1:]
+		}
+
+		switch r.name {
+		case "required":
+			required = true
+			continue
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(r.param, 64)
+			if err != nil {
+				return nil, false, errors.New(fmt.Sprintf("%s needs a number", r.name))
+			}
+			r.number = n
+		case "regex":
+			pattern, err := regexp.Compile(r.param)
+			if err != nil {
+				return nil, false, err
+			}
+			r.pattern = pattern
+		case "oneof":
+			r.options = strings.Fields(r.param)
+		case "ref":
+			if r.param == "" {
+				return nil, false, errors.New("ref needs a collection")
+			}
+		case "email":
+		default:
+			return nil, false, errors.New(fmt.Sprintf("unknown rule %q", r.name))
+		}
+		rules = append(rules, r)
+	}
+	return rules, required, nil
+}
+
+func (r rule) check(ctx context.Context, db *mongo.Database, v reflect.Value) (*FieldError, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	fail := func(message string) (*FieldError, error) {
+		return &FieldError{Rule: r.name, Param: r.param, Message: message}, nil
+	}
+
+	switch r.name {
+	case "min":
+		if size, ok := measure(v); ok && size < r.number {
+			return fail("must be at least " + r.param)
+		}
+	case "max":
+		if size, ok := measure(v); ok && size > r.number {
+			return fail("must be at most " + r.param)
+		}
+	case "len":
+		if size, ok := length(v); ok && size != r.number {
+			return fail("must have a length of " + r.param)
+		}
+	case "regex":
+		if v.Kind() == reflect.String && !r.pattern.MatchString(v.String()) {
+			return fail("must match " + r.param)
+		}
+	case "email":
+		if v.Kind() == reflect.String && !emailPattern.MatchString(v.String()) {
+			return fail("must be a valid email address")
+		}
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		for _, o := range r.options {
+			if o == value {
+				return nil, nil
+			}
+		}
+		return fail("must be one of " + strings.Join(r.options, ", "))
+	case "ref":
+		if db == nil {
+			return nil, nil
+		}
+		exists, err := referencesExist(ctx, db, r.param, v)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return fail("references a document that does not exist in " + r.param)
+		}
+	}
+	return nil, nil
+}
+
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return length(v)
+}
+
+func length(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
+
+func referencesExist(ctx context.Context, db *mongo.Database, collection string, v reflect.Value) (bool, error) {
+	ids := map[primitive.ObjectID]bool{}
+	switch value := v.Interface().(type) {
+	case primitive.ObjectID:
+		ids[value] = true
+	case []primitive.ObjectID:
+		for _, id := range value {
+			ids[id] = true
+		}
+	default:
+		return false, errors.New(fmt.Sprintf("asari: ref rules only apply to primitive.ObjectID values, got %T", value))
+	}
+
+	in := make([]primitive.ObjectID, 0, len(ids))
+	for id := range ids {
+		in = append(in, id)
+	}
+
+	filter := bson.D{
+		bson.E{Key: "_id", Value: bson.D{bson.E{Key: operator.In, Value: in}}},
+		bson.E{Key: "is_deleted", Value: false},
+	}
+	filter = append(filter, referenceFilters(ctx)...)
+	count, err := db.Collection(collection).CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return int(count) == len(in), nil
+}
@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"github.com/jcobhams/asari/document"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+type address struct {
+	City    string `bson:"city" asari:"required"`
+	ZipCode string `bson:"zip_code" asari:"len=5"`
+}
+
+type user struct {
+	document.Base `bson:",inline"`
+	FirstName     string             `bson:"first_name" asari:"required,min=2,max=10"`
+	Email         string             `bson:"email" asari:"required,email"`
+	Level         int                `bson:"level" asari:"max=5"`
+	Role          string             `bson:"role" asari:"oneof=admin member"`
+	Slug          string             `bson:"slug" asari:"regex=^[a-z]{1,3}(-[a-z]+)?$"`
+	OwnerID       primitive.ObjectID `bson:"owner_id" asari:"ref=users"`
+	Address       address            `bson:"address"`
+	Previous      []address          `bson:"previous"`
+}
+
+type badTag struct {
+	Name string `bson:"name" asari:"requird"`
+}
+
+func TestValidate(t *testing.T) {
+	u := &user{
+		FirstName: "Joseph",
+		Email:     "joseph@asari.io",
+		Level:     2,
+		Role:      "admin",
+		Slug:      "ab-cd",
+		OwnerID:   primitive.NewObjectID(),
+		Address:   address{City: "Lagos"},
+	}
+	assert.Nil(t, Validate(nil, nil, u))
+
+	u = &user{
+		FirstName: "J",
+		Email:     "joseph",
+		Level:     6,
+		Role:      "owner",
+		Slug:      "abcd",
+		Address:   address{ZipCode: "123"},
+		Previous:  []address{{City: "Abuja"}, {}},
+	}
+	err := Validate(nil, nil, u)
+
+	var ve *ValidationError
+	if assert.True(t, errors.As(err, &ve)) {
+		paths := map[string]string{}
+		for _, fe := range ve.Errors {
+			paths[fe.Path] = fe.Rule
+		}
+		assert.Equal(t, map[string]string{
+			"first_name":       "min",
+			"email":            "email",
+			"level":            "max",
+			"role":             "oneof",
+			"slug":             "regex",
+			"address.city":     "required",
+			"address.zip_code": "len",
+			"previous.1.city":  "required",
+		}, paths)
+	}
+
+	//Test Nested Slices
+	u = &user{FirstName: "Joseph", Email: "joseph@asari.io", Address: address{City: "Lagos"}, Previous: []address{{City: "Abuja"}, {ZipCode: "12345"}}}
+	err = Validate(nil, nil, u)
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Equal(t, 1, len(ve.Errors))
+		assert.Equal(t, "previous.1.city", ve.Errors[0].Path)
+	}
+
+	//Test Invalid Tags And Values
+	assert.Error(t, Validate(nil, nil, &badTag{}))
+	assert.Error(t, Validate(nil, nil, "asari"))
+	assert.Error(t, Validate(nil, nil, (*user)(nil)))
+}
+
+func TestWithReferenceFilters(t *testing.T) {
+	assert.Nil(t, referenceFilters(context.Background()))
+
+	ctx := WithReferenceFilters(nil, bson.E{Key: document.TenantField, Value: "acme"})
+	assert.Equal(t, []bson.E{{Key: document.TenantField, Value: "acme"}}, referenceFilters(ctx))
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := &ValidationError{Errors: []FieldError{
+		{Path: "email", Message: "is required"},
+		{Path: "level", Message: "must be at most 5"},
+	}}
+	assert.Equal(t, "asari: validation failed: email: is required; level: must be at most 5", err.Error())
+}